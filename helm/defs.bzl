@@ -9,6 +9,10 @@ load(
     ":helm_chart.bzl",
     _helm_chart = "helm_chart",
 )
+load(
+    ":helm_deployment.bzl",
+    _helm_deployment = "helm_deployment",
+)
 load(
     ":helm_import.bzl",
     _helm_import = "helm_import",
@@ -23,6 +27,7 @@ load(
 load(
     ":helm_lint.bzl",
     _helm_lint_aspect = "helm_lint_aspect",
+    _helm_lint_scenario = "helm_lint_scenario",
     _helm_lint_test = "helm_lint_test",
 )
 load(
@@ -48,6 +53,10 @@ load(
     ":helm_toolchain.bzl",
     _helm_toolchain = "helm_toolchain",
 )
+load(
+    ":helm_unittest.bzl",
+    _helm_unittest_test = "helm_unittest_test",
+)
 load(
     ":providers.bzl",
     _HelmPackageInfo = "HelmPackageInfo",
@@ -56,10 +65,12 @@ load(
 chart_content = _chart_content
 chart_file = _chart_file
 helm_chart = _helm_chart
+helm_deployment = _helm_deployment
 helm_import = _helm_import
 helm_import_repository = _helm_import_repository
 helm_install = _helm_install
 helm_lint_aspect = _helm_lint_aspect
+helm_lint_scenario = _helm_lint_scenario
 helm_lint_test = _helm_lint_test
 helm_package = _helm_package
 helm_plugin = _helm_plugin
@@ -70,5 +81,6 @@ helm_template = _helm_template
 helm_template_test = _helm_template_test
 helm_toolchain = _helm_toolchain
 helm_uninstall = _helm_uninstall
+helm_unittest_test = _helm_unittest_test
 helm_upgrade = _helm_upgrade
 HelmPackageInfo = _HelmPackageInfo
@@ -0,0 +1,8 @@
+"""# helm_deployment rules."""
+
+load(
+    "//helm/private:helm_deployment.bzl",
+    _helm_deployment = "helm_deployment",
+)
+
+helm_deployment = _helm_deployment
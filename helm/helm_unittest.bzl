@@ -0,0 +1,8 @@
+"""# helm_unittest rules."""
+
+load(
+    "//helm/private:helm_unittest.bzl",
+    _helm_unittest_test = "helm_unittest_test",
+)
+
+helm_unittest_test = _helm_unittest_test
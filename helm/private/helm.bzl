@@ -28,6 +28,8 @@ def helm_chart(
         uninstall_opts = [],
         data = [],
         stamp = None,
+        build_info_annotations = False,
+        image_helpers = False,
         **kwargs):
     """Rules for producing a helm package and some convenience targets.
 
@@ -65,6 +67,8 @@ def helm_chart(
         upgrade_opts (list, optional): Additional options to pass to `helm upgrade`.
         data (list, optional): Additional runtime data to pass to the helm install, upgrade, and uninstall targets.
         stamp (int):  Whether to encode build information into the helm chart.
+        build_info_annotations (bool, optional): Whether to add build information annotations to `Chart.yaml`.
+        image_helpers (bool, optional): Whether to generate named templates for `images` in `templates/_images.tpl`.
         **kwargs (dict): Additional keyword arguments for `helm_package`.
     """
     if chart_json == None and chart == None:
@@ -101,6 +105,8 @@ def helm_chart(
         files = files,
         images = images,
         stamp = stamp,
+        build_info_annotations = build_info_annotations,
+        image_helpers = image_helpers,
         substitutions = substitutions,
         templates = templates,
         values = values,
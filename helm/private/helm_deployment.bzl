@@ -0,0 +1,160 @@
+"""Helm deployment rules"""
+
+load(":helm_install.bzl", "HelmInstallInfo")
+load(":helm_utils.bzl", "rlocationpath", "symlink")
+
+def _check_dependencies(label, releases, dependencies):
+    for release, deps in dependencies.items():
+        for dep in [release] + deps:
+            if dep not in releases:
+                fail("`dependencies` of {} refers to {}, which is not in `releases`".format(label, dep))
+
+    # Repeatedly remove the releases whose dependencies have all been removed.
+    remaining = list(releases)
+    for _ in range(len(releases)):
+        ready = [
+            release
+            for release in remaining
+            if not [dep for dep in dependencies.get(release, []) if dep in remaining]
+        ]
+        if not ready:
+            break
+        remaining = [release for release in remaining if release not in ready]
+
+    if remaining:
+        fail("`dependencies` of {} contain a cycle between: {}".format(label, ", ".join(remaining)))
+
+def _helm_deployment_impl(ctx):
+    if ctx.executable._runner.basename.endswith(".exe"):
+        runner_wrapper = ctx.actions.declare_file(ctx.label.name + ".exe")
+    else:
+        runner_wrapper = ctx.actions.declare_file(ctx.label.name)
+
+    symlink(
+        ctx = ctx,
+        target_file = ctx.executable._runner,
+        output = runner_wrapper,
+    )
+
+    _check_dependencies(
+        ctx.label,
+        [str(release.label) for release in ctx.attr.releases],
+        ctx.attr.dependencies,
+    )
+
+    releases = []
+    runfiles = ctx.runfiles([runner_wrapper, ctx.executable._runner])
+    for release in ctx.attr.releases:
+        install_info = release[HelmInstallInfo]
+        releases.append({
+            "args_file": rlocationpath(install_info.args_file, ctx.workspace_name),
+            "dependencies": ctx.attr.dependencies.get(str(release.label), []),
+            "label": str(release.label),
+            "release": install_info.release,
+        })
+        runfiles = runfiles.merge(release[DefaultInfo].default_runfiles)
+
+    config = ctx.actions.declare_file("{}.deployment.json".format(ctx.label.name))
+    ctx.actions.write(
+        output = config,
+        content = json.encode_indent({
+            "releases": releases,
+            "rollback_on_failure": ctx.attr.rollback_on_failure,
+        }, indent = " " * 4),
+    )
+
+    return [
+        DefaultInfo(
+            files = depset([runner_wrapper]),
+            runfiles = runfiles.merge(ctx.runfiles([config])),
+            executable = runner_wrapper,
+        ),
+        RunEnvironmentInfo(
+            environment = {
+                "RULES_HELM_HELM_DEPLOYMENT_CONFIG": rlocationpath(config, ctx.workspace_name),
+            },
+        ),
+    ]
+
+_helm_deployment = rule(
+    doc = "Produce an executable deploying a set of `helm_install` or `helm_upgrade` targets.",
+    implementation = _helm_deployment_impl,
+    executable = True,
+    attrs = {
+        "dependencies": attr.string_list_dict(
+            doc = "A mapping of canonical release labels to the labels of the releases they depend on.",
+        ),
+        "releases": attr.label_list(
+            doc = "The `helm_install` or `helm_upgrade` targets to deploy.",
+            providers = [HelmInstallInfo],
+            mandatory = True,
+        ),
+        "rollback_on_failure": attr.bool(
+            doc = "Whether to roll back the releases which were deployed when any release fails.",
+            default = False,
+        ),
+        "_runner": attr.label(
+            doc = "A process wrapper to use for deploying releases.",
+            executable = True,
+            cfg = "exec",
+            default = Label("//helm/private/runner"),
+        ),
+    },
+)
+
+def helm_deployment(
+        *,
+        name,
+        releases,
+        dependencies = {},
+        rollback_on_failure = False,
+        **kwargs):
+    """Produce an executable deploying a set of releases as one unit.
+
+    Releases are deployed in the order declared by `dependencies`, e.g. a chart of CRDs, then \
+    operators, then applications. Releases whose dependencies have been deployed run in parallel \
+    and the output of each is prefixed with its label. Once a release fails, no further releases \
+    are started and the deployment fails after the running releases finish.
+
+    ```python
+    load("@rules_helm//helm:defs.bzl", "helm_deployment")
+
+    helm_deployment(
+        name = "deploy",
+        releases = [":crds.upgrade", ":operator.upgrade", ":app.upgrade"],
+        dependencies = {
+            ":app.upgrade": [":operator.upgrade"],
+            ":operator.upgrade": [":crds.upgrade"],
+        },
+        rollback_on_failure = True,
+    )
+    ```
+
+    When `rollback_on_failure` is set, the latest revision of each release is recorded before it \
+    is deployed. If the deployment fails, the releases which were deployed are rolled back to \
+    that revision in reverse order, or uninstalled if they were not installed before.
+
+    Releases do not read from stdin, so releases with `production_kube_contexts` must be \
+    confirmed by setting `RULES_HELM_CONFIRM_KUBE_CONTEXT`.
+
+    Running the target with `--rules-helm-plan` (or `RULES_HELM_PLAN=1`) prints the plan of each \
+    release in the order they would be deployed. See `helm_install`.
+
+    Args:
+        name (str): The name of the target.
+        releases (list): The [helm_install](#helm_install) or [helm_upgrade](#helm_upgrade) targets to deploy.
+        dependencies (dict, optional): A mapping of releases to the releases which must be deployed before them.
+        rollback_on_failure (bool, optional): Whether to roll back the releases which were deployed when
+            any release fails.
+        **kwargs (dict): Additional keyword arguments for the rule, e.g. `tags` or `visibility`.
+    """
+    _helm_deployment(
+        name = name,
+        releases = releases,
+        dependencies = {
+            str(native.package_relative_label(release)): [str(native.package_relative_label(dep)) for dep in deps]
+            for release, deps in dependencies.items()
+        },
+        rollback_on_failure = rollback_on_failure,
+        **kwargs
+    )
@@ -1,12 +1,15 @@
 """Helm rules"""
 
+load("@bazel_skylib//rules:common_settings.bzl", "BuildSettingInfo")
 load("//helm:providers.bzl", "HelmPackageInfo")
 load(":helm_utils.bzl", "is_stamping_enabled", "rlocationpath", "symlink")
+load(":images.bzl", "write_image_manifest")
 
 HelmInstallInfo = provider(
     doc = "Info about a helm installer.",
     fields = {
         "args_file": "File: The arguments file generated for the install command.",
+        "release": "str: The name of the release.",
     },
 )
 
@@ -17,11 +20,14 @@ def _stamp_args_file(
         raw_args,
         output,
         chart = None,
-        image_pushers = []):
+        image_manifest = None,
+        hooks = None,
+        kube_guard = None):
     inputs = []
 
     stamper_args = ctx.actions.args()
     stamper_args.add("-output", output)
+    stamper_args.add("-placeholder_syntax", ctx.attr._placeholder_syntax[BuildSettingInfo].value)
 
     if is_stamping_enabled(ctx.attr):
         stamper_args.add("-stable_status_file", ctx.info_file)
@@ -39,8 +45,14 @@ def _stamp_args_file(
     runner_args.add("-helm", rlocationpath(helm_toolchain.helm, ctx.workspace_name))
     runner_args.add("-helm_plugins", rlocationpath(helm_toolchain.helm_plugins, ctx.workspace_name))
 
-    if image_pushers:
-        runner_args.add("-image_pushers", ",".join([rlocationpath(p, ctx.workspace_name) for p in image_pushers]))
+    if image_manifest:
+        runner_args.add("-image_manifest", rlocationpath(image_manifest, ctx.workspace_name))
+
+    if hooks:
+        runner_args.add("-hooks", rlocationpath(hooks, ctx.workspace_name))
+
+    if kube_guard:
+        runner_args.add("-kube_guard", rlocationpath(kube_guard, ctx.workspace_name))
 
     runner_args.add("--")
 
@@ -57,6 +69,91 @@ def _stamp_args_file(
 def _expand_opts(ctx, opts, targets):
     return [ctx.expand_location(x, targets = targets) for x in opts]
 
+_POST_DEPLOY_HOOK_CONDITIONS = ["always", "failure", "success"]
+
+def _hook_executable(target, attr):
+    executable = target[DefaultInfo].files_to_run.executable
+    if not executable:
+        fail("`{}` target {} is not executable".format(attr, target.label))
+    return executable
+
+def _write_hooks(*, ctx, release, metadata):
+    """Write the description of the deploy hooks of an install or upgrade.
+
+    Args:
+        ctx (ctx): The rule's context object.
+        release (str): The name of the release.
+        metadata (File): The metadata of the chart being deployed.
+
+    Returns:
+        Tuple[File, runfiles]: The description (None without hooks) and the runfiles of the hooks.
+    """
+    if not ctx.attr.pre_deploy_hooks and not ctx.attr.post_deploy_hooks:
+        return None, ctx.runfiles()
+
+    runfiles = ctx.runfiles([metadata])
+    pre = []
+    for target in ctx.attr.pre_deploy_hooks:
+        executable = _hook_executable(target, "pre_deploy_hooks")
+        pre.append(rlocationpath(executable, ctx.workspace_name))
+        runfiles = runfiles.merge(ctx.runfiles([executable])).merge(target[DefaultInfo].default_runfiles)
+
+    post = []
+    for target, when in ctx.attr.post_deploy_hooks.items():
+        if when not in _POST_DEPLOY_HOOK_CONDITIONS:
+            fail("`post_deploy_hooks` of {} must be one of {}, got `{}` for {}".format(
+                ctx.label,
+                _POST_DEPLOY_HOOK_CONDITIONS,
+                when,
+                target.label,
+            ))
+        executable = _hook_executable(target, "post_deploy_hooks")
+        post.append({
+            "executable": rlocationpath(executable, ctx.workspace_name),
+            "when": when,
+        })
+        runfiles = runfiles.merge(ctx.runfiles([executable])).merge(target[DefaultInfo].default_runfiles)
+
+    hooks = ctx.actions.declare_file("{}.hooks.json".format(ctx.label.name))
+    ctx.actions.write(
+        output = hooks,
+        content = json.encode_indent({
+            "metadata": rlocationpath(metadata, ctx.workspace_name),
+            "post": post,
+            "pre": pre,
+            "release": release,
+        }, indent = " " * 4),
+    )
+
+    return hooks, runfiles.merge(ctx.runfiles([hooks]))
+
+def _write_kube_guard(*, ctx, release):
+    """Write the kube contexts and namespace an install, upgrade, or uninstall may use.
+
+    Args:
+        ctx (ctx): The rule's context object.
+        release (str): The name of the release.
+
+    Returns:
+        File: The description, or None if any context and namespace may be used.
+    """
+    if not (ctx.attr.kube_contexts or ctx.attr.kube_clusters or ctx.attr.kube_namespace or ctx.attr.production_kube_contexts):
+        return None
+
+    kube_guard = ctx.actions.declare_file("{}.kube_guard.json".format(ctx.label.name))
+    ctx.actions.write(
+        output = kube_guard,
+        content = json.encode_indent({
+            "clusters": ctx.attr.kube_clusters,
+            "contexts": ctx.attr.kube_contexts,
+            "namespace": ctx.attr.kube_namespace,
+            "production_contexts": ctx.attr.production_kube_contexts,
+            "release": release,
+        }, indent = " " * 4),
+    )
+
+    return kube_guard
+
 def _helm_install_impl(ctx, subcommand = "install"):
     toolchain = ctx.toolchains[Label("//helm:toolchain_type")]
 
@@ -75,11 +172,15 @@ def _helm_install_impl(ctx, subcommand = "install"):
 
     pkg_info = ctx.attr.package[HelmPackageInfo]
 
-    image_pushers = []
-    image_runfiles = []
-    for image in pkg_info.images:
-        image_pushers.append(image[DefaultInfo].files_to_run.executable)
-        image_runfiles.append(image[DefaultInfo].default_runfiles)
+    image_manifest = None
+    image_runfiles = ctx.runfiles()
+    if pkg_info.images:
+        image_manifest = ctx.actions.declare_file("{}.images.json".format(ctx.label.name))
+        image_runfiles = write_image_manifest(
+            ctx = ctx,
+            images = pkg_info.images,
+            output = image_manifest,
+        )
 
     args = ctx.actions.args()
     args.add_all(_expand_opts(ctx, ctx.attr.helm_opts, ctx.attr.data))
@@ -88,11 +189,21 @@ def _helm_install_impl(ctx, subcommand = "install"):
     args.add(install_name)
     args.add(rlocationpath(pkg_info.chart, ctx.workspace_name))
 
+    hooks, hooks_runfiles = _write_hooks(
+        ctx = ctx,
+        release = install_name,
+        metadata = pkg_info.metadata,
+    )
+
+    kube_guard = _write_kube_guard(ctx = ctx, release = install_name)
+
     args_file = _stamp_args_file(
         ctx = ctx,
         helm_toolchain = toolchain,
         chart = pkg_info.chart,
-        image_pushers = image_pushers,
+        image_manifest = image_manifest,
+        hooks = hooks,
+        kube_guard = kube_guard,
         raw_args = args,
         output = ctx.actions.declare_file("{}.args.txt".format(ctx.label.name)),
     )
@@ -104,10 +215,7 @@ def _helm_install_impl(ctx, subcommand = "install"):
         toolchain.helm,
         toolchain.helm_plugins,
         pkg_info.chart,
-    ] + image_pushers + ctx.files.data)
-
-    for ir in image_runfiles:
-        runfiles = runfiles.merge(ir)
+    ] + ([kube_guard] if kube_guard else []) + ctx.files.data).merge(image_runfiles).merge(hooks_runfiles)
 
     return [
         DefaultInfo(
@@ -122,11 +230,21 @@ def _helm_install_impl(ctx, subcommand = "install"):
         ),
         HelmInstallInfo(
             args_file = args_file,
+            release = install_name,
         ),
     ]
 
 helm_install = rule(
-    doc = "Produce an executable for performing a `helm install` operation.",
+    doc = """\
+Produce an executable for performing a `helm install` operation.
+
+The images of `package` are pushed before installing. See `helm_push` for the environment \
+variables controlling how images are pushed.
+
+To check what the target will do, run it with `bazel run <target> -- --rules-helm-plan` (or \
+set `RULES_HELM_PLAN=1`). The resolved helm command, the chart and its digest, the image \
+pushers, and the kube context and namespace are printed without executing anything.
+""",
     implementation = _helm_install_impl,
     executable = True,
     attrs = {
@@ -141,6 +259,19 @@ helm_install = rule(
         "install_name": attr.string(
             doc = "The name to use for the `helm install` command. The target name will be used if unset.",
         ),
+        "kube_clusters": attr.string_list(
+            doc = "The names of the clusters `helm install` may run against. Any cluster is allowed if empty.",
+        ),
+        "kube_contexts": attr.string_list(
+            doc = """\
+                The kube contexts `helm install` may run against. Any context is allowed if empty. The \
+                context is resolved like helm does, from `--kube-context`, `HELM_KUBECONTEXT`, and the \
+                current context of the kubeconfig, and the runner refuses to run on a mismatch.
+            """,
+        ),
+        "kube_namespace": attr.string(
+            doc = "The namespace `helm install` must run in, if set.",
+        ),
         "opts": attr.string_list(
             doc = "Additional arguments to pass to `helm install`.",
         ),
@@ -149,11 +280,46 @@ helm_install = rule(
             providers = [HelmPackageInfo],
             mandatory = True,
         ),
+        "post_deploy_hooks": attr.label_keyed_string_dict(
+            doc = """\
+                Executables to run after `helm install`, mapped to when they run: `success`, `failure`, \
+                or `always`. Hooks run in order and receive the environment of `pre_deploy_hooks` \
+                along with `RULES_HELM_HELM_EXIT_CODE`. A failing hook fails the deploy but does not \
+                stop other hooks from running.
+            """,
+            cfg = "target",
+        ),
+        "pre_deploy_hooks": attr.label_list(
+            doc = """\
+                Executables to run in order before `helm install`, e.g. database migrations. A failing \
+                hook aborts the deploy. Hooks receive the following environment variables:
+
+                | variable | value |
+                | --- | --- |
+                | `RULES_HELM_RELEASE_NAME` | The name of the release. |
+                | `RULES_HELM_RELEASE_NAMESPACE` | The namespace of the release. |
+                | `RULES_HELM_KUBE_CONTEXT` | The kube context of the release. |
+                | `RULES_HELM_CHART_NAME` | The name of the chart. |
+                | `RULES_HELM_CHART_VERSION` | The version of the chart. |
+                | `RULES_HELM_HOOK_PHASE` | `pre` or `post`. |
+            """,
+            cfg = "target",
+        ),
+        "production_kube_contexts": attr.string_list(
+            doc = """\
+                Kube contexts which require confirmation before running `helm install`. The name of the \
+                context must be typed interactively, or `RULES_HELM_CONFIRM_KUBE_CONTEXT` set to it.
+            """,
+        ),
         "_copier": attr.label(
             cfg = "exec",
             executable = True,
             default = Label("//helm/private/copier"),
         ),
+        "_placeholder_syntax": attr.label(
+            doc = "The delimiters used for stamp placeholders.",
+            default = Label("//helm/settings:placeholder_syntax"),
+        ),
         "_runner": attr.label(
             doc = "A process wrapper to use for performing `helm install`.",
             executable = True,
@@ -179,7 +345,16 @@ def _helm_upgrade_impl(ctx):
     return _helm_install_impl(ctx, "upgrade")
 
 helm_upgrade = rule(
-    doc = "Produce an executable for performing a `helm upgrade` operation.",
+    doc = """\
+Produce an executable for performing a `helm upgrade` operation.
+
+The images of `package` are pushed before upgrading. See `helm_push` for the environment \
+variables controlling how images are pushed.
+
+To check what the target will do, run it with `bazel run <target> -- --rules-helm-plan` (or \
+set `RULES_HELM_PLAN=1`). The resolved helm command, the chart and its digest, the image \
+pushers, and the kube context and namespace are printed without executing anything.
+""",
     implementation = _helm_upgrade_impl,
     executable = True,
     attrs = {
@@ -194,6 +369,19 @@ helm_upgrade = rule(
         "install_name": attr.string(
             doc = "The name to use for the `helm upgrade` command. The target name will be used if unset.",
         ),
+        "kube_clusters": attr.string_list(
+            doc = "The names of the clusters `helm upgrade` may run against. Any cluster is allowed if empty.",
+        ),
+        "kube_contexts": attr.string_list(
+            doc = """\
+                The kube contexts `helm upgrade` may run against. Any context is allowed if empty. The \
+                context is resolved like helm does, from `--kube-context`, `HELM_KUBECONTEXT`, and the \
+                current context of the kubeconfig, and the runner refuses to run on a mismatch.
+            """,
+        ),
+        "kube_namespace": attr.string(
+            doc = "The namespace `helm upgrade` must run in, if set.",
+        ),
         "opts": attr.string_list(
             doc = "Additional arguments to pass to `helm upgrade`.",
         ),
@@ -202,11 +390,46 @@ helm_upgrade = rule(
             providers = [HelmPackageInfo],
             mandatory = True,
         ),
+        "post_deploy_hooks": attr.label_keyed_string_dict(
+            doc = """\
+                Executables to run after `helm upgrade`, mapped to when they run: `success`, `failure`, \
+                or `always`. Hooks run in order and receive the environment of `pre_deploy_hooks` \
+                along with `RULES_HELM_HELM_EXIT_CODE`. A failing hook fails the deploy but does not \
+                stop other hooks from running.
+            """,
+            cfg = "target",
+        ),
+        "pre_deploy_hooks": attr.label_list(
+            doc = """\
+                Executables to run in order before `helm upgrade`, e.g. database migrations. A failing \
+                hook aborts the deploy. Hooks receive the following environment variables:
+
+                | variable | value |
+                | --- | --- |
+                | `RULES_HELM_RELEASE_NAME` | The name of the release. |
+                | `RULES_HELM_RELEASE_NAMESPACE` | The namespace of the release. |
+                | `RULES_HELM_KUBE_CONTEXT` | The kube context of the release. |
+                | `RULES_HELM_CHART_NAME` | The name of the chart. |
+                | `RULES_HELM_CHART_VERSION` | The version of the chart. |
+                | `RULES_HELM_HOOK_PHASE` | `pre` or `post`. |
+            """,
+            cfg = "target",
+        ),
+        "production_kube_contexts": attr.string_list(
+            doc = """\
+                Kube contexts which require confirmation before running `helm upgrade`. The name of the \
+                context must be typed interactively, or `RULES_HELM_CONFIRM_KUBE_CONTEXT` set to it.
+            """,
+        ),
         "_copier": attr.label(
             cfg = "exec",
             executable = True,
             default = Label("//helm/private/copier"),
         ),
+        "_placeholder_syntax": attr.label(
+            doc = "The delimiters used for stamp placeholders.",
+            default = Label("//helm/settings:placeholder_syntax"),
+        ),
         "_runner": attr.label(
             doc = "A process wrapper to use for performing `helm install`.",
             executable = True,
@@ -250,9 +473,12 @@ def _helm_uninstall_impl(ctx):
     args.add_all(_expand_opts(ctx, ctx.attr.opts, ctx.attr.data))
     args.add(install_name)
 
+    kube_guard = _write_kube_guard(ctx = ctx, release = install_name)
+
     args_file = _stamp_args_file(
         ctx = ctx,
         helm_toolchain = toolchain,
+        kube_guard = kube_guard,
         raw_args = args,
         output = ctx.actions.declare_file("{}.args.txt".format(ctx.label.name)),
     )
@@ -263,7 +489,7 @@ def _helm_uninstall_impl(ctx):
         ctx.executable._runner,
         toolchain.helm,
         toolchain.helm_plugins,
-    ] + ctx.files.data)
+    ] + ([kube_guard] if kube_guard else []) + ctx.files.data)
 
     return [
         DefaultInfo(
@@ -279,7 +505,11 @@ def _helm_uninstall_impl(ctx):
     ]
 
 helm_uninstall = rule(
-    doc = "Produce an executable for performing a `helm uninstall` operation.",
+    doc = """\
+Produce an executable for performing a `helm uninstall` operation.
+
+Supports plan mode (`--rules-helm-plan` or `RULES_HELM_PLAN=1`) as described in `helm_install`.
+""",
     implementation = _helm_uninstall_impl,
     executable = True,
     attrs = {
@@ -294,14 +524,37 @@ helm_uninstall = rule(
         "install_name": attr.string(
             doc = "The name to use for the `helm install` command. The target name will be used if unset.",
         ),
+        "kube_clusters": attr.string_list(
+            doc = "The names of the clusters `helm uninstall` may run against. Any cluster is allowed if empty.",
+        ),
+        "kube_contexts": attr.string_list(
+            doc = """\
+                The kube contexts `helm uninstall` may run against. Any context is allowed if empty. The \
+                context is resolved like helm does, from `--kube-context`, `HELM_KUBECONTEXT`, and the \
+                current context of the kubeconfig, and the runner refuses to run on a mismatch.
+            """,
+        ),
+        "kube_namespace": attr.string(
+            doc = "The namespace `helm uninstall` must run in, if set.",
+        ),
         "opts": attr.string_list(
             doc = "Additional arguments to pass to `helm uninstall`.",
         ),
+        "production_kube_contexts": attr.string_list(
+            doc = """\
+                Kube contexts which require confirmation before running `helm uninstall`. The name of the \
+                context must be typed interactively, or `RULES_HELM_CONFIRM_KUBE_CONTEXT` set to it.
+            """,
+        ),
         "_copier": attr.label(
             cfg = "exec",
             executable = True,
             default = Label("//helm/private/copier"),
         ),
+        "_placeholder_syntax": attr.label(
+            doc = "The delimiters used for stamp placeholders.",
+            default = Label("//helm/settings:placeholder_syntax"),
+        ),
         "_runner": attr.label(
             doc = "A process wrapper to use for performing `helm install`.",
             executable = True,
@@ -4,6 +4,43 @@ load("@bazel_skylib//rules:common_settings.bzl", "BuildSettingInfo")
 load("//helm:providers.bzl", "HelmPackageInfo")
 load(":helm_utils.bzl", "rlocationpath", "symlink")
 
+HelmLintScenarioInfo = provider(
+    doc = "A named set of values to lint a helm chart with.",
+    fields = {
+        "name": "str: The name of the scenario.",
+        "substitutions": "dict[str, str]: Values passed to `helm lint --set`.",
+        "values": "list[File]: Values files passed to `helm lint --values`.",
+    },
+)
+
+def _helm_lint_scenario_impl(ctx):
+    return [
+        HelmLintScenarioInfo(
+            name = ctx.attr.scenario_name or ctx.label.name,
+            substitutions = ctx.attr.substitutions,
+            values = ctx.files.values,
+        ),
+    ]
+
+helm_lint_scenario = rule(
+    implementation = _helm_lint_scenario_impl,
+    doc = "A set of values for `helm_lint_test.scenarios`.",
+    attrs = {
+        "scenario_name": attr.string(
+            doc = "The name of the scenario in lint reports. Defaults to the target name.",
+        ),
+        "substitutions": attr.string_dict(
+            doc = "A dictionary of substitutions passed to `helm lint --set` flag.",
+            default = {},
+        ),
+        "values": attr.label_list(
+            doc = "A list of files passed to `helm lint --values` flag.",
+            default = [],
+            allow_files = True,
+        ),
+    },
+)
+
 def _helm_lint_aspect_impl(target, ctx):
     if HelmPackageInfo not in target:
         return []
@@ -24,17 +61,19 @@ def _helm_lint_aspect_impl(target, ctx):
     strict = ctx.attr._strict_setting[BuildSettingInfo].value
 
     output = ctx.actions.declare_file(ctx.label.name + ".helm_lint.ok")
+    report = ctx.actions.declare_file(ctx.label.name + ".helm_lint.json")
 
     args = ctx.actions.args()
     args.add("-helm", toolchain.helm)
     args.add("-helm_plugins", toolchain.helm_plugins.path)
     args.add("-package", helm_pkg_info.chart)
     args.add("-output", output)
+    args.add("-report", report)
     if strict:
         args.add("-strict")
 
     ctx.actions.run(
-        outputs = [output],
+        outputs = [output, report],
         executable = ctx.executable._linter,
         mnemonic = "HelmLintCheck",
         inputs = [helm_pkg_info.chart],
@@ -45,11 +84,17 @@ def _helm_lint_aspect_impl(target, ctx):
     return [
         OutputGroupInfo(
             helm_lint_checks = depset([output]),
+            helm_lint_reports = depset([report]),
         ),
     ]
 
 helm_lint_aspect = aspect(
-    doc = "An aspect for running `helm lint` on helm package targets",
+    doc = """\
+An aspect for running `helm lint` on helm package targets.
+
+In addition to the `helm_lint_checks` output group, a JSON report of all lint findings \
+(severity, chart, file, line and message) is available in the `helm_lint_reports` output group.
+""",
     implementation = _helm_lint_aspect_impl,
     attrs = {
         "_linter": attr.label(
@@ -91,6 +136,50 @@ def _helm_lint_test_impl(ctx):
     for v in ctx.files.values:
         args.add("-values", rlocationpath(v, ctx.workspace_name))
 
+    lint_config = []
+    if ctx.file.lint_config:
+        lint_config.append(ctx.file.lint_config)
+        args.add("-config", rlocationpath(ctx.file.lint_config, ctx.workspace_name))
+
+    for check in ctx.attr.policy_checks:
+        args.add("-policy_check", check)
+
+    if ctx.attr.kube_version:
+        args.add("-kube_version", ctx.attr.kube_version)
+
+    if ctx.attr.with_subcharts:
+        args.add("-with_subcharts")
+
+    for schema in ctx.files.schemas:
+        args.add("-schema", rlocationpath(schema, ctx.workspace_name))
+
+    if ctx.attr.strict_schemas:
+        args.add("-strict_schemas")
+
+    scenario_files = []
+    if ctx.attr.scenarios:
+        scenarios = []
+        names = {}
+        for target in ctx.attr.scenarios:
+            scenario = target[HelmLintScenarioInfo]
+            if scenario.name in names:
+                fail("Duplicate scenario name `{}` in {}".format(scenario.name, ctx.label))
+            names[scenario.name] = True
+            scenario_files.extend(scenario.values)
+            scenarios.append({
+                "name": scenario.name,
+                "substitutions": scenario.substitutions,
+                "values": [rlocationpath(v, ctx.workspace_name) for v in scenario.values],
+            })
+
+        scenarios_file = ctx.actions.declare_file(ctx.label.name + ".scenarios.json")
+        ctx.actions.write(
+            output = scenarios_file,
+            content = json.encode_indent(scenarios, indent = " " * 4),
+        )
+        scenario_files.append(scenarios_file)
+        args.add("-scenarios", rlocationpath(scenarios_file, ctx.workspace_name))
+
     ctx.actions.write(
         output = args_file,
         content = args,
@@ -112,7 +201,7 @@ def _helm_lint_test_impl(ctx):
         DefaultInfo(
             files = depset([test_runner]),
             runfiles = ctx.runfiles(
-                files = [toolchain.helm, toolchain.helm_plugins, helm_pkg_info.chart, args_file] + ctx.files.values,
+                files = [toolchain.helm, toolchain.helm_plugins, helm_pkg_info.chart, args_file] + ctx.files.values + ctx.files.schemas + lint_config + scenario_files,
             ).merge(ctx.attr._linter[DefaultInfo].default_runfiles),
             executable = test_runner,
         ),
@@ -123,13 +212,103 @@ def _helm_lint_test_impl(ctx):
 
 helm_lint_test = rule(
     implementation = _helm_lint_test_impl,
-    doc = "A rule for performing `helm lint` on a helm package",
+    doc = """\
+A rule for performing `helm lint` on a helm package.
+
+Lint findings are parsed into a JSON report written to `helm_lint_report.json` in the test's \
+undeclared outputs and a JUnit XML report written to `XML_OUTPUT_FILE`. The JUnit report contains \
+a test suite for each chart and a test case for each file with findings.
+""",
     attrs = {
         "chart": attr.label(
             doc = "The helm package to run linting on.",
             mandatory = True,
             providers = [HelmPackageInfo],
         ),
+        "kube_version": attr.string(
+            doc = """\
+                The Kubernetes version (e.g. `1.29`) the `deprecated_apis` policy check targets. When \
+                unset, the newest version allowed by the `kubeVersion` constraint of `Chart.yaml` is \
+                used, falling back to the newest version known to rules_helm. The chart is rendered \
+                for this version so templates depending on `.Capabilities.KubeVersion` are checked as \
+                they would be deployed.
+            """,
+        ),
+        "lint_config": attr.label(
+            doc = """\
+                A YAML or JSON file of lint finding suppressions and severity overrides. E.g.
+
+                ```yaml
+                suppressions:
+                  # Findings matching `message` (a regex) and, optionally, `file` (a glob
+                  # where `**` matches any number of directories) and `rule` do not fail
+                  # the test.
+                  - message: "object name does not conform to Kubernetes naming requirements"
+                    file: "templates/vendor/**"
+                    justification: "Vendored upstream templates."
+                severity_overrides:
+                  # Matching findings are reported with `severity` (INFO, WARNING, or ERROR).
+                  - message: "icon is recommended"
+                    severity: WARNING
+                  # `rule` matches findings from one of the `policy_checks`.
+                  - rule: probes
+                    severity: WARNING
+                ```
+
+                Overrides are applied before suppressions and the first matching entry of each \
+                wins. A `justification` is required for every suppression. Suppressed findings \
+                remain in the lint reports, marked as suppressed.
+            """,
+            allow_single_file = [".yaml", ".yml", ".json"],
+        ),
+        "policy_checks": attr.string_list(
+            doc = """\
+                Checks to run on the objects rendered by `helm template` in addition to `helm lint`. \
+                Violations are reported as errors with the check's name as their `rule`, allowing them \
+                to be suppressed or downgraded with `lint_config`. Possible values:
+
+                | Check | Description |
+                | --- | --- |
+                | `deprecated_apis` | Objects must not use API versions deprecated (a warning) or removed (an error) in `kube_version`. |
+                | `image_digest` | Container images must be pinned by digest. |
+                | `latest_tag` | Container images must not use the `latest` tag, explicitly or implicitly. |
+                | `privileged` | Containers must not set `securityContext.privileged`. |
+                | `probes` | Containers of long running workloads must define liveness and readiness probes. |
+                | `resources` | Containers must set cpu and memory resource requests and limits. |
+            """,
+            default = [],
+        ),
+        "scenarios": attr.label_list(
+            doc = """\
+                `helm_lint_scenario` targets to lint the chart with. The chart is linted once per \
+                scenario, applying the scenario's values after `values` and `substitutions`. The \
+                test fails if any scenario fails and lint reports include the results of each.
+            """,
+            default = [],
+            providers = [HelmLintScenarioInfo],
+        ),
+        "schemas": attr.label_list(
+            doc = """\
+                JSON or YAML schemas to validate the objects rendered by `helm template` against, \
+                entirely offline. Accepted files are Kubernetes OpenAPI documents (e.g. \
+                `api/openapi-spec/swagger.json`), standalone schemas named after the object they \
+                validate as in kubernetes-json-schema (e.g. `deployment-apps-v1.json`), and \
+                CustomResourceDefinitions. CRDs in the chart's `crds` directories and those rendered \
+                by its templates are always used, so charts shipping CRDs have their custom resources \
+                validated even when no schemas are given. Violations, such as misspelled or missing \
+                fields, are reported as errors with the rule `schema`.
+            """,
+            default = [],
+            allow_files = [".json", ".yaml", ".yml"],
+        ),
+        "strict_schemas": attr.bool(
+            doc = """\
+                Whether or not rendered objects without a matching schema are errors. Otherwise \
+                they're reported as informational findings. Only applies when `schemas` is set or \
+                the chart ships CRDs.
+            """,
+            default = False,
+        ),
         "substitutions": attr.string_dict(
             doc = "A dictionary of substitutions passed to `helm lint --set flag.",
             default = {},
@@ -139,6 +318,13 @@ helm_lint_test = rule(
             default = [],
             allow_files = True,
         ),
+        "with_subcharts": attr.bool(
+            doc = """\
+                Whether or not to also lint the subcharts in the chart's `charts` directory \
+                (`helm lint --with-subcharts`). Findings are attributed to the chart they belong to.
+            """,
+            default = False,
+        ),
         "_copier": attr.label(
             cfg = "exec",
             executable = True,
@@ -1,5 +1,6 @@
 """Helm rules"""
 
+load("@bazel_skylib//rules:common_settings.bzl", "BuildSettingInfo")
 load("//helm:providers.bzl", "HelmPackageInfo")
 load("//helm/private:helm_utils.bzl", "is_stamping_enabled")
 load("//helm/private:json_to_yaml.bzl", "json_to_yaml")
@@ -264,6 +265,14 @@ def _helm_package_impl(ctx):
         stamps.extend([ctx.version_file, ctx.info_file])
 
     args.add("-workspace_name", ctx.workspace_name)
+    args.add("-placeholder_syntax", ctx.attr._placeholder_syntax[BuildSettingInfo].value)
+    args.add("-label", str(ctx.label))
+
+    if ctx.attr.build_info_annotations:
+        args.add("-build_info_annotations")
+
+    if ctx.attr.image_helpers:
+        args.add("-image_helpers")
 
     ctx.actions.run(
         executable = ctx.executable._packager,
@@ -302,6 +311,23 @@ helm_package = rule(
     implementation = _helm_package_impl,
     doc = "Rules for creating Helm chart packages.",
     attrs = {
+        "build_info_annotations": attr.bool(
+            doc = """\
+                Whether to add build information annotations to `Chart.yaml`. Annotations already \
+                defined in `Chart.yaml` are never overwritten.
+
+                | annotation | source |
+                | --- | --- |
+                | `org.opencontainers.image.revision` | The `STABLE_GIT_COMMIT` workspace status key. |
+                | `org.opencontainers.image.created` | The `BUILD_TIMESTAMP` workspace status key. |
+                | `rules-helm/builder` | The `BUILD_USER` and `BUILD_HOST` workspace status keys. |
+                | `rules-helm/target` | The label of this target. |
+                | `artifacthub.io/images` | The `images` of this target. |
+
+                Workspace status annotations are only added when stamping is enabled.
+            """,
+            default = False,
+        ),
         "chart": attr.label(
             doc = "The `Chart.yaml` file of the helm chart",
             allow_single_file = True,
@@ -326,6 +352,21 @@ helm_package = rule(
             allow_files = True,
             default = [],
         ),
+        "image_helpers": attr.bool(
+            doc = """\
+                Whether to generate a `templates/_images.tpl` file defining named templates for each of \
+                the `images`. For an image push target `//app:api` the following templates are defined:
+
+                - `bazel.image.api`: The image url, `<repository>@<digest>`.
+                - `bazel.image.api.repository`: The image repository.
+                - `bazel.image.api.digest`: The image digest.
+                - `bazel.image.api.tag`: The image's remote tag, when exactly one is defined.
+
+                This allows templates to `include` pinned image references without exposing them as \
+                overridable values. When enabled, images are no longer required to be referenced in `values`.
+            """,
+            default = False,
+        ),
         "images": attr.label_list(
             doc = """\
                 A list of \
@@ -353,6 +394,12 @@ helm_package = rule(
                 [--[no]stamp](https://docs.bazel.build/versions/main/user-manual.html#flag--stamp) flag.
 
                 Stamped targets are not rebuilt unless their dependencies change.
+
+                Workspace status keys are referenced as `{KEY}` placeholders (see the \
+                `@rules_helm//helm/settings:placeholder_syntax` setting for alternatives). A placeholder may declare \
+                a default used when the key is missing (`{STABLE_GIT_TAG:-0.0.0}`) and a chain of filters \
+                (`{STABLE_GIT_COMMIT|short}`). Supported filters are `short`, `trunc:N`, `lower`, `upper`, \
+                `semver`, `quote` and `sha256`.
             """,
             default = -1,
             values = [1, 0, -1],
@@ -384,6 +431,10 @@ helm_package = rule(
             executable = True,
             default = Label("//helm/private/packager"),
         ),
+        "_placeholder_syntax": attr.label(
+            doc = "The delimiters used for substitution and stamp placeholders.",
+            default = Label("//helm/settings:placeholder_syntax"),
+        ),
         "_stamp_flag": attr.label(
             doc = "A setting used to determine whether or not the `--stamp` flag is enabled",
             default = Label("//helm/private:stamp"),
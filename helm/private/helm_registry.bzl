@@ -2,6 +2,7 @@
 
 load("//helm:providers.bzl", "HelmPackageInfo")
 load(":helm_utils.bzl", "rlocationpath", "symlink")
+load(":images.bzl", "write_image_manifest")
 
 def _get_image_push_commands(ctx, pkg_info):
     image_pushers = []
@@ -46,14 +47,14 @@ def _helm_push_impl(ctx):
         args.add("-push_cmd", ctx.attr.push_cmd)
 
     image_runfiles = ctx.runfiles()
-    if ctx.attr.include_images:
-        image_pushers, image_runfiles = _get_image_push_commands(
+    if ctx.attr.include_images and pkg_info.images:
+        image_manifest = ctx.actions.declare_file("{}.images.json".format(ctx.label.name))
+        image_runfiles = write_image_manifest(
             ctx = ctx,
-            pkg_info = pkg_info,
+            images = pkg_info.images,
+            output = image_manifest,
         )
-
-        if image_pushers:
-            args.add("-image_pushers", ",".join([rlocationpath(p, ctx.workspace_name) for p in image_pushers]))
+        args.add("-image_manifest", rlocationpath(image_manifest, ctx.workspace_name))
 
     args_file = ctx.actions.declare_file("{}.args.txt".format(ctx.label.name))
     ctx.actions.write(
@@ -90,6 +91,22 @@ Before performing `helm push` the executable produced will conditionally perform
 if the following environment variables are defined:
 - `HELM_REGISTRY_USERNAME`: The value of `--username`.
 - `HELM_REGISTRY_PASSWORD`/`HELM_REGISTRY_PASSWORD_FILE`: The value of `--password` or a file containing the `--password` value.
+
+When `include_images` is set, images are pushed concurrently with the output of each pusher prefixed \
+by the label of its image. Images whose digest (and remote tags) already exist in their registry are \
+skipped, and failing pushes are retried with exponential backoff. This can be controlled with the \
+following environment variables:
+- `RULES_HELM_IMAGE_PUSH_JOBS`: The number of images pushed at once. Defaults to `4`.
+- `RULES_HELM_IMAGE_PUSH_ATTEMPTS`: The number of times a push is attempted. Defaults to `3`.
+- `RULES_HELM_IMAGE_PUSH_SKIP_EXISTING`: Set to `0` to push images which already exist.
+
+Registry credentials for checking existing images are read from the docker config \
+(`$DOCKER_CONFIG/config.json` or `~/.docker/config.json`). Credential helpers are not supported, \
+in which case images are pushed without being checked.
+
+To check what the target will do, run it with `bazel run <target> -- --rules-helm-plan` (or set \
+`RULES_HELM_PLAN=1`). The helm commands, the chart and its digest, the registry login host, and \
+the image pushers are printed without executing anything.
 """,
     implementation = _helm_push_impl,
     executable = True,
@@ -20,6 +20,28 @@ def _helm_template_test_impl(ctx):
             content = json.encode_indent(ctx.attr.template_patterns, indent = " " * 4),
         )
 
+    assertions = None
+    if ctx.attr.assertions:
+        assertions = ctx.actions.declare_file("{}.assertions.json".format(ctx.label.name))
+        ctx.actions.write(
+            output = assertions,
+            content = json.encode_indent(ctx.attr.assertions, indent = " " * 4),
+        )
+
+    snapshot_config = None
+    if ctx.file.snapshot:
+        snapshot_config = ctx.actions.declare_file("{}.snapshot.json".format(ctx.label.name))
+        ctx.actions.write(
+            output = snapshot_config,
+            content = json.encode_indent({
+                "masks": ctx.attr.snapshot_masks,
+                "path": ctx.file.snapshot.short_path,
+                "snapshot": rlocationpath(ctx.file.snapshot, ctx.workspace_name),
+            }, indent = " " * 4),
+        )
+    elif ctx.attr.snapshot_masks:
+        fail("`snapshot_masks` requires `snapshot` to be set for {}".format(ctx.label))
+
     args_file = None
     runfiles = ctx.runfiles()
     if ctx.attr.installer:
@@ -80,6 +102,14 @@ def _helm_template_test_impl(ctx):
         runfiles = runfiles.merge(ctx.runfiles(files = [template_patterns]))
         env["RULES_HELM_HELM_TEMPLATE_TEST_PATTERNS"] = rlocationpath(template_patterns, ctx.workspace_name)
 
+    if assertions:
+        runfiles = runfiles.merge(ctx.runfiles(files = [assertions]))
+        env["RULES_HELM_HELM_TEMPLATE_TEST_ASSERTIONS"] = rlocationpath(assertions, ctx.workspace_name)
+
+    if snapshot_config:
+        runfiles = runfiles.merge(ctx.runfiles(files = [snapshot_config, ctx.file.snapshot]))
+        env["RULES_HELM_HELM_TEMPLATE_TEST_SNAPSHOT"] = rlocationpath(snapshot_config, ctx.workspace_name)
+
     return [
         DefaultInfo(
             files = depset([runner_wrapper]),
@@ -89,30 +119,109 @@ def _helm_template_test_impl(ctx):
         RunEnvironmentInfo(
             environment = env,
         ),
+        coverage_common.instrumented_files_info(
+            ctx,
+            dependency_attributes = ["chart", "installer"],
+        ),
     ]
 
 helm_template_test = rule(
-    doc = "A test rule for rendering helm chart templates.",
+    doc = """\
+A test rule for rendering helm chart templates.
+
+When run with `bazel coverage`, the templates of the chart which rendered at least one document \
+are reported as an LCOV tracefile so coverage can be aggregated across every test of a chart. \
+Each template is reported as a single line which is hit once per test that rendered it. A \
+summary of rendered and unrendered templates is also written to the undeclared outputs of \
+every test.
+""",
     implementation = _helm_template_test_impl,
     test = True,
     attrs = {
+        "assertions": attr.string_list_dict(
+            doc = """\
+                A mapping of rendered documents, addressed as in `template_patterns`, to structured \
+                assertions on the objects they define. Paths use yq syntax (e.g. \
+                `.spec.template.spec.containers[0].image`, `.metadata.labels["app.kubernetes.io/name"]`, \
+                or `[*]` for every item) and values are YAML. Supported assertions:
+
+                | Assertion | Description |
+                | --- | --- |
+                | `<path> == <value>` | Every value at the path equals the value. |
+                | `<path> != <value>` | No value at the path equals the value. |
+                | `<path> =~ <regex>` | Every value at the path matches the regex. |
+                | `<path> exists` | The path exists. |
+                | `<path> absent` | The path does not exist. |
+                | `count == <n>` | Exactly `n` documents are addressed. |
+                | `=~ <regex>` | The text of the documents matches the regex. |
+                | `!~ <regex>` | The text of the documents does not match the regex. |
+
+                E.g.
+
+                ```python
+                assertions = {
+                    "Deployment//my-app": [
+                        ".spec.replicas == 3",
+                        ".spec.template.spec.hostNetwork absent",
+                        "!~ :latest",
+                    ],
+                }
+                ```
+
+                Every failing assertion is reported along with the expected and actual values.
+            """,
+        ),
         "chart": attr.label(
             doc = "The helm package to resolve templates for. Mutually exclusive with `installer`.",
-            mandatory = True,
             providers = [HelmPackageInfo],
         ),
         "installer": attr.label(
-            doc = "The `helm_install`/`helm_upgrade` target to resolve templates for. Mutually exclusive with `chart`.",
+            doc = """\
+                The `helm_install`/`helm_upgrade` target to resolve templates for. Mutually exclusive \
+                with `chart`. The command is rendered with `helm template` using the same arguments, \
+                less those which only affect how a release is applied to a cluster (e.g. `--wait`, \
+                `--atomic`, `--timeout`, `--create-namespace`, and `--history-max`).
+            """,
             providers = [HelmInstallInfo],
         ),
+        "snapshot": attr.label(
+            doc = """\
+                A golden file the rendered templates must match. Documents are sorted by template \
+                and object and their keys are sorted so the snapshot is stable. A unified diff is \
+                printed on mismatch. To create or update the snapshot, run the test with \
+                `RULES_HELM_UPDATE_SNAPSHOTS=1 bazel run <target>`. New snapshots must first be \
+                created as empty files.
+            """,
+            allow_single_file = [".yaml", ".yml"],
+        ),
+        "snapshot_masks": attr.string_list(
+            doc = """\
+                Paths, using the syntax of `assertions`, whose values are replaced with `<masked>` \
+                in the snapshot. E.g. `.spec.template.metadata.annotations["checksum/config"]` for \
+                volatile values which would otherwise churn the snapshot.
+            """,
+            default = [],
+        ),
         "template_patterns": attr.string_list_dict(
-            doc = "A mapping of template paths to regex patterns required to match.",
+            doc = """\
+                A mapping of rendered documents to regex patterns required to match them. Documents \
+                are addressed either by the template which rendered them (e.g. \
+                `chart/templates/service.yaml`), in which case patterns are matched against every \
+                document the template rendered, or by the `kind/namespace/name` of the object they \
+                define (e.g. `Deployment/prod/web`). The namespace is empty for objects which do not \
+                set one (e.g. `Service//web`). Template paths take precedence.
+            """,
         ),
         "_copier": attr.label(
             cfg = "exec",
             executable = True,
             default = Label("//helm/private/copier"),
         ),
+        "_lcov_merger": attr.label(
+            default = configuration_field(fragment = "coverage", name = "output_generator"),
+            executable = True,
+            cfg = "exec",
+        ),
         "_runner": attr.label(
             doc = "A process wrapper to use for performing `helm install`.",
             executable = True,
@@ -0,0 +1,132 @@
+"""Helm rules"""
+
+load("//helm:providers.bzl", "HelmPackageInfo")
+load(":helm_utils.bzl", "rlocationpath", "symlink")
+
+def _helm_unittest_test_impl(ctx):
+    toolchain = ctx.toolchains[Label("//helm:toolchain_type")]
+    helm_pkg_info = ctx.attr.chart[HelmPackageInfo]
+
+    args_file = ctx.actions.declare_file(ctx.label.name + ".args.txt")
+    args = ctx.actions.args()
+    args.set_param_file_format("multiline")
+    args.add("-helm", rlocationpath(toolchain.helm, ctx.workspace_name))
+    args.add("-helm_plugins", rlocationpath(toolchain.helm_plugins, ctx.workspace_name))
+    args.add("-chart", rlocationpath(helm_pkg_info.chart, ctx.workspace_name))
+    for suite in ctx.files.srcs:
+        args.add("-suite", rlocationpath(suite, ctx.workspace_name))
+
+    ctx.actions.write(
+        output = args_file,
+        content = args,
+    )
+
+    if toolchain.helm.basename.endswith(".exe"):
+        test_runner = ctx.actions.declare_file(ctx.label.name + ".exe")
+    else:
+        test_runner = ctx.actions.declare_file(ctx.label.name)
+
+    symlink(
+        ctx = ctx,
+        output = test_runner,
+        target_file = ctx.executable._unittester,
+        is_executable = True,
+    )
+
+    runfiles = ctx.runfiles(
+        files = [toolchain.helm, toolchain.helm_plugins, helm_pkg_info.chart, args_file] + ctx.files.srcs + ctx.files.data,
+    ).merge(ctx.attr._unittester[DefaultInfo].default_runfiles)
+
+    return [
+        DefaultInfo(
+            files = depset([test_runner]),
+            runfiles = runfiles,
+            executable = test_runner,
+        ),
+        testing.TestEnvironment({
+            "RULES_HELM_HELM_UNITTEST_TEST_ARGS_PATH": rlocationpath(args_file, ctx.workspace_name),
+        }),
+        coverage_common.instrumented_files_info(
+            ctx,
+            dependency_attributes = ["chart"],
+        ),
+    ]
+
+helm_unittest_test = rule(
+    implementation = _helm_unittest_test_impl,
+    doc = """\
+A rule for running [helm-unittest](https://github.com/helm-unittest/helm-unittest) suites against a helm package.
+
+Suites are executed hermetically with `helm template`, without requiring the helm-unittest plugin. \
+Each test case is reported in the JUnit XML report written to `XML_OUTPUT_FILE`.
+
+```python
+load("@rules_helm//helm:defs.bzl", "helm_chart", "helm_unittest_test")
+
+helm_chart(
+    name = "my_chart",
+)
+
+helm_unittest_test(
+    name = "my_chart_unittest",
+    chart = ":my_chart",
+    srcs = glob(["tests/*_test.yaml"]),
+    data = glob(["tests/values/*.yaml"]),
+)
+```
+
+The following subset of the suite format is supported:
+
+- Suite and test case `templates` (or `template`), `set`, `values`, `release` (`name`, \
+`namespace`, `upgrade`), and `capabilities` (`majorVersion`, `minorVersion`, `apiVersions`), \
+along with test case `documentIndex`, `documentSelector`, and `skip`.
+- The asserts `equal`, `notEqual`, `matchRegex`, `notMatchRegex`, `contains`, `notContains`, \
+`isNull`, `isNotNull`, `isEmpty`, `isNotEmpty`, `exists`, `notExists`, `isSubset`, \
+`isNotSubset`, `lengthEqual`, `isKind`, `isAPIVersion`, `hasDocuments`, and `failedTemplate`, \
+each of which may set `not`, `template`, `documentIndex`, and `documentSelector`.
+
+Unlike helm-unittest, the default release name is `release-name` as `helm template` requires \
+lowercase release names. Values in `set` keep their YAML types.
+
+Templates which rendered at least one document in any test case are reported as with \
+`helm_template_test`: as an LCOV tracefile under `bazel coverage` and as a summary in the \
+undeclared outputs of the test.
+""",
+    attrs = {
+        "chart": attr.label(
+            doc = "The helm package to test.",
+            mandatory = True,
+            providers = [HelmPackageInfo],
+        ),
+        "data": attr.label_list(
+            doc = "Additional files required by the suites, such as values files referenced by `values`.",
+            allow_files = True,
+            default = [],
+        ),
+        "srcs": attr.label_list(
+            doc = "helm-unittest suite files, typically `tests/*_test.yaml`.",
+            allow_files = [".yaml", ".yml"],
+            mandatory = True,
+        ),
+        "_copier": attr.label(
+            cfg = "exec",
+            executable = True,
+            default = Label("//helm/private/copier"),
+        ),
+        "_lcov_merger": attr.label(
+            default = configuration_field(fragment = "coverage", name = "output_generator"),
+            executable = True,
+            cfg = "exec",
+        ),
+        "_unittester": attr.label(
+            doc = "A process wrapper for running the suites.",
+            cfg = "exec",
+            executable = True,
+            default = Label("//helm/private/unittester"),
+        ),
+    },
+    toolchains = [
+        str(Label("//helm:toolchain_type")),
+    ],
+    test = True,
+)
@@ -0,0 +1,209 @@
+package helm_utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isRenderedTemplate reports whether an entry of a chart archive is a template helm
+// renders into documents. Partials (`_helpers.tpl`) and `NOTES.txt` never produce any.
+func isRenderedTemplate(name string) bool {
+	parts := strings.Split(path.Clean(name), "/")
+
+	// Templates are found at `<chart>/templates/...` and, for unpacked subcharts,
+	// `<chart>/charts/<subchart>/templates/...`.
+	templatesDir := -1
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] == "templates" && (i == 1 || (i >= 3 && parts[i-2] == "charts")) {
+			templatesDir = i
+			break
+		}
+		if i%2 == 1 && parts[i] != "charts" {
+			return false
+		}
+	}
+	if templatesDir < 0 {
+		return false
+	}
+
+	base := parts[len(parts)-1]
+	return !strings.HasPrefix(base, "_") && base != "NOTES.txt"
+}
+
+// ChartTemplates lists the templates of a packaged chart which can render documents.
+//
+// Parameters:
+//   - chartPath: The path to a chart archive produced by `helm package`.
+//
+// Returns:
+//   - []string: The sorted templates, named as in the `# Source:` comments of `helm template`.
+//   - error: An error if the archive could not be read.
+func ChartTemplates(chartPath string) ([]string, error) {
+	file, err := os.Open(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening chart %s: %w", chartPath, err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error decompressing chart %s: %w", chartPath, err)
+	}
+	defer gzipReader.Close()
+
+	var templates []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading chart %s: %w", chartPath, err)
+		}
+		if header.Typeflag == tar.TypeReg && isRenderedTemplate(header.Name) {
+			templates = append(templates, path.Clean(header.Name))
+		}
+	}
+
+	sort.Strings(templates)
+	return templates, nil
+}
+
+// TemplateCoverage counts how many rendering scenarios produced documents from each
+// template of a chart.
+type TemplateCoverage struct {
+	// Chart is the name of the chart, used to name coverage files.
+	Chart string
+
+	// Hits maps each template to the number of scenarios in which it rendered a document.
+	Hits map[string]int
+}
+
+// NewTemplateCoverage creates coverage for the templates of a packaged chart.
+//
+// Parameters:
+//   - chartPath: The path to a chart archive produced by `helm package`.
+//
+// Returns:
+//   - *TemplateCoverage: Coverage in which no template has rendered yet.
+//   - error: An error if the templates of the chart could not be listed.
+func NewTemplateCoverage(chartPath string) (*TemplateCoverage, error) {
+	templates, err := ChartTemplates(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := &TemplateCoverage{
+		Chart: strings.TrimSuffix(filepath.Base(chartPath), ".tgz"),
+		Hits:  map[string]int{},
+	}
+	for _, template := range templates {
+		coverage.Hits[template] = 0
+	}
+	return coverage, nil
+}
+
+// Record counts the templates which produced documents in a single scenario.
+//
+// Parameters:
+//   - manifests: All documents rendered by the scenario.
+func (c *TemplateCoverage) Record(manifests []Manifest) {
+	rendered := map[string]bool{}
+	for _, manifest := range manifests {
+		if manifest.Source != "" {
+			rendered[manifest.Source] = true
+		}
+	}
+	for source := range rendered {
+		c.Hits[source]++
+	}
+}
+
+// templates returns the covered templates in order.
+func (c *TemplateCoverage) templates() []string {
+	var templates []string
+	for template := range c.Hits {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	return templates
+}
+
+// LCOV renders the coverage as an LCOV tracefile. Each template is a source file with a
+// single line which is hit once per scenario that rendered it.
+//
+// Returns:
+//   - string: The tracefile.
+func (c *TemplateCoverage) LCOV() string {
+	var builder strings.Builder
+	for _, template := range c.templates() {
+		hits := c.Hits[template]
+		covered := 0
+		if hits > 0 {
+			covered = 1
+		}
+		fmt.Fprintf(&builder, "SF:%s\nDA:1,%d\nLH:%d\nLF:1\nend_of_record\n", template, hits, covered)
+	}
+	return builder.String()
+}
+
+// Report renders a summary of the templates which were and were never rendered.
+//
+// Returns:
+//   - string: The report.
+func (c *TemplateCoverage) Report() string {
+	var rendered, unrendered []string
+	for _, template := range c.templates() {
+		if c.Hits[template] > 0 {
+			rendered = append(rendered, template)
+		} else {
+			unrendered = append(unrendered, template)
+		}
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Template coverage for %s: %d of %d templates rendered\n", c.Chart, len(rendered), len(rendered)+len(unrendered))
+	for _, template := range rendered {
+		fmt.Fprintf(&builder, "  rendered:     %s (%d)\n", template, c.Hits[template])
+	}
+	for _, template := range unrendered {
+		fmt.Fprintf(&builder, "  not rendered: %s\n", template)
+	}
+	return builder.String()
+}
+
+// WriteTemplateCoverage writes the coverage of a test. When run with `bazel coverage`
+// an LCOV tracefile is written to `COVERAGE_DIR` to be merged into the coverage report
+// of the test, and a summary is always written to `TEST_UNDECLARED_OUTPUTS_DIR`.
+//
+// Parameters:
+//   - coverage: The coverage to write.
+//
+// Returns:
+//   - error: An error if a coverage file could not be written.
+func WriteTemplateCoverage(coverage *TemplateCoverage) error {
+	if coverageDir, found := os.LookupEnv("COVERAGE_DIR"); found && coverageDir != "" {
+		// The coverage output generator merges tracefiles with a `.dat` extension.
+		tracefile := filepath.Join(coverageDir, coverage.Chart+".template_coverage.dat")
+		if err := os.WriteFile(tracefile, []byte(coverage.LCOV()), 0644); err != nil {
+			return fmt.Errorf("Error writing template coverage %s: %w", tracefile, err)
+		}
+	}
+
+	if outputsDir, found := os.LookupEnv("TEST_UNDECLARED_OUTPUTS_DIR"); found && outputsDir != "" {
+		report := filepath.Join(outputsDir, coverage.Chart+".template_coverage.txt")
+		if err := os.WriteFile(report, []byte(coverage.Report()), 0644); err != nil {
+			return fmt.Errorf("Error writing template coverage %s: %w", report, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package helm_utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeChartArchive(t *testing.T, path string, names []string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		content := []byte("content\n")
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsRenderedTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"chart/templates/deployment.yaml":               true,
+		"chart/templates/nested/configmap.yaml":         true,
+		"chart/templates/_helpers.tpl":                  false,
+		"chart/templates/NOTES.txt":                     false,
+		"chart/charts/sub/templates/service.yaml":       true,
+		"chart/charts/sub/templates/_helpers.tpl":       false,
+		"chart/charts/sub/charts/leaf/templates/a.yaml": true,
+		"chart/Chart.yaml":                              false,
+		"chart/values.yaml":                             false,
+		"chart/files/templates/config.yaml":             false,
+		"chart/crds/templates/crd.yaml":                 false,
+		"chart/charts/sub-0.1.0.tgz":                    false,
+		"chart/charts/sub/files/templates/config.yaml":  false,
+	}
+
+	for name, expected := range tests {
+		if actual := isRenderedTemplate(name); actual != expected {
+			t.Errorf("isRenderedTemplate(%q) = %v, expected %v", name, actual, expected)
+		}
+	}
+}
+
+func TestTemplateCoverage(t *testing.T) {
+	chartPath := filepath.Join(t.TempDir(), "mychart.tgz")
+	writeChartArchive(t, chartPath, []string{
+		"mychart/Chart.yaml",
+		"mychart/values.yaml",
+		"mychart/templates/_helpers.tpl",
+		"mychart/templates/NOTES.txt",
+		"mychart/templates/service.yaml",
+		"mychart/templates/deployment.yaml",
+		"mychart/templates/ingress.yaml",
+	})
+
+	coverage, err := NewTemplateCoverage(chartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coverage.Record([]Manifest{
+		{Source: "mychart/templates/deployment.yaml"},
+		{Source: "mychart/templates/service.yaml"},
+		{Source: "mychart/templates/service.yaml", Index: 1},
+	})
+	coverage.Record([]Manifest{
+		{Source: "mychart/templates/deployment.yaml"},
+	})
+
+	expectedHits := map[string]int{
+		"mychart/templates/deployment.yaml": 2,
+		"mychart/templates/ingress.yaml":    0,
+		"mychart/templates/service.yaml":    1,
+	}
+	if !reflect.DeepEqual(coverage.Hits, expectedHits) {
+		t.Errorf("Unexpected hits: %v", coverage.Hits)
+	}
+
+	expectedLCOV := `SF:mychart/templates/deployment.yaml
+DA:1,2
+LH:1
+LF:1
+end_of_record
+SF:mychart/templates/ingress.yaml
+DA:1,0
+LH:0
+LF:1
+end_of_record
+SF:mychart/templates/service.yaml
+DA:1,1
+LH:1
+LF:1
+end_of_record
+`
+	if lcov := coverage.LCOV(); lcov != expectedLCOV {
+		t.Errorf("Unexpected LCOV:\n%s", lcov)
+	}
+
+	expectedReport := `Template coverage for mychart: 2 of 3 templates rendered
+  rendered:     mychart/templates/deployment.yaml (2)
+  rendered:     mychart/templates/service.yaml (1)
+  not rendered: mychart/templates/ingress.yaml
+`
+	if report := coverage.Report(); report != expectedReport {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+}
+
+func TestWriteTemplateCoverage(t *testing.T) {
+	coverageDir := t.TempDir()
+	outputsDir := t.TempDir()
+	t.Setenv("COVERAGE_DIR", coverageDir)
+	t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outputsDir)
+
+	coverage := &TemplateCoverage{
+		Chart: "mychart",
+		Hits:  map[string]int{"mychart/templates/service.yaml": 1},
+	}
+	if err := WriteTemplateCoverage(coverage); err != nil {
+		t.Fatal(err)
+	}
+
+	tracefile, err := os.ReadFile(filepath.Join(coverageDir, "mychart.template_coverage.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tracefile) != coverage.LCOV() {
+		t.Errorf("Unexpected tracefile:\n%s", tracefile)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputsDir, "mychart.template_coverage.txt")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,250 @@
+package helm_utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffLine is a line of a diff, prefixed by ' ' when unchanged, '-' when removed, or '+' when added.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// maxDiffLines bounds the number of differing lines, after removing any common prefix and
+// suffix, which are diffed. Diffing is quadratic in the worst case so larger inputs are
+// only summarized.
+const maxDiffLines = 20000
+
+// diffLines computes a minimal line diff using the linear space variant of Myers' algorithm.
+func diffLines(from []string, to []string) []diffLine {
+	var lines []diffLine
+	diffRange(from, to, &lines)
+	return lines
+}
+
+// commonAffixes returns the lengths of the common prefix and suffix of two slices.
+func commonAffixes(from []string, to []string) (int, int) {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+// diffRange appends the diff of two slices to lines, splitting the problem at the middle
+// snake of an optimal path so only linear space is needed.
+func diffRange(from []string, to []string, lines *[]diffLine) {
+	prefix, suffix := commonAffixes(from, to)
+	for _, line := range from[:prefix] {
+		*lines = append(*lines, diffLine{kind: ' ', text: line})
+	}
+
+	common := from[len(from)-suffix:]
+	from, to = from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+	if len(from) == 0 || len(to) == 0 {
+		for _, line := range from {
+			*lines = append(*lines, diffLine{kind: '-', text: line})
+		}
+		for _, line := range to {
+			*lines = append(*lines, diffLine{kind: '+', text: line})
+		}
+	} else if x, y, found := middleSnake(from, to); found {
+		diffRange(from[:x], to[:y], lines)
+		diffRange(from[x:], to[y:], lines)
+	} else {
+		for _, line := range from {
+			*lines = append(*lines, diffLine{kind: '-', text: line})
+		}
+		for _, line := range to {
+			*lines = append(*lines, diffLine{kind: '+', text: line})
+		}
+	}
+
+	for _, line := range common {
+		*lines = append(*lines, diffLine{kind: ' ', text: line})
+	}
+}
+
+// middleSnake searches forwards and backwards at once for the point where the furthest
+// reaching paths overlap, which lies on an optimal path. Only the current step of each
+// search is kept. Both slices must be non-empty and differ in their first and last lines.
+func middleSnake(from []string, to []string) (int, int, bool) {
+	n, m := len(from), len(to)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	delta := n - m
+	// The paths can only overlap while searching forwards if delta is odd.
+	front := delta%2 != 0
+
+	// Diagonals which have left the edit graph are no longer searched.
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + forwardStart; k <= d-forwardEnd; k += 2 {
+			index := offset + k
+			var x int
+			if k == -d || (k != d && forward[index-1] < forward[index+1]) {
+				x = forward[index+1]
+			} else {
+				x = forward[index-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && from[x] == to[y] {
+				x++
+				y++
+			}
+			forward[index] = x
+
+			if x > n {
+				forwardEnd += 2
+			} else if y > m {
+				forwardStart += 2
+			} else if front {
+				other := offset + delta - k
+				if other >= 0 && other < len(backward) && backward[other] != -1 && x >= n-backward[other] {
+					return x, y, true
+				}
+			}
+		}
+
+		for k := -d + backwardStart; k <= d-backwardEnd; k += 2 {
+			index := offset + k
+			var x int
+			if k == -d || (k != d && backward[index-1] < backward[index+1]) {
+				x = backward[index+1]
+			} else {
+				x = backward[index-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && from[n-x-1] == to[m-y-1] {
+				x++
+				y++
+			}
+			backward[index] = x
+
+			if x > n {
+				backwardEnd += 2
+			} else if y > m {
+				backwardStart += 2
+			} else if !front {
+				other := offset + delta - k
+				if other >= 0 && other < len(forward) && forward[other] != -1 {
+					forwardX := forward[other]
+					if forwardX >= n-x {
+						return forwardX, offset + forwardX - other, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// hunkRange renders the line range of one side of a hunk.
+func hunkRange(before int, count int) string {
+	start := before + 1
+	if count == 0 {
+		start = before
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// UnifiedDiff renders the differences between two texts as a unified diff.
+//
+// Parameters:
+//   - fromName: The name of the original text, shown in the `---` header.
+//   - toName: The name of the new text, shown in the `+++` header.
+//   - from: The original text.
+//   - to: The new text.
+//   - context: The number of unchanged lines to show around each change.
+//
+// Returns:
+//   - string: The diff or an empty string if the texts are equal.
+func UnifiedDiff(fromName string, toName string, from string, to string, context int) string {
+	if from == to {
+		return ""
+	}
+
+	fromLines, toLines := splitLines(from), splitLines(to)
+	prefix, suffix := commonAffixes(fromLines, toLines)
+	fromChanged, toChanged := len(fromLines)-prefix-suffix, len(toLines)-prefix-suffix
+	if fromChanged > 0 && toChanged > 0 && fromChanged+toChanged > maxDiffLines {
+		return fmt.Sprintf("--- %s\n+++ %s\n@@ -%s +%s @@\n(%d lines differ from %d lines, which is too large to diff)\n",
+			fromName, toName, hunkRange(prefix, fromChanged), hunkRange(prefix, toChanged), fromChanged, toChanged)
+	}
+
+	lines := diffLines(fromLines, toLines)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk until the gap to the next change exceeds twice the context.
+		start := max(0, i-context)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				if j-end > 2*context {
+					break
+				}
+				end = j
+			}
+		}
+		end = min(len(lines), end+context+1)
+
+		fromBefore, toBefore := 0, 0
+		for _, line := range lines[:start] {
+			if line.kind != '+' {
+				fromBefore++
+			}
+			if line.kind != '-' {
+				toBefore++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.kind != '+' {
+				fromCount++
+			}
+			if line.kind != '-' {
+				toCount++
+			}
+		}
+
+		fmt.Fprintf(&builder, "@@ -%s +%s @@\n", hunkRange(fromBefore, fromCount), hunkRange(toBefore, toCount))
+		for _, line := range lines[start:end] {
+			fmt.Fprintf(&builder, "%c%s\n", line.kind, line.text)
+		}
+
+		i = end
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,129 @@
+package helm_utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := strings.Join([]string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}, "\n") + "\n"
+	to := strings.Join([]string{"a", "B", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}, "\n") + "\n"
+
+	expected := `--- golden
++++ rendered
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+
+	if diff := UnifiedDiff("golden", "rendered", from, to, 3); diff != expected {
+		t.Errorf("Unexpected diff:\n%s\nExpected:\n%s", diff, expected)
+	}
+
+	if diff := UnifiedDiff("golden", "rendered", from, from, 3); diff != "" {
+		t.Errorf("Expected no diff for equal texts, got:\n%s", diff)
+	}
+}
+
+func TestUnifiedDiffEmpty(t *testing.T) {
+	expected := `--- golden
++++ rendered
+@@ -0,0 +1,2 @@
++a
++b
+`
+
+	if diff := UnifiedDiff("golden", "rendered", "", "a\nb\n", 3); diff != expected {
+		t.Errorf("Unexpected diff:\n%s\nExpected:\n%s", diff, expected)
+	}
+}
+
+// lcsLength is the length of the longest common subsequence, computed naively.
+func lcsLength(from []string, to []string) int {
+	lengths := make([][]int, len(from)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	// A small linear congruential generator keeps the inputs deterministic.
+	seed := uint32(1)
+	next := func() string {
+		seed = seed*1103515245 + 12345
+		return string(rune('a' + (seed>>16)%4))
+	}
+
+	for run := 0; run < 200; run++ {
+		var from, to []string
+		for i := 0; i < run%23; i++ {
+			from = append(from, next())
+		}
+		for i := 0; i < run%17; i++ {
+			to = append(to, next())
+		}
+
+		var fromLines, toLines []string
+		edits := 0
+		for _, line := range diffLines(from, to) {
+			switch line.kind {
+			case ' ':
+				fromLines = append(fromLines, line.text)
+				toLines = append(toLines, line.text)
+			case '-':
+				fromLines = append(fromLines, line.text)
+				edits++
+			case '+':
+				toLines = append(toLines, line.text)
+				edits++
+			}
+		}
+
+		if strings.Join(fromLines, "") != strings.Join(from, "") || strings.Join(toLines, "") != strings.Join(to, "") {
+			t.Fatalf("Diff of %v and %v does not reproduce the inputs", from, to)
+		}
+		if expected := len(from) + len(to) - 2*lcsLength(from, to); edits != expected {
+			t.Errorf("Diff of %v and %v has %d edits, expected %d", from, to, edits, expected)
+		}
+	}
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	var from, to strings.Builder
+	from.WriteString("header\n")
+	to.WriteString("header\n")
+	for i := 0; i < maxDiffLines; i++ {
+		fmt.Fprintf(&from, "a%d\n", i)
+		fmt.Fprintf(&to, "b%d\n", i)
+	}
+
+	expected := fmt.Sprintf(`--- golden
++++ rendered
+@@ -2,%d +2,%d @@
+(%d lines differ from %d lines, which is too large to diff)
+`, maxDiffLines, maxDiffLines, maxDiffLines, maxDiffLines)
+
+	if diff := UnifiedDiff("golden", "rendered", from.String(), to.String(), 3); diff != expected {
+		t.Errorf("Unexpected diff:\n%s\nExpected:\n%s", diff, expected)
+	}
+}
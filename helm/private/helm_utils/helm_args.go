@@ -0,0 +1,374 @@
+package helm_utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Global helm flags which consume the following argument as their value.
+var globalValueFlags = map[string]bool{
+	"--burst-limit":          true,
+	"--kube-apiserver":       true,
+	"--kube-as-group":        true,
+	"--kube-as-user":         true,
+	"--kube-ca-file":         true,
+	"--kube-context":         true,
+	"--kube-tls-server-name": true,
+	"--kube-token":           true,
+	"--kubeconfig":           true,
+	"--namespace":            true,
+	"-n":                     true,
+	"--qps":                  true,
+	"--registry-config":      true,
+	"--repository-cache":     true,
+	"--repository-config":    true,
+}
+
+// Flags of `helm install` and `helm upgrade` which only affect how a release is applied
+// to a cluster and have no bearing on the rendered manifests. The value indicates
+// whether or not the flag consumes the following argument.
+var installOnlyFlags = map[string]bool{
+	"--atomic":                  false,
+	"--cleanup-on-fail":         false,
+	"--create-namespace":        false,
+	"--dry-run":                 false,
+	"--force":                   false,
+	"--history-max":             true,
+	"--install":                 false,
+	"-i":                        false,
+	"--reset-then-reuse-values": false,
+	"--reset-values":            false,
+	"--reuse-values":            false,
+	"--timeout":                 true,
+	"--wait":                    false,
+	"--wait-for-jobs":           false,
+}
+
+// flagName returns the name of a flag argument, without any `=value` suffix.
+func flagName(arg string) (string, bool) {
+	name, _, hasValue := strings.Cut(arg, "=")
+	return name, hasValue
+}
+
+// FindHelmSubcommand locates the subcommand within a list of helm arguments, skipping
+// any global flags (and their values) which precede it.
+//
+// Parameters:
+//   - args: The arguments passed to helm.
+//
+// Returns:
+//   - int: The index of the subcommand or -1 if there is none.
+//   - string: The subcommand.
+func FindHelmSubcommand(args []string) (int, string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return i, arg
+		}
+		if name, hasValue := flagName(arg); globalValueFlags[name] && !hasValue {
+			i++
+		}
+	}
+	return -1, ""
+}
+
+// ConvertToTemplateArgs rewrites the arguments of a `helm install` or `helm upgrade`
+// command into those of an equivalent `helm template` command. Flags which only
+// affect how a release is applied to a cluster are dropped while all others,
+// such as values, are kept so the rendered manifests match those installed.
+//
+// Parameters:
+//   - args: The arguments passed to helm.
+//
+// Returns:
+//   - []string: The arguments for `helm template`.
+//   - error: An error if the arguments are not for `helm install` or `helm upgrade`.
+func ConvertToTemplateArgs(args []string) ([]string, error) {
+	index, subcommand := FindHelmSubcommand(args)
+	switch subcommand {
+	case "template":
+		return args, nil
+	case "install", "upgrade":
+	default:
+		return nil, fmt.Errorf("Error converting helm arguments to `helm template`, unsupported subcommand `%s`", subcommand)
+	}
+
+	converted := append([]string{}, args[:index]...)
+	converted = append(converted, "template")
+
+	for i := index + 1; i < len(args); i++ {
+		arg := args[i]
+		name, hasValue := flagName(arg)
+		takesValue, installOnly := installOnlyFlags[name]
+		if !installOnly {
+			converted = append(converted, arg)
+			continue
+		}
+		if takesValue && !hasValue {
+			// Skip the flag's value as well.
+			i++
+		}
+	}
+
+	return converted, nil
+}
+
+// Flags of `helm install`, `helm upgrade`, and `helm template` which consume the following
+// argument as their value.
+var renderValueFlags = map[string]bool{
+	"--api-versions":       true,
+	"-a":                   true,
+	"--ca-file":            true,
+	"--cert-file":          true,
+	"--description":        true,
+	"--history-max":        true,
+	"--key-file":           true,
+	"--keyring":            true,
+	"--kube-version":       true,
+	"--labels":             true,
+	"-l":                   true,
+	"--name-template":      true,
+	"--output":             true,
+	"-o":                   true,
+	"--output-dir":         true,
+	"--password":           true,
+	"--post-renderer":      true,
+	"--post-renderer-args": true,
+	"--repo":               true,
+	"--set":                true,
+	"--set-file":           true,
+	"--set-json":           true,
+	"--set-literal":        true,
+	"--set-string":         true,
+	"--show-only":          true,
+	"-s":                   true,
+	"--timeout":            true,
+	"--username":           true,
+	"--values":             true,
+	"-f":                   true,
+	"--version":            true,
+}
+
+// Flags of each supported subcommand which consume the following argument as their value.
+var subcommandValueFlags = map[string]map[string]bool{
+	"install":   renderValueFlags,
+	"upgrade":   renderValueFlags,
+	"template":  renderValueFlags,
+	"uninstall": {"--cascade": true, "--description": true, "--timeout": true},
+	"rollback":  {"--history-max": true, "--timeout": true},
+	"status":    {"--output": true, "-o": true, "--revision": true},
+	"history":   {"--max": true, "--output": true, "-o": true},
+	"test":      {"--filter": true, "--timeout": true},
+}
+
+// HelmCommand is a helm command line parsed into its parts. Parsing is lenient: arguments
+// which cannot be attributed, e.g. the value of a flag unknown to rules_helm, leave the
+// release and chart unset while the original arguments are always preserved.
+type HelmCommand struct {
+	// Subcommand is the helm subcommand, e.g. `upgrade`.
+	Subcommand string
+
+	// Release is the name of the release, if known.
+	Release string
+
+	// Chart is the chart of `install`, `upgrade`, and `template`, if known.
+	Chart string
+
+	// Revision is the revision of `rollback`, if any.
+	Revision string
+
+	// ValuesFiles are the values files passed with `--values` or `-f`, in order.
+	ValuesFiles []string
+
+	// GlobalFlags are the flags preceding the subcommand, including their values.
+	GlobalFlags []string
+
+	// Flags are the flags following the subcommand, including their values.
+	Flags []string
+
+	// args are the original arguments.
+	args []string
+
+	// positionals are the indexes of the positional arguments of the subcommand within args.
+	positionals []int
+
+	// chartIndex is the index of the chart within args, or -1.
+	chartIndex int
+}
+
+// ParseHelmCommand parses the arguments of a helm command. The release and chart are
+// determined for the `install`, `upgrade`, `template`, `uninstall`, `rollback`, `status`,
+// `history`, and `test` subcommands when their positional arguments are as expected.
+//
+// Parameters:
+//   - args: The arguments passed to helm.
+//
+// Returns:
+//   - HelmCommand: The parsed command.
+func ParseHelmCommand(args []string) HelmCommand {
+	command := HelmCommand{args: append([]string{}, args...), chartIndex: -1}
+
+	index, subcommand := FindHelmSubcommand(args)
+	if index < 0 {
+		return command
+	}
+	command.Subcommand = subcommand
+	command.GlobalFlags = append([]string{}, args[:index]...)
+	valueFlags := subcommandValueFlags[subcommand]
+
+	for i := index + 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for i++; i < len(args); i++ {
+				command.positionals = append(command.positionals, i)
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			command.positionals = append(command.positionals, i)
+			continue
+		}
+
+		command.Flags = append(command.Flags, arg)
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue && (valueFlags[name] || globalValueFlags[name]) && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+			command.Flags = append(command.Flags, value)
+		}
+		if hasValue && (name == "--values" || name == "-f") {
+			command.ValuesFiles = append(command.ValuesFiles, strings.Split(value, ",")...)
+		}
+	}
+
+	command.assignPositionals()
+	return command
+}
+
+// assignPositionals assigns the positional arguments to the release, chart, and revision
+// of the subcommand. Nothing is assigned if they don't match what the subcommand expects.
+func (c *HelmCommand) assignPositionals() {
+	indexes := c.positionals
+	values := make([]string, len(indexes))
+	for i, index := range indexes {
+		values[i] = c.args[index]
+	}
+
+	switch c.Subcommand {
+	case "install", "template":
+		// The release name is omitted with `--generate-name` or by `helm template`.
+		if len(values) == 1 {
+			c.Chart, c.chartIndex = values[0], indexes[0]
+		} else if len(values) == 2 {
+			c.Release = values[0]
+			c.Chart, c.chartIndex = values[1], indexes[1]
+		}
+	case "upgrade":
+		if len(values) == 2 {
+			c.Release = values[0]
+			c.Chart, c.chartIndex = values[1], indexes[1]
+		}
+	case "uninstall":
+		// Several releases may be uninstalled at once.
+		if len(values) >= 1 {
+			c.Release = values[0]
+		}
+	case "rollback":
+		if len(values) == 1 || len(values) == 2 {
+			c.Release = values[0]
+			if len(values) == 2 {
+				c.Revision = values[1]
+			}
+		}
+	case "status", "history", "test":
+		if len(values) == 1 {
+			c.Release = values[0]
+		}
+	}
+}
+
+// RequiresChart reports whether the subcommand operates on a chart.
+func (c HelmCommand) RequiresChart() bool {
+	switch c.Subcommand {
+	case "install", "upgrade", "template":
+		return true
+	}
+	return false
+}
+
+// ReplaceChart replaces the chart, leaving every other argument untouched. If the chart
+// could not be determined, the only positional argument equal to chart is replaced instead.
+//
+// Parameters:
+//   - chart: The chart to replace.
+//   - replacement: The new chart.
+//
+// Returns:
+//   - bool: Whether the chart was replaced.
+func (c *HelmCommand) ReplaceChart(chart string, replacement string) bool {
+	index := c.chartIndex
+	if index < 0 || c.args[index] != chart {
+		index = -1
+		for _, positional := range c.positionals {
+			if c.args[positional] != chart {
+				continue
+			}
+			if index >= 0 {
+				// The chart is ambiguous.
+				return false
+			}
+			index = positional
+		}
+	}
+	if index < 0 {
+		return false
+	}
+
+	c.args[index] = replacement
+	if index == c.chartIndex {
+		c.Chart = replacement
+	}
+	return true
+}
+
+// flagValue returns the value of the last occurrence of a flag within parsed flags.
+func flagValue(flags []string, valueFlags map[string]bool, names []string) (string, bool) {
+	value, found := "", false
+	for i := 0; i < len(flags); i++ {
+		name, current, hasValue := strings.Cut(flags[i], "=")
+		if !hasValue && (valueFlags[name] || globalValueFlags[name]) && i+1 < len(flags) {
+			i++
+			current, hasValue = flags[i], true
+		}
+		if hasValue && slices.Contains(names, name) {
+			value, found = current, true
+		}
+	}
+	return value, found
+}
+
+// FlagValue returns the value of the last occurrence of a flag, whether it precedes or
+// follows the subcommand. Values of other flags and positional arguments are never matched.
+//
+// Parameters:
+//   - names: The names of the flag, e.g. `--namespace` and `-n`.
+//
+// Returns:
+//   - string: The value of the flag.
+//   - bool: Whether the flag was set.
+func (c HelmCommand) FlagValue(names ...string) (string, bool) {
+	value, found := flagValue(c.GlobalFlags, nil, names)
+	if subcommandValue, subcommandFound := flagValue(c.Flags, subcommandValueFlags[c.Subcommand], names); subcommandFound {
+		value, found = subcommandValue, true
+	}
+	return value, found
+}
+
+// Args renders the command back into helm arguments.
+//
+// Returns:
+//   - []string: The arguments passed to helm.
+func (c HelmCommand) Args() []string {
+	return append([]string{}, c.args...)
+}
@@ -0,0 +1,196 @@
+package helm_utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindHelmSubcommand(t *testing.T) {
+	tests := []struct {
+		args       []string
+		index      int
+		subcommand string
+	}{
+		{[]string{"install", "release", "chart.tgz"}, 0, "install"},
+		{[]string{"--kube-context", "upgrade", "upgrade", "release"}, 2, "upgrade"},
+		{[]string{"--debug", "-n", "install", "--kubeconfig=config", "uninstall", "release"}, 4, "uninstall"},
+		{[]string{"--debug"}, -1, ""},
+	}
+
+	for _, test := range tests {
+		index, subcommand := FindHelmSubcommand(test.args)
+		if index != test.index || subcommand != test.subcommand {
+			t.Errorf("FindHelmSubcommand(%v) = (%d, %s), expected (%d, %s)", test.args, index, subcommand, test.index, test.subcommand)
+		}
+	}
+}
+
+func TestConvertToTemplateArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			args:     []string{"install", "--wait", "--timeout", "5m", "--create-namespace", "release", "chart.tgz"},
+			expected: []string{"template", "release", "chart.tgz"},
+		},
+		{
+			args: []string{
+				"--kube-context", "install", "upgrade", "-i", "--atomic", "--timeout=10m", "--history-max", "3",
+				"--namespace", "ns", "--values", "values.yaml", "--set", "image.tag=1.0", "--wait-for-jobs=true",
+				"--reuse-values", "release", "chart.tgz",
+			},
+			expected: []string{
+				"--kube-context", "install", "template",
+				"--namespace", "ns", "--values", "values.yaml", "--set", "image.tag=1.0",
+				"release", "chart.tgz",
+			},
+		},
+		{
+			args:     []string{"template", "--wait", "chart.tgz"},
+			expected: []string{"template", "--wait", "chart.tgz"},
+		},
+	}
+
+	for _, test := range tests {
+		converted, err := ConvertToTemplateArgs(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(converted, test.expected) {
+			t.Errorf("ConvertToTemplateArgs(%v) = %v, expected %v", test.args, converted, test.expected)
+		}
+	}
+
+	if _, err := ConvertToTemplateArgs([]string{"uninstall", "release"}); err == nil {
+		t.Error("Expected an error converting `helm uninstall`")
+	}
+}
+
+func TestParseHelmCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected HelmCommand
+	}{
+		{
+			args: []string{
+				"--kube-context", "prod", "upgrade", "--install", "--timeout", "5m", "-f", "a.yaml,b.yaml",
+				"--values=c.yaml", "--set", "path=chart.tgz", "web", "chart.tgz",
+			},
+			expected: HelmCommand{
+				Subcommand:  "upgrade",
+				Release:     "web",
+				Chart:       "chart.tgz",
+				ValuesFiles: []string{"a.yaml", "b.yaml", "c.yaml"},
+				GlobalFlags: []string{"--kube-context", "prod"},
+				Flags:       []string{"--install", "--timeout", "5m", "-f", "a.yaml,b.yaml", "--values=c.yaml", "--set", "path=chart.tgz"},
+			},
+		},
+		{
+			args:     []string{"install", "--generate-name", "chart.tgz"},
+			expected: HelmCommand{Subcommand: "install", Chart: "chart.tgz", Flags: []string{"--generate-name"}},
+		},
+		{
+			args:     []string{"uninstall", "-n", "apps", "web", "worker"},
+			expected: HelmCommand{Subcommand: "uninstall", Release: "web", Flags: []string{"-n", "apps"}},
+		},
+		{
+			args:     []string{"rollback", "web", "3", "--wait"},
+			expected: HelmCommand{Subcommand: "rollback", Release: "web", Revision: "3", Flags: []string{"--wait"}},
+		},
+		{
+			args:     []string{"status", "web", "--revision", "2"},
+			expected: HelmCommand{Subcommand: "status", Release: "web", Flags: []string{"--revision", "2"}},
+		},
+		{
+			args:     []string{"history", "--max", "5", "web"},
+			expected: HelmCommand{Subcommand: "history", Release: "web", Flags: []string{"--max", "5"}},
+		},
+		{
+			args:     []string{"test", "web", "--logs"},
+			expected: HelmCommand{Subcommand: "test", Release: "web", Flags: []string{"--logs"}},
+		},
+		{
+			// The value of an unknown flag is indistinguishable from a positional argument.
+			args:     []string{"upgrade", "--from-plugin", "value", "web", "chart.tgz"},
+			expected: HelmCommand{Subcommand: "upgrade", Flags: []string{"--from-plugin"}},
+		},
+		{
+			args:     []string{"lint", "chart.tgz"},
+			expected: HelmCommand{Subcommand: "lint"},
+		},
+	}
+
+	for _, test := range tests {
+		command := ParseHelmCommand(test.args)
+		if !reflect.DeepEqual(command.Args(), test.args) {
+			t.Errorf("Args() = %v, expected %v", command.Args(), test.args)
+		}
+
+		// Only compare the parsed parts.
+		command.args, command.positionals, command.chartIndex = nil, nil, 0
+		if test.expected.GlobalFlags == nil {
+			test.expected.GlobalFlags = []string{}
+		}
+		if !reflect.DeepEqual(command, test.expected) {
+			t.Errorf("ParseHelmCommand(%v) = %+v, expected %+v", test.args, command, test.expected)
+		}
+	}
+
+	if command := ParseHelmCommand([]string{"--debug"}); command.Subcommand != "" || len(command.Args()) != 1 {
+		t.Errorf("Unexpected command without a subcommand: %+v", command)
+	}
+}
+
+func TestHelmCommandReplaceChart(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "parsed",
+			args:     []string{"upgrade", "--set", "source=pkg/chart.tgz", "web", "pkg/chart.tgz"},
+			expected: []string{"upgrade", "--set", "source=pkg/chart.tgz", "web", "/runfiles/pkg/chart.tgz"},
+		},
+		{
+			name:     "unknown flag",
+			args:     []string{"upgrade", "--from-plugin", "value", "web", "pkg/chart.tgz"},
+			expected: []string{"upgrade", "--from-plugin", "value", "web", "/runfiles/pkg/chart.tgz"},
+		},
+		{
+			name:     "unknown subcommand",
+			args:     []string{"diff", "upgrade", "web", "pkg/chart.tgz"},
+			expected: []string{"diff", "upgrade", "web", "/runfiles/pkg/chart.tgz"},
+		},
+		{
+			name:     "ambiguous",
+			args:     []string{"upgrade", "--from-plugin", "pkg/chart.tgz", "web", "pkg/chart.tgz"},
+			expected: []string{"upgrade", "--from-plugin", "pkg/chart.tgz", "web", "pkg/chart.tgz"},
+		},
+		{
+			name:     "no chart",
+			args:     []string{"uninstall", "web"},
+			expected: []string{"uninstall", "web"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command := ParseHelmCommand(test.args)
+			replaced := command.ReplaceChart("pkg/chart.tgz", "/runfiles/pkg/chart.tgz")
+			if !reflect.DeepEqual(command.Args(), test.expected) {
+				t.Errorf("Unexpected arguments: %v", command.Args())
+			}
+			if replaced != !reflect.DeepEqual(test.args, test.expected) {
+				t.Errorf("Unexpected result of ReplaceChart: %v", replaced)
+			}
+		})
+	}
+
+	command := ParseHelmCommand([]string{"upgrade", "web", "pkg/chart.tgz"})
+	command.ReplaceChart("pkg/chart.tgz", "/runfiles/pkg/chart.tgz")
+	if command.Chart != "/runfiles/pkg/chart.tgz" || !command.RequiresChart() {
+		t.Errorf("Unexpected command: %+v", command)
+	}
+}
@@ -178,3 +178,16 @@ func GetRunfile(runfile_path string) string {
 
 	return runfile
 }
+
+// RunfilesEnv returns the environment variables which allow subprocesses to locate the
+// runfiles of the current process.
+//
+// Returns:
+//   - []string: The environment variables, or none if runfiles could not be found.
+func RunfilesEnv() []string {
+	runfiles, err := runfiles.New()
+	if err != nil {
+		return nil
+	}
+	return runfiles.Env()
+}
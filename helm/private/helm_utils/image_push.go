@@ -0,0 +1,193 @@
+package helm_utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PushOptions controls how images are pushed.
+type PushOptions struct {
+	// Jobs is the maximum number of images pushed at once.
+	Jobs int
+
+	// Attempts is the number of times a failing push is attempted.
+	Attempts int
+
+	// Backoff is the delay before the first retry, doubled for each further retry.
+	Backoff time.Duration
+
+	// SkipExisting skips images which already exist in their repository.
+	SkipExisting bool
+
+	// Output receives the output of every pusher, prefixed by the label of its image.
+	Output io.Writer
+
+	// registry is used to check for existing images.
+	registry registryClient
+}
+
+// envInt reads a positive integer from the environment.
+func envInt(key string, fallback int) (int, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("`%s` must be a positive integer, got `%s`", key, value)
+	}
+	return number, nil
+}
+
+// PushOptionsFromEnv returns the options for pushing images, which may be configured with
+// the following environment variables:
+//   - `RULES_HELM_IMAGE_PUSH_JOBS`: The number of images pushed at once. Defaults to 4.
+//   - `RULES_HELM_IMAGE_PUSH_ATTEMPTS`: The number of times a push is attempted. Defaults to 3.
+//   - `RULES_HELM_IMAGE_PUSH_SKIP_EXISTING`: Set to `0` to push images which already exist.
+//
+// Returns:
+//   - PushOptions: The options.
+//   - error: An error if an environment variable is invalid.
+func PushOptionsFromEnv() (PushOptions, error) {
+	options := PushOptions{
+		Backoff:      2 * time.Second,
+		SkipExisting: os.Getenv("RULES_HELM_IMAGE_PUSH_SKIP_EXISTING") != "0",
+		Output:       os.Stderr,
+		registry:     registryClient{client: &http.Client{Timeout: 30 * time.Second}},
+	}
+
+	var err error
+	if options.Jobs, err = envInt("RULES_HELM_IMAGE_PUSH_JOBS", 4); err != nil {
+		return options, err
+	}
+	if options.Attempts, err = envInt("RULES_HELM_IMAGE_PUSH_ATTEMPTS", 3); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// PrefixWriter writes complete lines to a shared writer, prefixing each one. Writers
+// sharing an output must share a lock so their lines are not interleaved.
+type PrefixWriter struct {
+	prefix string
+	output io.Writer
+	lock   *sync.Mutex
+	buffer bytes.Buffer
+}
+
+// NewPrefixWriter creates a writer prefixing lines with `[prefix] `.
+//
+// Parameters:
+//   - prefix: The prefix of each line, e.g. the label of a target.
+//   - output: The shared writer.
+//   - lock: The lock guarding output.
+//
+// Returns:
+//   - *PrefixWriter: The writer, which must be flushed once done.
+func NewPrefixWriter(prefix string, output io.Writer, lock *sync.Mutex) *PrefixWriter {
+	return &PrefixWriter{prefix: prefix, output: output, lock: lock}
+}
+
+func (w *PrefixWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	for {
+		line, err := w.buffer.ReadBytes('\n')
+		if err != nil {
+			// Keep the incomplete line until the rest of it is written.
+			w.buffer.Write(line)
+			break
+		}
+		w.writeLine(line)
+	}
+	return len(data), nil
+}
+
+// Flush writes any incomplete line.
+func (w *PrefixWriter) Flush() {
+	if w.buffer.Len() > 0 {
+		w.writeLine(append(w.buffer.Bytes(), '\n'))
+		w.buffer.Reset()
+	}
+}
+
+func (w *PrefixWriter) writeLine(line []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	fmt.Fprintf(w.output, "[%s] %s", w.prefix, line)
+}
+
+// pushImage runs a single pusher, retrying failures with exponential backoff.
+func pushImage(pusher ImagePusher, options PushOptions, lock *sync.Mutex) error {
+	label := pusher.Label
+	if label == "" {
+		label = pusher.Pusher
+	}
+	output := NewPrefixWriter(label, options.Output, lock)
+	defer output.Flush()
+
+	if options.SkipExisting {
+		pushed, err := options.registry.isPushed(pusher)
+		if err != nil {
+			fmt.Fprintf(output, "Unable to check for an existing image, pushing: %s\n", err)
+		} else if pushed {
+			fmt.Fprintf(output, "Image already exists in the registry, skipping push\n")
+			return nil
+		}
+	}
+
+	attempts := max(options.Attempts, 1)
+	backoff := options.Backoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		cmd := exec.Command(pusher.Pusher)
+		cmd.Stdout = output
+		cmd.Stderr = output
+
+		if err = cmd.Run(); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			fmt.Fprintf(output, "Push attempt %d of %d failed, retrying in %s: %s\n", attempt, attempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("Failed to run image pusher for %s: %w", label, err)
+}
+
+// PushImages runs image pushers concurrently. Every pusher is run to completion even
+// when others fail.
+//
+// Parameters:
+//   - pushers: The image pushers to run.
+//   - options: Controls concurrency, retries, and skipping images which already exist.
+//
+// Returns:
+//   - error: The errors of every pusher which failed.
+func PushImages(pushers []ImagePusher, options PushOptions) error {
+	errs := make([]error, len(pushers))
+	slots := make(chan struct{}, max(options.Jobs, 1))
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+
+	for i, pusher := range pushers {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			errs[i] = pushImage(pusher, options, &lock)
+		}()
+	}
+	wait.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,180 @@
+package helm_utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeScript writes an executable shell script.
+func writeScript(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// syncBuffer is a buffer which may be written to concurrently.
+type syncBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buffer.Write(data)
+}
+
+func sortedLines(text string) []string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer := NewPrefixWriter("//app:push", &output, &sync.Mutex{})
+
+	writer.Write([]byte("first\nsec"))
+	writer.Write([]byte("ond\nthird"))
+	writer.Flush()
+
+	expected := "[//app:push] first\n[//app:push] second\n[//app:push] third\n"
+	if output.String() != expected {
+		t.Errorf("Unexpected output:\n%s", output.String())
+	}
+}
+
+func TestPushImages(t *testing.T) {
+	dir := t.TempDir()
+	var output syncBuffer
+
+	pushers := []ImagePusher{
+		{Label: "//app:a", Pusher: writeScript(t, dir, "a.sh", "echo pushed a\n")},
+		{Label: "//app:b", Pusher: writeScript(t, dir, "b.sh", "echo pushed b >&2\n")},
+		{Label: "//app:c", Pusher: writeScript(t, dir, "c.sh", "printf 'pushed c'\n")},
+	}
+
+	err := PushImages(pushers, PushOptions{Jobs: 2, Attempts: 1, Output: &output})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"[//app:a] pushed a",
+		"[//app:b] pushed b",
+		"[//app:c] pushed c",
+	}
+	if lines := sortedLines(output.buffer.String()); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected output:\n%s", output.buffer.String())
+	}
+}
+
+func TestPushImagesRetries(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "attempts")
+	var output syncBuffer
+
+	// Fails on the first attempt only.
+	flaky := writeScript(t, dir, "flaky.sh", `
+echo attempt >> "`+counter+`"
+if [ "$(wc -l < "`+counter+`")" -lt 2 ]; then
+  echo transient failure
+  exit 1
+fi
+echo pushed
+`)
+	failing := writeScript(t, dir, "failing.sh", "exit 1\n")
+
+	err := PushImages([]ImagePusher{{Label: "//app:flaky", Pusher: flaky}}, PushOptions{Jobs: 1, Attempts: 3, Output: &output})
+	if err != nil {
+		t.Fatalf("Expected the flaky pusher to succeed on retry: %s", err)
+	}
+	if !strings.Contains(output.buffer.String(), "[//app:flaky] Push attempt 1 of 3 failed") {
+		t.Errorf("Expected the retry to be logged:\n%s", output.buffer.String())
+	}
+	if !strings.Contains(output.buffer.String(), "[//app:flaky] pushed") {
+		t.Errorf("Expected the retry to succeed:\n%s", output.buffer.String())
+	}
+
+	err = PushImages([]ImagePusher{
+		{Label: "//app:failing", Pusher: failing},
+		{Label: "//app:flaky", Pusher: flaky},
+	}, PushOptions{Jobs: 2, Attempts: 2, Output: &output})
+	if err == nil {
+		t.Fatal("Expected the failing pusher to fail")
+	}
+	if !strings.Contains(err.Error(), "//app:failing") || strings.Contains(err.Error(), "//app:flaky") {
+		t.Errorf("Expected only the failing pusher to be reported: %s", err)
+	}
+}
+
+func TestPushImagesSkipsExisting(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	server := fakeRegistry(t, map[string]string{"sha256:abc": "sha256:abc"})
+	dir := t.TempDir()
+	var output syncBuffer
+
+	existing := writePusherFiles(t, "sha256:abc", "")
+	existing.Pusher = writeScript(t, dir, "existing.sh", "echo pushed existing\n")
+
+	missing := writePusherFiles(t, "sha256:new", "")
+	missing.Label = "//app:new"
+	missing.Pusher = writeScript(t, dir, "missing.sh", "echo pushed new\n")
+
+	err := PushImages([]ImagePusher{existing, missing}, PushOptions{
+		Jobs:         2,
+		Attempts:     1,
+		SkipExisting: true,
+		Output:       &output,
+		registry:     registryClient{client: server.Client(), baseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"[//app:new] pushed new",
+		"[//app:push] Image already exists in the registry, skipping push",
+	}
+	if lines := sortedLines(output.buffer.String()); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected output:\n%s", output.buffer.String())
+	}
+}
+
+func TestPushOptionsFromEnv(t *testing.T) {
+	t.Setenv("RULES_HELM_IMAGE_PUSH_JOBS", "8")
+	t.Setenv("RULES_HELM_IMAGE_PUSH_ATTEMPTS", "")
+	t.Setenv("RULES_HELM_IMAGE_PUSH_SKIP_EXISTING", "0")
+
+	options, err := PushOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Jobs != 8 || options.Attempts != 3 || options.SkipExisting {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+
+	t.Setenv("RULES_HELM_IMAGE_PUSH_SKIP_EXISTING", "")
+	if options, err := PushOptionsFromEnv(); err != nil || !options.SkipExisting {
+		t.Errorf("Expected existing images to be skipped by default: %+v, %v", options, err)
+	}
+
+	t.Setenv("RULES_HELM_IMAGE_PUSH_JOBS", "0")
+	if _, err := PushOptionsFromEnv(); err == nil {
+		t.Error("Expected an error for a non-positive number of jobs")
+	}
+}
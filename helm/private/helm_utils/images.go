@@ -0,0 +1,377 @@
+package helm_utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImagePusher is an executable which pushes an image to a registry, along with the
+// information needed to tell whether the image has already been pushed.
+type ImagePusher struct {
+	// Label is the label of the push target, used to prefix its output.
+	Label string `json:"label"`
+
+	// Pusher is the push executable.
+	Pusher string `json:"pusher"`
+
+	// Repository is a file containing the repository the image is pushed to.
+	Repository string `json:"repository"`
+
+	// OciLayout is the OCI layout directory of a rules_oci image.
+	OciLayout string `json:"oci_layout"`
+
+	// ManifestFile is the manifest of a rules_img image.
+	ManifestFile string `json:"manifest_file"`
+
+	// RemoteTags is a file containing the tags applied to the image, one per line.
+	RemoteTags string `json:"remote_tags"`
+}
+
+// LoadImagePushers reads a manifest of image pushers, resolving each of their files
+// from runfiles.
+//
+// Parameters:
+//   - manifestPath: The path to a JSON encoded list of image pushers.
+//
+// Returns:
+//   - []ImagePusher: The image pushers.
+//   - error: An error if the manifest could not be read.
+func LoadImagePushers(manifestPath string) ([]ImagePusher, error) {
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading image manifest %s: %w", manifestPath, err)
+	}
+
+	var pushers []ImagePusher
+	if err := json.Unmarshal(content, &pushers); err != nil {
+		return nil, fmt.Errorf("Error parsing image manifest %s: %w", manifestPath, err)
+	}
+
+	for i := range pushers {
+		for _, path := range []*string{
+			&pushers[i].Pusher,
+			&pushers[i].Repository,
+			&pushers[i].OciLayout,
+			&pushers[i].ManifestFile,
+			&pushers[i].RemoteTags,
+		} {
+			if *path != "" {
+				*path = GetRunfile(*path)
+			}
+		}
+	}
+
+	return pushers, nil
+}
+
+// ImageDigest determines the digest of an image built by rules_oci or rules_img.
+//
+// Parameters:
+//   - ociLayoutDir: The OCI layout directory of a rules_oci image, or an empty string.
+//   - manifestFile: The manifest of a rules_img image, or an empty string.
+//
+// Returns:
+//   - string: The digest of the image, e.g. `sha256:...`.
+//   - error: An error if the digest could not be determined.
+func ImageDigest(ociLayoutDir string, manifestFile string) (string, error) {
+	if (ociLayoutDir == "") == (manifestFile == "") {
+		return "", fmt.Errorf("Exactly one of an OCI layout or a manifest file is required to determine an image digest")
+	}
+
+	if ociLayoutDir != "" {
+		indexPath := filepath.Join(ociLayoutDir, "index.json")
+		content, err := os.ReadFile(indexPath)
+		if err != nil {
+			return "", fmt.Errorf("Error reading file %s: %w", indexPath, err)
+		}
+
+		var index struct {
+			Manifests []struct {
+				Digest string `json:"digest"`
+			} `json:"manifests"`
+		}
+		if err := json.Unmarshal(content, &index); err != nil {
+			return "", fmt.Errorf("Error unmarshalling file %s: %w", indexPath, err)
+		}
+		if len(index.Manifests) == 0 {
+			return "", fmt.Errorf("The image index %s has no manifests", indexPath)
+		}
+		return index.Manifests[0].Digest, nil
+	}
+
+	// The digest of a rules_img image is that of the manifest itself.
+	content, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return "", fmt.Errorf("Error reading manifest file %s: %w", manifestFile, err)
+	}
+	if !json.Valid(content) {
+		return "", fmt.Errorf("The manifest file %s is not valid JSON", manifestFile)
+	}
+	hash := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(hash[:]), nil
+}
+
+// parseRepository splits a repository (e.g. `gcr.io/project/image`) into the host of its
+// registry and the name of the repository within it, following the conventions of docker.
+func parseRepository(repository string) (string, string) {
+	repository = strings.TrimPrefix(strings.TrimPrefix(repository, "https://"), "http://")
+	repository = strings.TrimSpace(repository)
+
+	host, name, found := strings.Cut(repository, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		host, name = "docker.io", repository
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	return host, name
+}
+
+// registryScheme returns the scheme used to reach a registry. Local registries are
+// assumed to be served over plain HTTP.
+func registryScheme(host string) string {
+	hostname := host
+	if parsed, err := url.Parse("//" + host); err == nil {
+		hostname = parsed.Hostname()
+	}
+	if hostname == "localhost" || hostname == "127.0.0.1" || hostname == "::1" {
+		return "http"
+	}
+	return "https"
+}
+
+// manifestAccept lists the manifest media types accepted when querying a registry.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// registryClient queries registries for existing manifests.
+type registryClient struct {
+	client *http.Client
+
+	// baseURL overrides the scheme and host of registries, for testing.
+	baseURL string
+}
+
+// registryCredentials returns the `user:password` docker has stored for a registry, if any.
+// Credential helpers are not supported.
+func registryCredentials(host string) string {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	content, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return ""
+	}
+
+	keys := []string{host, "https://" + host, "http://" + host}
+	if host == "registry-1.docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/", "docker.io")
+	}
+	for _, key := range keys {
+		if auth, found := config.Auths[key]; found && auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return ""
+}
+
+// parseChallenge parses the parameters of a `WWW-Authenticate` header.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(header, " ")
+	params := map[string]string{}
+	for _, param := range strings.Split(rest, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found {
+			params[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return strings.ToLower(scheme), params
+}
+
+// token requests a bearer token to pull from a repository.
+func (c registryClient) token(params map[string]string, name string, credentials string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("Invalid token realm `%s`", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", name))
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user, password, found := strings.Cut(credentials, ":"); found {
+		request.SetBasicAuth(user, password)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token request to %s failed: %s", realm.Host, response.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("Error parsing token response: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// manifestDigest queries the digest of a manifest in a repository.
+//
+// Returns the digest reported by the registry, or an empty string when the manifest
+// does not exist.
+func (c registryClient) manifestDigest(repository string, reference string) (string, error) {
+	host, name := parseRepository(repository)
+	base := c.baseURL
+	if base == "" {
+		base = fmt.Sprintf("%s://%s", registryScheme(host), host)
+	}
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", base, name, reference)
+
+	head := func(authorization string) (*http.Response, error) {
+		request, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Accept", manifestAccept)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := c.client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		response.Body.Close()
+		return response, nil
+	}
+
+	response, err := head("")
+	if err != nil {
+		return "", err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		credentials := registryCredentials(host)
+		scheme, params := parseChallenge(response.Header.Get("WWW-Authenticate"))
+		switch scheme {
+		case "bearer":
+			token, err := c.token(params, name, credentials)
+			if err != nil {
+				return "", err
+			}
+			response, err = head("Bearer " + token)
+		case "basic":
+			if credentials == "" {
+				return "", fmt.Errorf("No credentials found for %s", host)
+			}
+			response, err = head("Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)))
+		default:
+			return "", fmt.Errorf("Unsupported authentication challenge from %s", host)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		digest := response.Header.Get("Docker-Content-Digest")
+		if digest == "" && strings.HasPrefix(reference, "sha256:") {
+			digest = reference
+		}
+		return digest, nil
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("Unexpected response from %s: %s", host, response.Status)
+	}
+}
+
+// isPushed reports whether the image of a pusher already exists in its repository and
+// every remote tag already refers to it, in which case pushing it would change nothing.
+func (c registryClient) isPushed(pusher ImagePusher) (bool, error) {
+	if pusher.Repository == "" || (pusher.OciLayout == "" && pusher.ManifestFile == "") {
+		return false, nil
+	}
+
+	repository, err := os.ReadFile(pusher.Repository)
+	if err != nil {
+		return false, fmt.Errorf("Error reading file %s: %w", pusher.Repository, err)
+	}
+	digest, err := ImageDigest(pusher.OciLayout, pusher.ManifestFile)
+	if err != nil {
+		return false, err
+	}
+
+	references := []string{digest}
+	if pusher.RemoteTags != "" {
+		content, err := os.ReadFile(pusher.RemoteTags)
+		if err != nil {
+			return false, fmt.Errorf("Error reading file %s: %w", pusher.RemoteTags, err)
+		}
+		for _, tag := range strings.Split(string(content), "\n") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				references = append(references, tag)
+			}
+		}
+	}
+
+	for _, reference := range references {
+		existing, err := c.manifestDigest(string(repository), reference)
+		if err != nil {
+			return false, err
+		}
+		if existing != digest {
+			return false, nil
+		}
+	}
+	return true, nil
+}
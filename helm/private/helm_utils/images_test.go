@@ -0,0 +1,234 @@
+package helm_utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		host       string
+		name       string
+	}{
+		{"gcr.io/project/image", "gcr.io", "project/image"},
+		{"localhost:5000/image", "localhost:5000", "image"},
+		{"localhost/image", "localhost", "image"},
+		{"https://my.registry.io/team/app", "my.registry.io", "team/app"},
+		{"nginx", "registry-1.docker.io", "library/nginx"},
+		{"bitnami/nginx", "registry-1.docker.io", "bitnami/nginx"},
+		{"docker.io/nginx", "registry-1.docker.io", "library/nginx"},
+	}
+
+	for _, test := range tests {
+		host, name := parseRepository(test.repository)
+		if host != test.host || name != test.name {
+			t.Errorf("parseRepository(%q) = (%q, %q), expected (%q, %q)", test.repository, host, name, test.host, test.name)
+		}
+	}
+}
+
+func TestRegistryScheme(t *testing.T) {
+	tests := map[string]string{
+		"localhost:5000":  "http",
+		"127.0.0.1:5000":  "http",
+		"gcr.io":          "https",
+		"my.registry.io":  "https",
+		"registry:5000":   "https",
+		"[::1]:5000":      "http",
+		"localhost.corp":  "https",
+		"my.localhost:80": "https",
+	}
+
+	for host, expected := range tests {
+		if scheme := registryScheme(host); scheme != expected {
+			t.Errorf("registryScheme(%q) = %q, expected %q", host, scheme, expected)
+		}
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	dir := t.TempDir()
+
+	layout := filepath.Join(dir, "layout")
+	if err := os.Mkdir(layout, 0755); err != nil {
+		t.Fatal(err)
+	}
+	index := `{"schemaVersion": 2, "manifests": [{"digest": "sha256:abc", "size": 1}]}`
+	if err := os.WriteFile(filepath.Join(layout, "index.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := ImageDigest(layout, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "sha256:abc" {
+		t.Errorf("Unexpected digest from OCI layout: %s", digest)
+	}
+
+	manifest := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifest, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err = ImageDigest("", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Errorf("Unexpected digest from manifest: %s", digest)
+	}
+
+	if _, err := ImageDigest("", ""); err == nil {
+		t.Error("Expected an error without an image")
+	}
+}
+
+// fakeRegistry serves manifests, requiring a bearer token as most registries do.
+func fakeRegistry(t *testing.T, manifests map[string]string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				t.Errorf("Unexpected token scope: %s", r.URL.Query().Get("scope"))
+			}
+			w.Write([]byte(`{"token": "secret"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodHead {
+			t.Errorf("Unexpected method: %s", r.Method)
+		}
+
+		reference, found := strings.CutPrefix(r.URL.Path, "/v2/team/app/manifests/")
+		digest, exists := manifests[reference]
+		if !found || !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestManifestDigest(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	server := fakeRegistry(t, map[string]string{
+		"sha256:abc": "sha256:abc",
+		"latest":     "sha256:def",
+	})
+	client := registryClient{client: server.Client(), baseURL: server.URL}
+
+	digest, err := client.manifestDigest("my.registry.io/team/app", "sha256:abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "sha256:abc" {
+		t.Errorf("Unexpected digest: %s", digest)
+	}
+
+	digest, err = client.manifestDigest("my.registry.io/team/app", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "sha256:def" {
+		t.Errorf("Unexpected digest for tag: %s", digest)
+	}
+
+	digest, err = client.manifestDigest("my.registry.io/team/app", "sha256:missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "" {
+		t.Errorf("Expected no digest for a missing manifest, got %s", digest)
+	}
+}
+
+// writePusherFiles writes the files describing an image pushed to `my.registry.io/team/app`.
+func writePusherFiles(t *testing.T, digest string, tags string) ImagePusher {
+	t.Helper()
+	dir := t.TempDir()
+
+	pusher := ImagePusher{
+		Label:      "//app:push",
+		Repository: filepath.Join(dir, "repository.txt"),
+		OciLayout:  filepath.Join(dir, "layout"),
+	}
+	if err := os.WriteFile(pusher.Repository, []byte("my.registry.io/team/app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(pusher.OciLayout, 0755); err != nil {
+		t.Fatal(err)
+	}
+	index := `{"manifests": [{"digest": "` + digest + `"}]}`
+	if err := os.WriteFile(filepath.Join(pusher.OciLayout, "index.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if tags != "" {
+		pusher.RemoteTags = filepath.Join(dir, "tags.txt")
+		if err := os.WriteFile(pusher.RemoteTags, []byte(tags), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return pusher
+}
+
+func TestIsPushed(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	server := fakeRegistry(t, map[string]string{
+		"sha256:abc": "sha256:abc",
+		"sha256:def": "sha256:def",
+		"v1":         "sha256:abc",
+		"latest":     "sha256:def",
+	})
+	client := registryClient{client: server.Client(), baseURL: server.URL}
+
+	tests := []struct {
+		name     string
+		digest   string
+		tags     string
+		expected bool
+	}{
+		{"existing digest", "sha256:abc", "", true},
+		{"existing digest and tag", "sha256:abc", "v1\n", true},
+		{"tag of another digest", "sha256:abc", "v1\nlatest\n", false},
+		{"missing tag", "sha256:abc", "v2\n", false},
+		{"missing digest", "sha256:new", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pushed, err := client.isPushed(writePusherFiles(t, test.digest, test.tags))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pushed != test.expected {
+				t.Errorf("isPushed = %v, expected %v", pushed, test.expected)
+			}
+		})
+	}
+
+	pushed, err := client.isPushed(ImagePusher{Pusher: "push"})
+	if err != nil || pushed {
+		t.Errorf("Pushers without image information must always push, got (%v, %v)", pushed, err)
+	}
+}
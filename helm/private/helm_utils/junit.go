@@ -0,0 +1,123 @@
+package helm_utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// JUnitFailure describes why a test case failed.
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Content string `xml:",chardata"`
+}
+
+// JUnitSkipped marks a test case as skipped.
+type JUnitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// JUnitTestCase is a single `<testcase>` element.
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// JUnitTestSuite is a single `<testsuite>` element. The counters are derived
+// from TestCases by WriteJUnitReport.
+type JUnitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestSuites is the root `<testsuites>` element of a JUnit XML report.
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+// summarize updates the counters of all suites from their test cases.
+func (s *JUnitTestSuites) summarize() {
+	s.Tests, s.Failures, s.Errors, s.Skipped, s.Time = 0, 0, 0, 0, 0
+	for i := range s.Suites {
+		suite := &s.Suites[i]
+		suite.Tests, suite.Failures, suite.Skipped, suite.Time = len(suite.TestCases), 0, 0, 0
+		for _, testCase := range suite.TestCases {
+			if testCase.Failure != nil {
+				suite.Failures++
+			}
+			if testCase.Skipped != nil {
+				suite.Skipped++
+			}
+			suite.Time += testCase.Time
+		}
+
+		s.Tests += suite.Tests
+		s.Failures += suite.Failures
+		s.Errors += suite.Errors
+		s.Skipped += suite.Skipped
+		s.Time += suite.Time
+	}
+}
+
+// MarshalJUnitReport renders a JUnit XML report.
+//
+// Parameters:
+//   - report: The test suites to render. Counters are computed from the test cases.
+//
+// Returns:
+//   - []byte: The XML document, including the XML header.
+//   - error: An error if the report could not be encoded.
+func MarshalJUnitReport(report JUnitTestSuites) ([]byte, error) {
+	report.summarize()
+
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding JUnit report: %w", err)
+	}
+
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+// WriteJUnitReport writes a JUnit XML report to path, creating parent directories
+// as needed. Under `bazel test` the path is typically `XML_OUTPUT_FILE`.
+//
+// Parameters:
+//   - path: The location to write the report to.
+//   - report: The test suites to render.
+//
+// Returns:
+//   - error: An error if the report could not be encoded or written.
+func WriteJUnitReport(path string, report JUnitTestSuites) error {
+	content, err := MarshalJUnitReport(report)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("Error writing JUnit report %s: %w", path, err)
+	}
+
+	return nil
+}
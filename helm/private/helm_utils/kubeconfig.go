@@ -0,0 +1,160 @@
+package helm_utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KubeTarget is the cluster a helm command operates on.
+type KubeTarget struct {
+	// Kubeconfig is the kubeconfig files which were read, separated as in `KUBECONFIG`.
+	Kubeconfig string
+
+	// Context is the name of the kube context.
+	Context string
+
+	// Cluster is the name of the cluster of the context.
+	Cluster string
+
+	// Server is the API server of the cluster.
+	Server string
+
+	// Namespace is the namespace the release is in.
+	Namespace string
+}
+
+// kubeconfig is the subset of a kubeconfig file needed to resolve a context.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server string `yaml:"server"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+}
+
+// kubeconfigPaths returns the kubeconfig files helm would read.
+func kubeconfigPaths(command HelmCommand) []string {
+	if path, found := command.FlagValue("--kubeconfig"); found {
+		return []string{path}
+	}
+	if paths := os.Getenv("KUBECONFIG"); paths != "" {
+		var result []string
+		for _, path := range filepath.SplitList(paths) {
+			if path != "" {
+				result = append(result, path)
+			}
+		}
+		return result
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, ".kube", "config")}
+}
+
+// ResolveKubeTarget determines the kube context and namespace a helm command would use
+// from its `--kubeconfig`, `--kube-context`, and `--namespace` flags, the `HELM_KUBECONTEXT`,
+// `HELM_NAMESPACE`, and `KUBECONFIG` environment variables, and the kubeconfig itself.
+//
+// Parameters:
+//   - command: The parsed helm command.
+//
+// Returns:
+//   - KubeTarget: The context and namespace. Fields which could not be determined are empty.
+//   - error: An error if a kubeconfig file exists but could not be parsed.
+func ResolveKubeTarget(command HelmCommand) (KubeTarget, error) {
+	paths := kubeconfigPaths(command)
+	target := KubeTarget{Kubeconfig: strings.Join(paths, string(os.PathListSeparator))}
+
+	// Like kubectl, the first file to set a value takes precedence when merging.
+	var config kubeconfig
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return target, fmt.Errorf("Error reading kubeconfig %s: %w", path, err)
+		}
+
+		var current kubeconfig
+		if err := yaml.Unmarshal(content, &current); err != nil {
+			return target, fmt.Errorf("Error parsing kubeconfig %s: %w", path, err)
+		}
+		if config.CurrentContext == "" {
+			config.CurrentContext = current.CurrentContext
+		}
+		config.Contexts = append(config.Contexts, current.Contexts...)
+		config.Clusters = append(config.Clusters, current.Clusters...)
+	}
+
+	target.Context = config.CurrentContext
+	if context := os.Getenv("HELM_KUBECONTEXT"); context != "" {
+		target.Context = context
+	}
+	if context, found := command.FlagValue("--kube-context"); found {
+		target.Context = context
+	}
+
+	for _, context := range config.Contexts {
+		if context.Name == target.Context {
+			target.Cluster = context.Context.Cluster
+			target.Namespace = context.Context.Namespace
+			break
+		}
+	}
+	for _, cluster := range config.Clusters {
+		if cluster.Name == target.Cluster {
+			target.Server = cluster.Cluster.Server
+			break
+		}
+	}
+
+	if namespace := os.Getenv("HELM_NAMESPACE"); namespace != "" {
+		target.Namespace = namespace
+	}
+	if namespace, found := command.FlagValue("--namespace", "-n"); found {
+		target.Namespace = namespace
+	}
+	if target.Namespace == "" {
+		target.Namespace = "default"
+	}
+
+	return target, nil
+}
+
+// KubeFlags returns the flags of a helm command which select its cluster and namespace,
+// so other helm commands can address the same release.
+//
+// Parameters:
+//   - command: The parsed helm command.
+//
+// Returns:
+//   - []string: The `--kubeconfig`, `--kube-context`, and `--namespace` flags, if set.
+func KubeFlags(command HelmCommand) []string {
+	var flags []string
+	for _, names := range [][]string{
+		{"--kubeconfig"},
+		{"--kube-context"},
+		{"--namespace", "-n"},
+	} {
+		if value, found := command.FlagValue(names...); found {
+			flags = append(flags, names[0], value)
+		}
+	}
+	return flags
+}
@@ -0,0 +1,133 @@
+package helm_utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: staging
+contexts:
+  - name: staging
+    context:
+      cluster: staging-cluster
+      namespace: apps
+  - name: prod
+    context:
+      cluster: prod-cluster
+clusters:
+  - name: staging-cluster
+    cluster:
+      server: https://staging.example.com
+  - name: prod-cluster
+    cluster:
+      server: https://prod.example.com
+`
+
+func writeKubeconfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveKubeTarget(t *testing.T) {
+	kubeconfig := writeKubeconfig(t, testKubeconfig)
+	t.Setenv("KUBECONFIG", kubeconfig)
+	t.Setenv("HELM_KUBECONTEXT", "")
+	t.Setenv("HELM_NAMESPACE", "")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected KubeTarget
+	}{
+		{
+			name:     "current context",
+			args:     []string{"upgrade", "release", "chart.tgz"},
+			expected: KubeTarget{Kubeconfig: kubeconfig, Context: "staging", Cluster: "staging-cluster", Server: "https://staging.example.com", Namespace: "apps"},
+		},
+		{
+			name:     "kube context flag",
+			args:     []string{"upgrade", "--kube-context", "prod", "release", "chart.tgz"},
+			expected: KubeTarget{Kubeconfig: kubeconfig, Context: "prod", Cluster: "prod-cluster", Server: "https://prod.example.com", Namespace: "default"},
+		},
+		{
+			name:     "namespace flags",
+			args:     []string{"--kube-context=prod", "upgrade", "-n", "web", "release", "chart.tgz"},
+			expected: KubeTarget{Kubeconfig: kubeconfig, Context: "prod", Cluster: "prod-cluster", Server: "https://prod.example.com", Namespace: "web"},
+		},
+		{
+			name:     "namespace long flag",
+			args:     []string{"upgrade", "--namespace=web", "release", "chart.tgz"},
+			expected: KubeTarget{Kubeconfig: kubeconfig, Context: "staging", Cluster: "staging-cluster", Server: "https://staging.example.com", Namespace: "web"},
+		},
+		{
+			name:     "flag values",
+			args:     []string{"upgrade", "--post-renderer-args", "--namespace=kube-system", "--description", "-n", "release", "chart.tgz"},
+			expected: KubeTarget{Kubeconfig: kubeconfig, Context: "staging", Cluster: "staging-cluster", Server: "https://staging.example.com", Namespace: "apps"},
+		},
+		{
+			name:     "unknown context",
+			args:     []string{"upgrade", "--kube-context", "dev", "release", "chart.tgz"},
+			expected: KubeTarget{Kubeconfig: kubeconfig, Context: "dev", Namespace: "default"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, err := ResolveKubeTarget(ParseHelmCommand(test.args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target != test.expected {
+				t.Errorf("Unexpected target: %+v\nExpected: %+v", target, test.expected)
+			}
+		})
+	}
+}
+
+func TestResolveKubeTargetEnvironment(t *testing.T) {
+	override := writeKubeconfig(t, "current-context: prod\n")
+	base := writeKubeconfig(t, testKubeconfig)
+	missing := filepath.Join(t.TempDir(), "missing")
+	t.Setenv("KUBECONFIG", override+string(os.PathListSeparator)+missing+string(os.PathListSeparator)+base)
+	t.Setenv("HELM_KUBECONTEXT", "")
+	t.Setenv("HELM_NAMESPACE", "jobs")
+
+	target, err := ResolveKubeTarget(ParseHelmCommand([]string{"install", "release", "chart.tgz"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Context != "prod" || target.Cluster != "prod-cluster" || target.Namespace != "jobs" {
+		t.Errorf("Unexpected target: %+v", target)
+	}
+
+	t.Setenv("HELM_KUBECONTEXT", "staging")
+	target, err = ResolveKubeTarget(ParseHelmCommand([]string{"install", "--kubeconfig", base, "release", "chart.tgz"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Kubeconfig != base || target.Context != "staging" || target.Namespace != "jobs" {
+		t.Errorf("Unexpected target: %+v", target)
+	}
+}
+
+func TestKubeFlags(t *testing.T) {
+	args := []string{"--kube-context=prod", "upgrade", "--install", "-n", "web", "--set", "a=b", "release", "chart.tgz"}
+	expected := []string{"--kube-context", "prod", "--namespace", "web"}
+
+	if flags := KubeFlags(ParseHelmCommand(args)); !reflect.DeepEqual(flags, expected) {
+		t.Errorf("Unexpected flags: %v", flags)
+	}
+
+	if flags := KubeFlags(ParseHelmCommand([]string{"upgrade", "release", "chart.tgz"})); len(flags) != 0 {
+		t.Errorf("Expected no flags, got %v", flags)
+	}
+}
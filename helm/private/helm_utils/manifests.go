@@ -0,0 +1,156 @@
+package helm_utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a single YAML document rendered by `helm template`.
+type Manifest struct {
+	// Source is the template which produced the document, taken from the
+	// `# Source:` comment helm writes before each document.
+	Source string
+
+	// Index is the position of the document among those produced by Source.
+	Index int
+
+	// Content is the raw text of the document.
+	Content string
+
+	// Object is the parsed document.
+	Object map[string]interface{}
+}
+
+var (
+	// A document separator must start at the beginning of a line, so a `---`
+	// inside a (necessarily indented) block scalar does not split a document.
+	documentSeparatorRegex = regexp.MustCompile(`^(---|\.\.\.)(\s|$)`)
+
+	sourceCommentRegex = regexp.MustCompile(`^#\s*Source:\s*(.+?)\s*$`)
+)
+
+// ParseManifests parses the multi-document output of `helm template`. Empty
+// documents are skipped.
+//
+// Parameters:
+//   - content: The rendered manifests.
+//
+// Returns:
+//   - []Manifest: The parsed documents in the order they were rendered.
+//   - error: An error if a document is not valid YAML or not a mapping.
+func ParseManifests(content string) ([]Manifest, error) {
+	var manifests []Manifest
+	counts := map[string]int{}
+
+	var lines []string
+	source := ""
+	flush := func() error {
+		text := strings.Join(lines, "\n") + "\n"
+		lines = nil
+		currentSource := source
+		source = ""
+
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(text), &object); err != nil {
+			if currentSource != "" {
+				return fmt.Errorf("Error parsing document from %s: %w", currentSource, err)
+			}
+			return fmt.Errorf("Error parsing document %d: %w", len(manifests), err)
+		}
+		if object == nil {
+			return nil
+		}
+
+		manifests = append(manifests, Manifest{
+			Source:  currentSource,
+			Index:   counts[currentSource],
+			Content: strings.TrimSpace(text) + "\n",
+			Object:  object,
+		})
+		counts[currentSource]++
+		return nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if documentSeparatorRegex.MatchString(line) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if source == "" {
+			if match := sourceCommentRegex.FindStringSubmatch(line); match != nil {
+				source = match[1]
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return manifests, nil
+}
+
+func (m Manifest) stringField(path ...string) string {
+	value, _ := Lookup(m.Object, path...)
+	text, _ := value.(string)
+	return text
+}
+
+// APIVersion returns the `apiVersion` of the object.
+func (m Manifest) APIVersion() string {
+	return m.stringField("apiVersion")
+}
+
+// Kind returns the `kind` of the object.
+func (m Manifest) Kind() string {
+	return m.stringField("kind")
+}
+
+// Name returns the `metadata.name` of the object.
+func (m Manifest) Name() string {
+	return m.stringField("metadata", "name")
+}
+
+// Namespace returns the `metadata.namespace` of the object.
+func (m Manifest) Namespace() string {
+	return m.stringField("metadata", "namespace")
+}
+
+// ID identifies the object as `kind/namespace/name`. The namespace is empty for
+// objects which do not set one.
+func (m Manifest) ID() string {
+	return fmt.Sprintf("%s/%s/%s", m.Kind(), m.Namespace(), m.Name())
+}
+
+// Lookup returns the value at a path of mapping keys within a parsed YAML object.
+//
+// Parameters:
+//   - object: The parsed object.
+//   - path: The keys to descend through.
+//
+// Returns:
+//   - interface{}: The value at the path.
+//   - bool: Whether or not the path exists.
+func Lookup(object interface{}, path ...string) (interface{}, bool) {
+	current := object
+	for _, key := range path {
+		mapping, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = mapping[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,72 @@
+package helm_utils
+
+import (
+	"testing"
+)
+
+const renderedManifests = `---
+# Source: mychart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: prod
+---
+# Source: mychart/templates/configmaps.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+data:
+  script: |
+    echo start
+    ---
+    echo end
+---
+# Source: mychart/templates/configmaps.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+---
+# Source: mychart/templates/empty.yaml
+`
+
+func TestParseManifests(t *testing.T) {
+	manifests, err := ParseManifests(renderedManifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		source string
+		index  int
+		id     string
+	}{
+		{"mychart/templates/service.yaml", 0, "Service/prod/web"},
+		{"mychart/templates/configmaps.yaml", 0, "ConfigMap//first"},
+		{"mychart/templates/configmaps.yaml", 1, "ConfigMap//second"},
+	}
+
+	if len(manifests) != len(expected) {
+		t.Fatalf("Expected %d manifests, got %d", len(expected), len(manifests))
+	}
+
+	for i, want := range expected {
+		got := manifests[i]
+		if got.Source != want.source || got.Index != want.index || got.ID() != want.id {
+			t.Errorf("Manifest %d: expected %v, got %s[%d] %s", i, want, got.Source, got.Index, got.ID())
+		}
+	}
+
+	script, _ := Lookup(manifests[1].Object, "data", "script")
+	if script != "echo start\n---\necho end\n" {
+		t.Errorf("Unexpected block scalar: %q", script)
+	}
+}
+
+func TestParseManifestsInvalid(t *testing.T) {
+	if _, err := ParseManifests("---\n# Source: mychart/templates/bad.yaml\nkey: [\n"); err == nil {
+		t.Error("Expected an error for invalid YAML")
+	}
+}
@@ -0,0 +1,234 @@
+package helm_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PathSegment is a single step of a path into a parsed YAML object.
+type PathSegment struct {
+	// Key is the mapping key to descend into.
+	Key string
+
+	// Index is the sequence index to descend into when IsIndex is set. Negative
+	// indices count from the end of the sequence.
+	Index int
+
+	// IsIndex indicates the segment selects a sequence item.
+	IsIndex bool
+
+	// Wildcard indicates the segment selects every item of a sequence or mapping.
+	Wildcard bool
+}
+
+// String renders the segment as it would appear in a path.
+func (s PathSegment) String() string {
+	switch {
+	case s.Wildcard:
+		return "[*]"
+	case s.IsIndex:
+		return fmt.Sprintf("[%d]", s.Index)
+	case strings.ContainsAny(s.Key, ".[]\"' ") || s.Key == "":
+		return fmt.Sprintf("[%q]", s.Key)
+	default:
+		return "." + s.Key
+	}
+}
+
+// ParsePath parses a yq style path such as `.spec.containers[0].image` or
+// `.metadata.labels["app.kubernetes.io/name"]`. Keys which contain dots or brackets
+// must be quoted within brackets. `[*]` selects every item of a sequence or mapping.
+// The leading `.` is optional and `.` alone refers to the whole object.
+//
+// Parameters:
+//   - path: The path to parse.
+//
+// Returns:
+//   - []PathSegment: The segments of the path.
+//   - error: An error if the path is malformed.
+func ParsePath(path string) ([]PathSegment, error) {
+	var segments []PathSegment
+
+	text := strings.TrimSpace(path)
+	if text == "." || text == "" {
+		return segments, nil
+	}
+	if !strings.HasPrefix(text, ".") && !strings.HasPrefix(text, "[") {
+		text = "." + text
+	}
+
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '.':
+			end := i + 1
+			for end < len(text) && text[end] != '.' && text[end] != '[' {
+				end++
+			}
+			key := text[i+1 : end]
+			if key == "" {
+				return nil, fmt.Errorf("Error parsing path `%s`: empty key at offset %d", path, i)
+			}
+			if strings.ContainsAny(key, "]\"'") {
+				return nil, fmt.Errorf("Error parsing path `%s`: key `%s` must be quoted within brackets", path, key)
+			}
+			segments = append(segments, PathSegment{Key: key})
+			i = end
+
+		case '[':
+			if i+1 < len(text) && (text[i+1] == '"' || text[i+1] == '\'') {
+				// Quoted keys may contain `]`, so find the closing quote first.
+				start := i + 2
+				closing := strings.IndexByte(text[start:], text[i+1])
+				if closing < 0 || start+closing+1 >= len(text) || text[start+closing+1] != ']' {
+					return nil, fmt.Errorf("Error parsing path `%s`: unterminated quoted key at offset %d", path, i)
+				}
+				segments = append(segments, PathSegment{Key: text[start : start+closing]})
+				i = start + closing + 2
+				continue
+			}
+
+			end := strings.IndexByte(text[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Error parsing path `%s`: unterminated `[` at offset %d", path, i)
+			}
+			selector := text[i+1 : i+end]
+
+			switch selector {
+			case "*":
+				segments = append(segments, PathSegment{Wildcard: true})
+			default:
+				index, err := strconv.Atoi(strings.TrimSpace(selector))
+				if err != nil {
+					return nil, fmt.Errorf("Error parsing path `%s`: invalid index `%s`", path, selector)
+				}
+				segments = append(segments, PathSegment{Index: index, IsIndex: true})
+			}
+			i += end + 1
+
+		default:
+			return nil, fmt.Errorf("Error parsing path `%s`: unexpected `%c` at offset %d", path, text[i], i)
+		}
+	}
+
+	return segments, nil
+}
+
+// ResolvePath returns every value a path selects within a parsed YAML object. Paths
+// which do not exist select nothing.
+//
+// Parameters:
+//   - object: The parsed object.
+//   - path: The segments returned by `ParsePath`.
+//
+// Returns:
+//   - []interface{}: The selected values.
+func ResolvePath(object interface{}, path []PathSegment) []interface{} {
+	current := []interface{}{object}
+	for _, segment := range path {
+		var next []interface{}
+		for _, value := range current {
+			switch typed := value.(type) {
+			case map[string]interface{}:
+				if segment.Wildcard {
+					for _, key := range sortedKeys(typed) {
+						next = append(next, typed[key])
+					}
+				} else if item, found := typed[segment.Key]; found && !segment.IsIndex {
+					next = append(next, item)
+				}
+			case []interface{}:
+				if segment.Wildcard {
+					next = append(next, typed...)
+				} else if segment.IsIndex {
+					index := segment.Index
+					if index < 0 {
+						index += len(typed)
+					}
+					if index >= 0 && index < len(typed) {
+						next = append(next, typed[index])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// FormatPath renders parsed segments back into a path.
+//
+// Parameters:
+//   - path: The segments returned by `ParsePath`.
+//
+// Returns:
+//   - string: The rendered path.
+func FormatPath(path []PathSegment) string {
+	if len(path) == 0 {
+		return "."
+	}
+	var builder strings.Builder
+	for _, segment := range path {
+		builder.WriteString(segment.String())
+	}
+	return builder.String()
+}
+
+func sortedKeys(mapping map[string]interface{}) []string {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NormalizeValue converts all numbers to float64 so values compare equal regardless of
+// how they were decoded.
+//
+// Parameters:
+//   - value: A parsed YAML or JSON value.
+//
+// Returns:
+//   - interface{}: The value with every number converted to float64.
+func NormalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case uint64:
+		return float64(typed)
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			normalized[key] = NormalizeValue(item)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(typed))
+		for i, item := range typed {
+			normalized[i] = NormalizeValue(item)
+		}
+		return normalized
+	}
+	return value
+}
+
+// FormatValue renders a value for failure messages. Strings are quoted so they can be
+// told apart from other scalars.
+//
+// Parameters:
+//   - value: A parsed YAML or JSON value.
+//
+// Returns:
+//   - string: The value rendered as JSON.
+func FormatValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
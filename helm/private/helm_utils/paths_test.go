@@ -0,0 +1,89 @@
+package helm_utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []PathSegment
+	}{
+		{".", nil},
+		{"spec.replicas", []PathSegment{{Key: "spec"}, {Key: "replicas"}}},
+		{".spec.containers[0].image", []PathSegment{{Key: "spec"}, {Key: "containers"}, {Index: 0, IsIndex: true}, {Key: "image"}}},
+		{`.metadata.labels["app.kubernetes.io/name"]`, []PathSegment{{Key: "metadata"}, {Key: "labels"}, {Key: "app.kubernetes.io/name"}}},
+		{`.data['a]b'][*][-1]`, []PathSegment{{Key: "data"}, {Key: "a]b"}, {Wildcard: true}, {Index: -1, IsIndex: true}}},
+	}
+
+	for _, test := range tests {
+		segments, err := ParsePath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("ParsePath(%s) = %v, expected %v", test.path, segments, test.expected)
+		}
+	}
+
+	for _, path := range []string{".spec..replicas", ".spec[0", ".spec[x]", `.labels["a]`, ".spec]"} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("Expected an error parsing `%s`", path)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	object := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:1.0"},
+				map[string]interface{}{"name": "sidecar"},
+			},
+		},
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app.kubernetes.io/name": "web"},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected []interface{}
+	}{
+		{".spec.containers[0].image", []interface{}{"app:1.0"}},
+		{".spec.containers[-1].name", []interface{}{"sidecar"}},
+		{".spec.containers[*].name", []interface{}{"app", "sidecar"}},
+		{".spec.containers[*].image", []interface{}{"app:1.0"}},
+		{`.metadata.labels["app.kubernetes.io/name"]`, []interface{}{"web"}},
+		{".spec.containers[2]", nil},
+		{".spec.missing", nil},
+		{".spec.containers.name", nil},
+	}
+
+	for _, test := range tests {
+		segments, err := ParsePath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := ResolvePath(object, segments)
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("ResolvePath(%s) = %v, expected %v", test.path, values, test.expected)
+		}
+		if formatted, _ := ParsePath(FormatPath(segments)); !reflect.DeepEqual(formatted, segments) {
+			t.Errorf("FormatPath(%v) = %s does not round trip", segments, FormatPath(segments))
+		}
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	value := NormalizeValue(map[string]interface{}{"replicas": 3, "ports": []interface{}{int64(80), "http"}})
+	expected := map[string]interface{}{"replicas": float64(3), "ports": []interface{}{float64(80), "http"}}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Unexpected value: %#v", value)
+	}
+
+	if formatted := FormatValue(value); formatted != `{"ports":[80,"http"],"replicas":3}` {
+		t.Errorf("Unexpected formatted value: %s", formatted)
+	}
+}
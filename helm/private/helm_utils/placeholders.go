@@ -0,0 +1,269 @@
+package helm_utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PlaceholderSyntax describes the delimiters surrounding a placeholder expression.
+type PlaceholderSyntax struct {
+	Open  string
+	Close string
+
+	// Escapes allows a placeholder to be written out literally by preceding it with a
+	// backslash. The default syntax does not support escapes as `\{...}` is common in
+	// existing chart content, such as regular expressions.
+	Escapes bool
+}
+
+// PlaceholderSyntaxes maps the names accepted by the `placeholder_syntax` setting
+// to their delimiters.
+var PlaceholderSyntaxes = map[string]PlaceholderSyntax{
+	"braces":        {Open: "{", Close: "}"},
+	"dollar_braces": {Open: "${", Close: "}", Escapes: true},
+	"stamp":         {Open: "{{stamp:", Close: "}}", Escapes: true},
+}
+
+// placeholderRegexes are the compiled regexes of PlaceholderSyntaxes.
+var placeholderRegexes = func() map[PlaceholderSyntax]*regexp.Regexp {
+	regexes := make(map[PlaceholderSyntax]*regexp.Regexp, len(PlaceholderSyntaxes))
+	for _, syntax := range PlaceholderSyntaxes {
+		regexes[syntax] = syntax.compile()
+	}
+	return regexes
+}()
+
+// DefaultPlaceholderSyntax is the `{KEY}` syntax rules_helm has always used.
+var DefaultPlaceholderSyntax = PlaceholderSyntaxes["braces"]
+
+// ParsePlaceholderSyntax looks up a placeholder syntax by name. An empty name
+// yields DefaultPlaceholderSyntax.
+func ParsePlaceholderSyntax(name string) (PlaceholderSyntax, error) {
+	if name == "" {
+		return DefaultPlaceholderSyntax, nil
+	}
+
+	syntax, found := PlaceholderSyntaxes[name]
+	if !found {
+		return syntax, fmt.Errorf("Unknown placeholder syntax `%s`", name)
+	}
+
+	return syntax, nil
+}
+
+func (s PlaceholderSyntax) orDefault() PlaceholderSyntax {
+	if s.Open == "" || s.Close == "" {
+		return DefaultPlaceholderSyntax
+	}
+	return s
+}
+
+// compile builds a regex matching a single expression which does not span lines or contain
+// braces. For syntaxes with escapes, a leading backslash is captured in the first group,
+// which is otherwise always empty.
+func (s PlaceholderSyntax) compile() *regexp.Regexp {
+	escape := ``
+	if s.Escapes {
+		escape = `\\?`
+	}
+	return regexp.MustCompile(`(` + escape + `)` + regexp.QuoteMeta(s.Open) + `([^{}\n]+)` + regexp.QuoteMeta(s.Close))
+}
+
+// regex returns the compiled regex of the syntax.
+func (s PlaceholderSyntax) regex() *regexp.Regexp {
+	if regex, found := placeholderRegexes[s]; found {
+		return regex
+	}
+	return s.compile()
+}
+
+// semverRegex is the regex suggested by https://semver.org for validating versions.
+var semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// PlaceholderFilter is a single `|name[:arg]` transformation within a placeholder.
+type PlaceholderFilter struct {
+	Name string
+	Arg  string
+}
+
+// Placeholder is a parsed placeholder expression of the form
+// `KEY[:-DEFAULT][|FILTER[:ARG]]...`. For example `{STABLE_GIT_COMMIT:-unknown|short}`.
+type Placeholder struct {
+	Key        string
+	Default    string
+	HasDefault bool
+	Filters    []PlaceholderFilter
+}
+
+// ExpandOptions controls how ExpandPlaceholders treats unresolved placeholders.
+type ExpandOptions struct {
+	// Finalize replaces unresolved placeholders which declare a default with
+	// that default. Content is often expanded in several passes (substitutions,
+	// stamps, images) so this should only be set on the last one.
+	Finalize bool
+
+	// Syntax is the placeholder delimiters to expand. DefaultPlaceholderSyntax is
+	// used when unset.
+	Syntax PlaceholderSyntax
+}
+
+// ParsePlaceholder parses the text between the braces of a placeholder.
+//
+// Parameters:
+//   - expr: The placeholder expression, e.g. `STABLE_GIT_TAG:-0.0.0|semver`.
+//
+// Returns:
+//   - Placeholder: The parsed expression. Filters are validated when rendered.
+func ParsePlaceholder(expr string) Placeholder {
+	var placeholder Placeholder
+
+	segments := strings.Split(expr, "|")
+	placeholder.Key = segments[0]
+	if key, def, found := strings.Cut(segments[0], ":-"); found {
+		placeholder.Key = key
+		placeholder.Default = def
+		placeholder.HasDefault = true
+	}
+
+	for _, segment := range segments[1:] {
+		name, arg, _ := strings.Cut(strings.TrimSpace(segment), ":")
+		placeholder.Filters = append(placeholder.Filters, PlaceholderFilter{Name: name, Arg: arg})
+	}
+
+	return placeholder
+}
+
+func truncate(value string, arg string) (string, error) {
+	length, err := strconv.Atoi(arg)
+	if err != nil || length < 0 {
+		return "", fmt.Errorf("invalid length `%s`", arg)
+	}
+	runes := []rune(value)
+	if len(runes) > length {
+		runes = runes[:length]
+	}
+	return string(runes), nil
+}
+
+func applyFilter(value string, filter PlaceholderFilter) (string, error) {
+	switch filter.Name {
+	case "short":
+		return truncate(value, "7")
+	case "trunc":
+		return truncate(value, filter.Arg)
+	case "lower":
+		return strings.ToLower(value), nil
+	case "upper":
+		return strings.ToUpper(value), nil
+	case "semver":
+		version := strings.TrimPrefix(value, "v")
+		if !semverRegex.MatchString(version) {
+			return "", fmt.Errorf("the value is not a semantic version")
+		}
+		return version, nil
+	case "quote":
+		return strconv.Quote(value), nil
+	case "sha256":
+		hash := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(hash[:]), nil
+	}
+
+	return "", fmt.Errorf("unknown filter `%s`", filter.Name)
+}
+
+// Render applies the placeholder's filters to value.
+func (p Placeholder) Render(value string) (string, error) {
+	for _, filter := range p.Filters {
+		var err error
+		value, err = applyFilter(value, filter)
+		if err != nil {
+			return "", fmt.Errorf("filter `%s` on `%s`: %w", filter.Name, p.Key, err)
+		}
+	}
+
+	return value, nil
+}
+
+// ExpandPlaceholders replaces all placeholders in content whose key is known to lookup.
+// Placeholders for unknown keys are left untouched unless `opts.Finalize` is set and
+// the placeholder declares a default. This keeps unrelated braces, such as empty YAML
+// maps, intact. For syntaxes supporting escapes, a placeholder preceded by a backslash
+// (e.g. `\${KEY}`) is never expanded and is written out without the backslash once
+// `opts.Finalize` is set.
+//
+// Parameters:
+//   - content: The text to expand.
+//   - lookup: A function returning the value of a key and whether or not it is defined.
+//   - opts: Options controlling the expansion.
+//
+// Returns:
+//   - string: The expanded content.
+//   - map[string]bool: The set of keys which were resolved through lookup.
+//   - error: An error if a filter could not be applied.
+func ExpandPlaceholders(content string, lookup func(string) (string, bool), opts ExpandOptions) (string, map[string]bool, error) {
+	used := map[string]bool{}
+	var expandErr error
+
+	syntax := opts.Syntax.orDefault()
+	regex := syntax.regex()
+
+	expanded := regex.ReplaceAllStringFunc(content, func(match string) string {
+		if expandErr != nil {
+			return match
+		}
+
+		groups := regex.FindStringSubmatch(match)
+		if groups[1] != "" {
+			if opts.Finalize {
+				return match[len(groups[1]):]
+			}
+			return match
+		}
+
+		expr := groups[2]
+
+		// Keys containing filter or default syntax are still honored verbatim.
+		if value, found := lookup(expr); found {
+			used[expr] = true
+			return value
+		}
+
+		placeholder := ParsePlaceholder(expr)
+
+		value, found := lookup(placeholder.Key)
+		if !found {
+			if !opts.Finalize || !placeholder.HasDefault {
+				return match
+			}
+			value = placeholder.Default
+		} else {
+			used[placeholder.Key] = true
+		}
+
+		rendered, err := placeholder.Render(value)
+		if err != nil {
+			expandErr = fmt.Errorf("Error expanding `%s`: %w", match, err)
+			return match
+		}
+
+		return rendered
+	})
+
+	if expandErr != nil {
+		return content, used, expandErr
+	}
+
+	return expanded, used, nil
+}
+
+// MapLookup adapts a map to the lookup function used by ExpandPlaceholders.
+func MapLookup(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, found := values[key]
+		return value, found
+	}
+}
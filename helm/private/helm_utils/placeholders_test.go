@@ -0,0 +1,121 @@
+package helm_utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	stamps := map[string]string{
+		"STABLE_GIT_COMMIT": "0123456789abcdef",
+		"STABLE_GIT_TAG":    "v1.2.3",
+		"BUILD_USER":        "Builder",
+		"//image:push":      "registry.io/image@sha256:1234",
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		finalize bool
+		expected string
+	}{
+		{"exact", "commit: {STABLE_GIT_COMMIT}", false, "commit: 0123456789abcdef"},
+		{"label", "image: {//image:push}", false, "image: registry.io/image@sha256:1234"},
+		{"short", "{STABLE_GIT_COMMIT|short}", false, "0123456"},
+		{"trunc", "{STABLE_GIT_COMMIT|trunc:4}", false, "0123"},
+		{"lower", "{BUILD_USER|lower}", false, "builder"},
+		{"semver", "{STABLE_GIT_TAG|semver}", false, "1.2.3"},
+		{"quote", "{BUILD_USER|quote}", false, `"Builder"`},
+		{"sha256", "{BUILD_USER|sha256|short}", false, "090940e"},
+		{"chained", "{BUILD_USER|lower|quote}", false, `"builder"`},
+		{"default unused", "{STABLE_GIT_TAG:-0.0.0|semver}", true, "1.2.3"},
+		{"default pending", "{MISSING:-0.0.0}", false, "{MISSING:-0.0.0}"},
+		{"default applied", "{MISSING:-0.0.0}", true, "0.0.0"},
+		{"default filtered", "{MISSING:-ABC|lower}", true, "abc"},
+		{"unknown untouched", "{MISSING}", true, "{MISSING}"},
+		{"yaml maps untouched", "annotations: {}\nlabels: {a: b}", true, "annotations: {}\nlabels: {a: b}"},
+		{"nested braces", "{{STABLE_GIT_COMMIT|short}}", false, "{0123456}"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, _, err := ExpandPlaceholders(test.content, MapLookup(stamps), ExpandOptions{Finalize: test.finalize})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("Expected `%s` but got `%s`", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpandPlaceholdersErrors(t *testing.T) {
+	stamps := map[string]string{
+		"STABLE_GIT_TAG": "secret-main",
+	}
+
+	for _, content := range []string{
+		"--set=token={STABLE_GIT_TAG|semver}",
+		"{STABLE_GIT_TAG|unknown}",
+		"{STABLE_GIT_TAG|trunc:x}",
+	} {
+		_, _, err := ExpandPlaceholders(content, MapLookup(stamps), ExpandOptions{Finalize: true})
+		if err == nil {
+			t.Errorf("Expected an error expanding `%s`", content)
+			continue
+		}
+		// Stamped values and the surrounding content may be sensitive.
+		if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "token") {
+			t.Errorf("Expected only the placeholder to be reported, got: %s", err)
+		}
+	}
+}
+
+func TestExpandPlaceholdersSyntax(t *testing.T) {
+	stamps := map[string]string{
+		"KEY": "value",
+	}
+
+	tests := []struct {
+		syntax   string
+		content  string
+		expected string
+	}{
+		{"braces", "a: {KEY}, b: \\{KEY}, c: \\{3\\}", "a: value, b: \\value, c: \\{3\\}"},
+		{"dollar_braces", "a: ${KEY}, b: {KEY}, c: \\${KEY}", "a: value, b: {KEY}, c: ${KEY}"},
+		{"dollar_braces", "--set list={KEY,other}", "--set list={KEY,other}"},
+		{"stamp", "a: {{stamp:KEY|upper}}, b: {KEY}, c: {{ .Values.KEY }}", "a: VALUE, b: {KEY}, c: {{ .Values.KEY }}"},
+		{"stamp", "\\{{stamp:KEY}}", "{{stamp:KEY}}"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.syntax, func(t *testing.T) {
+			syntax, err := ParsePlaceholderSyntax(test.syntax)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Escapes must survive intermediate passes untouched.
+			pending, _, err := ExpandPlaceholders(test.content, MapLookup(nil), ExpandOptions{Syntax: syntax})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pending != test.content {
+				t.Errorf("Expected `%s` to be untouched but got `%s`", test.content, pending)
+			}
+
+			actual, _, err := ExpandPlaceholders(test.content, MapLookup(stamps), ExpandOptions{Syntax: syntax, Finalize: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != test.expected {
+				t.Errorf("Expected `%s` but got `%s`", test.expected, actual)
+			}
+		})
+	}
+
+	if _, err := ParsePlaceholderSyntax("unknown"); err == nil {
+		t.Error("Expected an error for an unknown placeholder syntax")
+	}
+}
@@ -0,0 +1,182 @@
+package helm_utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PlanFlag requests that a runner prints what it would do instead of doing it.
+const PlanFlag = "--rules-helm-plan"
+
+// PlanRequested determines whether plan mode was requested, either with `--rules-helm-plan`
+// or by setting `RULES_HELM_PLAN=1`.
+//
+// Parameters:
+//   - args: The command line arguments.
+//
+// Returns:
+//   - []string: The arguments without the plan flag.
+//   - bool: Whether plan mode was requested.
+func PlanRequested(args []string) ([]string, bool) {
+	requested := os.Getenv("RULES_HELM_PLAN") == "1"
+
+	remaining := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == PlanFlag {
+			requested = true
+			continue
+		}
+		remaining = append(remaining, arg)
+	}
+	return remaining, requested
+}
+
+// FileDigest computes the sha256 digest of a file.
+//
+// Parameters:
+//   - path: The path of the file.
+//
+// Returns:
+//   - string: The digest, e.g. `sha256:...`.
+//   - error: An error if the file could not be read.
+func FileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("Error opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("Error reading %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// QuoteCommand renders a command line which can be pasted into a POSIX shell.
+//
+// Parameters:
+//   - command: The executable followed by its arguments.
+//
+// Returns:
+//   - string: The quoted command line.
+func QuoteCommand(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+./:,@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// describeImage renders the label and reference of the image pushed by a pusher.
+func describeImage(pusher ImagePusher) string {
+	name := pusher.Label
+	if name == "" {
+		name = pusher.Pusher
+	}
+
+	if pusher.Repository == "" || (pusher.OciLayout == "" && pusher.ManifestFile == "") {
+		return name
+	}
+	repository, err := os.ReadFile(pusher.Repository)
+	if err != nil {
+		return name
+	}
+	digest, err := ImageDigest(pusher.OciLayout, pusher.ManifestFile)
+	if err != nil {
+		return name
+	}
+	return fmt.Sprintf("%s (%s@%s)", name, strings.TrimSpace(string(repository)), digest)
+}
+
+// Plan describes what a runner would do.
+type Plan struct {
+	// Commands are the helm command lines which would run, in order.
+	Commands [][]string
+
+	// Chart is the path of the chart, if any.
+	Chart string
+
+	// Kube is the cluster the commands would operate on, if any.
+	Kube *KubeTarget
+
+	// RegistryHost is the host which would be logged into, if any.
+	RegistryHost string
+
+	// Images are the image pushers which would run.
+	Images []ImagePusher
+
+	// Hooks describe the deploy hooks which would run.
+	Hooks []string
+}
+
+// Write prints the plan.
+//
+// Parameters:
+//   - output: The writer to print to.
+//
+// Returns:
+//   - error: An error if the digest of the chart could not be computed.
+func (p Plan) Write(output io.Writer) error {
+	fmt.Fprintln(output, "Plan (nothing has been executed):")
+
+	if p.Chart != "" {
+		digest, err := FileDigest(p.Chart)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "  chart:          %s\n", p.Chart)
+		fmt.Fprintf(output, "  chart digest:   %s\n", digest)
+	}
+
+	if p.Kube != nil {
+		context := p.Kube.Context
+		if context == "" {
+			context = "<none>"
+		}
+		if p.Kube.Cluster != "" {
+			context = fmt.Sprintf("%s (cluster `%s`", context, p.Kube.Cluster)
+			if p.Kube.Server != "" {
+				context += fmt.Sprintf(" at %s", p.Kube.Server)
+			}
+			context += ")"
+		}
+		fmt.Fprintf(output, "  kube context:   %s\n", context)
+		fmt.Fprintf(output, "  namespace:      %s\n", p.Kube.Namespace)
+		if p.Kube.Kubeconfig != "" {
+			fmt.Fprintf(output, "  kubeconfig:     %s\n", p.Kube.Kubeconfig)
+		}
+	}
+
+	if p.RegistryHost != "" {
+		fmt.Fprintf(output, "  registry login: %s\n", p.RegistryHost)
+	}
+
+	if len(p.Images) > 0 {
+		fmt.Fprintf(output, "  image pushers:\n")
+		for _, pusher := range p.Images {
+			fmt.Fprintf(output, "    %s\n", describeImage(pusher))
+		}
+	}
+
+	if len(p.Hooks) > 0 {
+		fmt.Fprintf(output, "  deploy hooks:\n")
+		for _, hook := range p.Hooks {
+			fmt.Fprintf(output, "    %s\n", hook)
+		}
+	}
+
+	for _, command := range p.Commands {
+		fmt.Fprintf(output, "  command:        %s\n", QuoteCommand(command))
+	}
+
+	return nil
+}
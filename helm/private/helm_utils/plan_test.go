@@ -0,0 +1,83 @@
+package helm_utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanRequested(t *testing.T) {
+	t.Setenv("RULES_HELM_PLAN", "")
+
+	args, requested := PlanRequested([]string{"upgrade", "--rules-helm-plan", "release", "chart.tgz"})
+	if !requested {
+		t.Error("Expected plan mode to be requested by the flag")
+	}
+	if !reflect.DeepEqual(args, []string{"upgrade", "release", "chart.tgz"}) {
+		t.Errorf("Expected the plan flag to be removed, got %v", args)
+	}
+
+	if _, requested := PlanRequested([]string{"upgrade", "release", "chart.tgz"}); requested {
+		t.Error("Expected plan mode not to be requested")
+	}
+
+	t.Setenv("RULES_HELM_PLAN", "1")
+	if _, requested := PlanRequested([]string{"upgrade", "release", "chart.tgz"}); !requested {
+		t.Error("Expected plan mode to be requested by the environment")
+	}
+}
+
+func TestQuoteCommand(t *testing.T) {
+	command := []string{"/bin/helm", "upgrade", "--set", "a=b c", "--set", "msg=it's", "", "--namespace=web"}
+	expected := `/bin/helm upgrade --set 'a=b c' --set 'msg=it'"'"'s' '' --namespace=web`
+
+	if quoted := QuoteCommand(command); quoted != expected {
+		t.Errorf("Unexpected command:\n%s\nExpected:\n%s", quoted, expected)
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "chart.tgz")
+	if err := os.WriteFile(chart, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pusher := writePusherFiles(t, "sha256:abc", "")
+	plan := Plan{
+		Commands: [][]string{{"helm", "upgrade", "release", chart}},
+		Chart:    chart,
+		Kube: &KubeTarget{
+			Kubeconfig: "/home/user/.kube/config",
+			Context:    "prod",
+			Cluster:    "prod-cluster",
+			Server:     "https://prod.example.com",
+			Namespace:  "web",
+		},
+		RegistryHost: "my.registry.io",
+		Images:       []ImagePusher{pusher, {Pusher: "/bin/push"}},
+	}
+
+	var output strings.Builder
+	if err := plan.Write(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Plan (nothing has been executed):
+  chart:          ` + chart + `
+  chart digest:   sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a
+  kube context:   prod (cluster ` + "`prod-cluster`" + ` at https://prod.example.com)
+  namespace:      web
+  kubeconfig:     /home/user/.kube/config
+  registry login: my.registry.io
+  image pushers:
+    //app:push (my.registry.io/team/app@sha256:abc)
+    /bin/push
+  command:        helm upgrade release ` + chart + `
+`
+	if output.String() != expected {
+		t.Errorf("Unexpected plan:\n%s\nExpected:\n%s", output.String(), expected)
+	}
+}
@@ -0,0 +1,84 @@
+package helm_utils
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// workspaceStatusKeyRegex restricts keys to names which can be referenced unambiguously
+// from a placeholder expression.
+var workspaceStatusKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// ParseWorkspaceStatus parses the content of a Bazel workspace status file.
+// Each line is a key, optionally followed by a single space and its value. A key
+// without a value is defined with an empty value.
+//
+// Parameters:
+//   - content: The content of a `stable-status.txt` or `volatile-status.txt` file.
+//
+// Returns:
+//   - map[string]string: A mapping of status keys to values.
+//   - error: An error if a key is invalid or defined more than once.
+func ParseWorkspaceStatus(content string) (map[string]string, error) {
+	status := map[string]string{}
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		key, val, _ := strings.Cut(line, " ")
+		if !workspaceStatusKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid workspace status key `%s`", i+1, key)
+		}
+		if _, exists := status[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate workspace status key `%s`", i+1, key)
+		}
+
+		status[key] = val
+	}
+
+	return status, nil
+}
+
+// LoadWorkspaceStatus reads and merges Bazel's workspace status files. When a key
+// is defined in both files the value from the stable status file takes precedence
+// as it is the one which invalidates the actions consuming it.
+//
+// Parameters:
+//   - stableStatusFile: The path to the stable status file (`ctx.info_file`). May be empty.
+//   - volatileStatusFile: The path to the volatile status file (`ctx.version_file`). May be empty.
+//
+// Returns:
+//   - map[string]string: A mapping of status keys to values.
+//   - error: An error if either file could not be read or parsed.
+func LoadWorkspaceStatus(stableStatusFile string, volatileStatusFile string) (map[string]string, error) {
+	stamps := map[string]string{}
+
+	// Files are loaded from lowest to highest precedence.
+	for _, statusFile := range []string{volatileStatusFile, stableStatusFile} {
+		// The files may not be defined
+		if len(statusFile) == 0 {
+			continue
+		}
+
+		content, err := os.ReadFile(statusFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading file %s: %w", statusFile, err)
+		}
+
+		status, err := ParseWorkspaceStatus(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing workspace status file %s: %w", statusFile, err)
+		}
+
+		for key, val := range status {
+			stamps[key] = val
+		}
+	}
+
+	return stamps, nil
+}
@@ -0,0 +1,71 @@
+package helm_utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseWorkspaceStatus(t *testing.T) {
+	content := "BUILD_USER builder\r\nSTABLE_EMPTY\nSTABLE_TRAILING \nSTABLE_SPACES a b  c\n\n"
+
+	status, err := ParseWorkspaceStatus(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"BUILD_USER":      "builder",
+		"STABLE_EMPTY":    "",
+		"STABLE_TRAILING": "",
+		"STABLE_SPACES":   "a b  c",
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Expected %v but got %v", expected, status)
+	}
+}
+
+func TestParseWorkspaceStatusErrors(t *testing.T) {
+	for _, content := range []string{
+		"KEY a\nKEY b\n",
+		" KEY a\n",
+		"KEY|short a\n",
+	} {
+		if _, err := ParseWorkspaceStatus(content); err == nil {
+			t.Errorf("Expected an error parsing %q", content)
+		}
+	}
+}
+
+func TestLoadWorkspaceStatusPrecedence(t *testing.T) {
+	dir := t.TempDir()
+
+	stable := filepath.Join(dir, "stable-status.txt")
+	if err := os.WriteFile(stable, []byte("STABLE_VALUE stable\nSHARED stable\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	volatile := filepath.Join(dir, "volatile-status.txt")
+	if err := os.WriteFile(volatile, []byte("VOLATILE_VALUE volatile\nSHARED volatile\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := LoadWorkspaceStatus(stable, volatile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"STABLE_VALUE":   "stable",
+		"VOLATILE_VALUE": "volatile",
+		"SHARED":         "stable",
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Expected %v but got %v", expected, status)
+	}
+
+	status, err = LoadWorkspaceStatus("", "")
+	if err != nil || len(status) != 0 {
+		t.Errorf("Expected no stamps without status files but got %v (%v)", status, err)
+	}
+}
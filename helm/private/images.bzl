@@ -0,0 +1,50 @@
+"""Helpers for pushing the images of helm packages"""
+
+load(":helm_package.bzl", "OciPushRepositoryInfo")
+load(":helm_utils.bzl", "rlocationpath")
+
+def write_image_manifest(*, ctx, images, output):
+    """Write a manifest of image pushers for the runner and registrar.
+
+    Along with each pusher, the files describing the image it pushes are recorded so
+    images which already exist in their registry can be skipped.
+
+    Args:
+        ctx (ctx): The rule's context object.
+        images (list[Target]): The image push targets of a helm package.
+        output (File): The manifest to write.
+
+    Returns:
+        runfiles: The runfiles of the manifest and every image pusher.
+    """
+    entries = []
+    runfiles = ctx.runfiles([output])
+    for image in images:
+        pusher = image[DefaultInfo].files_to_run.executable
+        entry = {
+            "label": str(image.label),
+            "pusher": rlocationpath(pusher, ctx.workspace_name),
+        }
+        files = [pusher]
+
+        if OciPushRepositoryInfo in image:
+            info = image[OciPushRepositoryInfo]
+            for key, file in [
+                ("repository", info.repository_file),
+                ("oci_layout", info.oci_layout),
+                ("manifest_file", info.manifest_file),
+                ("remote_tags", info.remote_tags_file),
+            ]:
+                if file:
+                    entry[key] = rlocationpath(file, ctx.workspace_name)
+                    files.append(file)
+
+        entries.append(entry)
+        runfiles = runfiles.merge(ctx.runfiles(files)).merge(image[DefaultInfo].default_runfiles)
+
+    ctx.actions.write(
+        output = output,
+        content = json.encode_indent(entries, indent = " " * 4),
+    )
+
+    return runfiles
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suppression silences findings matching a message regex and, optionally, a file
+// glob and policy check.
+type Suppression struct {
+	Message       string `yaml:"message"`
+	File          string `yaml:"file"`
+	Rule          string `yaml:"rule"`
+	Justification string `yaml:"justification"`
+
+	messageRegex *regexp.Regexp
+	fileRegex    *regexp.Regexp
+	matched      bool
+}
+
+// SeverityOverride changes the severity of findings matching a message regex,
+// a file glob or a policy check.
+type SeverityOverride struct {
+	Message  string `yaml:"message"`
+	File     string `yaml:"file"`
+	Rule     string `yaml:"rule"`
+	Severity string `yaml:"severity"`
+
+	messageRegex *regexp.Regexp
+	fileRegex    *regexp.Regexp
+}
+
+// LintConfig is the content of a `helm_lint_test.lint_config` file. Being YAML,
+// JSON files are also accepted.
+type LintConfig struct {
+	Suppressions []*Suppression      `yaml:"suppressions"`
+	Overrides    []*SeverityOverride `yaml:"severity_overrides"`
+}
+
+// globToRegex converts a file glob into a regex. `**` matches across directories,
+// `*` and `?` match within a single path component.
+func globToRegex(glob string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch char := glob[i]; char {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// `**/` also matches no directories at all.
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					builder.WriteString("(?:.*/)?")
+				} else {
+					builder.WriteString(".*")
+				}
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	builder.WriteString("$")
+	return regexp.Compile(builder.String())
+}
+
+// compileMatcher compiles the message regex and file glob shared by suppressions and overrides.
+func compileMatcher(message string, file string) (*regexp.Regexp, *regexp.Regexp, error) {
+	var messageRegex, fileRegex *regexp.Regexp
+	var err error
+
+	if message != "" {
+		messageRegex, err = regexp.Compile(message)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid message regex `%s`: %w", message, err)
+		}
+	}
+
+	if file != "" {
+		fileRegex, err = globToRegex(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid file glob `%s`: %w", file, err)
+		}
+	}
+
+	return messageRegex, fileRegex, nil
+}
+
+func matches(finding Finding, messageRegex *regexp.Regexp, fileRegex *regexp.Regexp, rule string) bool {
+	if rule != "" && finding.Rule != rule {
+		return false
+	}
+	if messageRegex != nil && !messageRegex.MatchString(finding.Message) {
+		return false
+	}
+	if fileRegex != nil && !fileRegex.MatchString(finding.File) {
+		return false
+	}
+	return true
+}
+
+// parseLintConfig parses and validates a lint config.
+func parseLintConfig(content []byte) (*LintConfig, error) {
+	var config LintConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing lint config: %w", err)
+	}
+
+	for i, suppression := range config.Suppressions {
+		if suppression.Message == "" && suppression.Rule == "" {
+			return nil, fmt.Errorf("suppressions[%d]: a `message` regex or `rule` is required", i)
+		}
+		if strings.TrimSpace(suppression.Justification) == "" {
+			return nil, fmt.Errorf("suppressions[%d]: a `justification` is required", i)
+		}
+
+		var err error
+		suppression.messageRegex, suppression.fileRegex, err = compileMatcher(suppression.Message, suppression.File)
+		if err != nil {
+			return nil, fmt.Errorf("suppressions[%d]: %w", i, err)
+		}
+	}
+
+	for i, override := range config.Overrides {
+		override.Severity = strings.ToUpper(override.Severity)
+		switch override.Severity {
+		case SeverityInfo, SeverityWarning, SeverityError:
+		default:
+			return nil, fmt.Errorf("severity_overrides[%d]: unknown severity `%s`", i, override.Severity)
+		}
+		if override.Message == "" && override.File == "" && override.Rule == "" {
+			return nil, fmt.Errorf("severity_overrides[%d]: a `message` regex, `file` glob or `rule` is required", i)
+		}
+
+		var err error
+		override.messageRegex, override.fileRegex, err = compileMatcher(override.Message, override.File)
+		if err != nil {
+			return nil, fmt.Errorf("severity_overrides[%d]: %w", i, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// loadLintConfig reads and parses a lint config file.
+func loadLintConfig(path string) (*LintConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading lint config %s: %w", path, err)
+	}
+
+	config, err := parseLintConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Apply returns findings with severity overrides applied followed by suppressions.
+// The first matching override or suppression wins.
+func (c *LintConfig) Apply(findings []Finding) []Finding {
+	if c == nil {
+		return findings
+	}
+
+	result := make([]Finding, 0, len(findings))
+	for _, finding := range findings {
+		for _, override := range c.Overrides {
+			if matches(finding, override.messageRegex, override.fileRegex, override.Rule) {
+				if finding.Severity != override.Severity {
+					finding.OriginalSeverity = finding.Severity
+					finding.Severity = override.Severity
+				}
+				break
+			}
+		}
+
+		for _, suppression := range c.Suppressions {
+			if matches(finding, suppression.messageRegex, suppression.fileRegex, suppression.Rule) {
+				finding.Suppressed = true
+				finding.Justification = suppression.Justification
+				suppression.matched = true
+				break
+			}
+		}
+
+		result = append(result, finding)
+	}
+
+	return result
+}
+
+// UnusedSuppressions returns the suppressions which did not match any findings.
+func (c *LintConfig) UnusedSuppressions() []*Suppression {
+	if c == nil {
+		return nil
+	}
+
+	var unused []*Suppression
+	for _, suppression := range c.Suppressions {
+		if !suppression.matched {
+			unused = append(unused, suppression)
+		}
+	}
+	return unused
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"templates/*.yaml", "templates/service.yaml", true},
+		{"templates/*.yaml", "templates/vendor/service.yaml", false},
+		{"templates/**/*.yaml", "templates/service.yaml", true},
+		{"templates/**/*.yaml", "templates/vendor/a/service.yaml", true},
+		{"templates/**", "templates/vendor/service.yaml", true},
+		{"Chart.yam?", "Chart.yaml", true},
+		{"Chart.yaml", "Chart_yaml", false},
+	}
+
+	for _, test := range tests {
+		regex, err := globToRegex(test.glob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if regex.MatchString(test.path) != test.matches {
+			t.Errorf("Expected `%s` matching `%s` to be %v", test.glob, test.path, test.matches)
+		}
+	}
+}
+
+func TestLintConfigApply(t *testing.T) {
+	config, err := parseLintConfig([]byte(`
+suppressions:
+  - message: "does not conform to Kubernetes naming"
+    file: "templates/vendor/**"
+    justification: "Vendored upstream templates"
+  - message: "never matches"
+    justification: "Unused"
+severity_overrides:
+  - message: "icon is recommended"
+    severity: warning
+  - file: "templates/vendor/**"
+    severity: INFO
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := config.Apply([]Finding{
+		{Severity: SeverityInfo, File: "Chart.yaml", Message: "icon is recommended"},
+		{Severity: SeverityWarning, File: "templates/vendor/service.yaml", Message: "object name does not conform to Kubernetes naming requirements"},
+		{Severity: SeverityWarning, File: "templates/service.yaml", Message: "object name does not conform to Kubernetes naming requirements"},
+	})
+
+	if findings[0].Severity != SeverityWarning || findings[0].OriginalSeverity != SeverityInfo {
+		t.Errorf("Expected severity to be overridden: %+v", findings[0])
+	}
+	if !findings[1].Suppressed || findings[1].Severity != SeverityInfo || findings[1].Justification != "Vendored upstream templates" {
+		t.Errorf("Expected finding to be suppressed: %+v", findings[1])
+	}
+	if findings[2].Suppressed || !findings[2].Fails(true) {
+		t.Errorf("Expected finding to fail strict linting: %+v", findings[2])
+	}
+
+	unused := config.UnusedSuppressions()
+	if len(unused) != 1 || unused[0].Message != "never matches" {
+		t.Errorf("Unexpected unused suppressions: %v", unused)
+	}
+}
+
+func TestLintReportWithSuppressions(t *testing.T) {
+	config, err := parseLintConfig([]byte(`{"suppressions": [{"message": "naming", "justification": "Known upstream issue"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := []Finding{{Severity: SeverityWarning, File: "templates/service.yaml", Message: "naming"}}
+	report := newLintReport(findings, config, true, errTest("exit status 1"), "Error: 1 chart(s) linted, 1 chart(s) failed", "mychart")
+
+	if !report.Passed || len(report.Findings) != 1 {
+		t.Errorf("Expected suppressed warnings to pass strict linting: %+v", report)
+	}
+}
+
+func TestParseLintConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"justification": `suppressions: [{message: "a"}]`,
+		"message":       `suppressions: [{file: "a", justification: "b"}]`,
+		"invalid":       `suppressions: [{message: "(", justification: "b"}]`,
+		"severity":      `severity_overrides: [{message: "a", severity: "FATAL"}]`,
+	}
+
+	for expected, content := range tests {
+		_, err := parseLintConfig([]byte(content))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error mentioning `%s` for `%s`, got %v", expected, content, err)
+		}
+	}
+}
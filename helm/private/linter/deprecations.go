@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+	"gopkg.in/yaml.v3"
+)
+
+// kubeVersion is a Kubernetes minor release, e.g. `1.29`.
+type kubeVersion struct {
+	Major int
+	Minor int
+}
+
+func (v kubeVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v kubeVersion) less(other kubeVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+func (v kubeVersion) isZero() bool {
+	return v == kubeVersion{}
+}
+
+var kubeVersionRegex = regexp.MustCompile(`^v?(\d+)(?:\.(\d+|x|X|\*))?(?:\.(?:\d+|x|X|\*))?(?:[-+].*)?$`)
+
+// parseKubeVersion parses versions such as `1.29`, `v1.29.3` or `1.29.0-0`.
+func parseKubeVersion(version string) (kubeVersion, error) {
+	match := kubeVersionRegex.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return kubeVersion{}, fmt.Errorf("Invalid Kubernetes version `%s`", version)
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return kubeVersion{Major: major, Minor: minor}, nil
+}
+
+// deprecation describes the lifecycle of an API version of a kind.
+type deprecation struct {
+	GroupVersion string
+	Kind         string
+	DeprecatedIn kubeVersion
+	RemovedIn    kubeVersion
+	Replacement  string
+}
+
+// DeprecationTableVersion is the latest Kubernetes release covered by deprecatedAPIs.
+var DeprecationTableVersion = kubeVersion{1, 32}
+
+// deprecatedAPIs is derived from https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var deprecatedAPIs = []deprecation{
+	// Removed in 1.16
+	{"extensions/v1beta1", "Deployment", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"extensions/v1beta1", "DaemonSet", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"extensions/v1beta1", "ReplicaSet", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", kubeVersion{1, 9}, kubeVersion{1, 16}, "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", kubeVersion{1, 10}, kubeVersion{1, 16}, "policy/v1beta1"},
+	{"apps/v1beta1", "Deployment", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"apps/v1beta1", "StatefulSet", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"apps/v1beta2", "Deployment", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"apps/v1beta2", "DaemonSet", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+	{"apps/v1beta2", "StatefulSet", kubeVersion{1, 9}, kubeVersion{1, 16}, "apps/v1"},
+
+	// Removed in 1.22
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", kubeVersion{1, 16}, kubeVersion{1, 22}, "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", kubeVersion{1, 16}, kubeVersion{1, 22}, "admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", kubeVersion{1, 16}, kubeVersion{1, 22}, "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", kubeVersion{1, 19}, kubeVersion{1, 22}, "apiregistration.k8s.io/v1"},
+	{"authentication.k8s.io/v1beta1", "TokenReview", kubeVersion{1, 19}, kubeVersion{1, 22}, "authentication.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "LocalSubjectAccessReview", kubeVersion{1, 19}, kubeVersion{1, 22}, "authorization.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "SelfSubjectAccessReview", kubeVersion{1, 19}, kubeVersion{1, 22}, "authorization.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "SubjectAccessReview", kubeVersion{1, 19}, kubeVersion{1, 22}, "authorization.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", kubeVersion{1, 19}, kubeVersion{1, 22}, "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease", kubeVersion{1, 19}, kubeVersion{1, 22}, "coordination.k8s.io/v1"},
+	{"extensions/v1beta1", "Ingress", kubeVersion{1, 14}, kubeVersion{1, 22}, "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress", kubeVersion{1, 19}, kubeVersion{1, 22}, "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "IngressClass", kubeVersion{1, 19}, kubeVersion{1, 22}, "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", kubeVersion{1, 17}, kubeVersion{1, 22}, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", kubeVersion{1, 17}, kubeVersion{1, 22}, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", kubeVersion{1, 17}, kubeVersion{1, 22}, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", kubeVersion{1, 17}, kubeVersion{1, 22}, "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", kubeVersion{1, 14}, kubeVersion{1, 22}, "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", kubeVersion{1, 19}, kubeVersion{1, 22}, "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode", kubeVersion{1, 17}, kubeVersion{1, 22}, "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", kubeVersion{1, 19}, kubeVersion{1, 22}, "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", kubeVersion{1, 19}, kubeVersion{1, 22}, "storage.k8s.io/v1"},
+
+	// Removed in 1.25
+	{"batch/v1beta1", "CronJob", kubeVersion{1, 21}, kubeVersion{1, 25}, "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", kubeVersion{1, 21}, kubeVersion{1, 25}, "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "Event", kubeVersion{1, 19}, kubeVersion{1, 25}, "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", kubeVersion{1, 22}, kubeVersion{1, 25}, "autoscaling/v2"},
+	{"policy/v1beta1", "PodDisruptionBudget", kubeVersion{1, 21}, kubeVersion{1, 25}, "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", kubeVersion{1, 21}, kubeVersion{1, 25}, ""},
+	{"node.k8s.io/v1beta1", "RuntimeClass", kubeVersion{1, 20}, kubeVersion{1, 25}, "node.k8s.io/v1"},
+
+	// Removed in 1.26
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", kubeVersion{1, 23}, kubeVersion{1, 26}, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", kubeVersion{1, 23}, kubeVersion{1, 26}, "flowcontrol.apiserver.k8s.io/v1"},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", kubeVersion{1, 23}, kubeVersion{1, 26}, "autoscaling/v2"},
+
+	// Removed in 1.27
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", kubeVersion{1, 24}, kubeVersion{1, 27}, "storage.k8s.io/v1"},
+
+	// Removed in 1.29
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", kubeVersion{1, 26}, kubeVersion{1, 29}, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", kubeVersion{1, 26}, kubeVersion{1, 29}, "flowcontrol.apiserver.k8s.io/v1"},
+
+	// Removed in 1.32
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", kubeVersion{1, 29}, kubeVersion{1, 32}, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", kubeVersion{1, 29}, kubeVersion{1, 32}, "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+func checkDeprecatedAPIs(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation {
+	target := ctx.kubeVersion
+	if target.isZero() {
+		target = DeprecationTableVersion
+	}
+
+	for _, entry := range deprecatedAPIs {
+		if entry.GroupVersion != manifest.APIVersion() || entry.Kind != manifest.Kind() {
+			continue
+		}
+
+		replacement := "it has no replacement"
+		if entry.Replacement != "" {
+			replacement = fmt.Sprintf("use %s instead", entry.Replacement)
+		}
+
+		if !target.less(entry.RemovedIn) {
+			return []policyViolation{policyError("%s %s was removed in Kubernetes %s (targeting %s), %s", entry.GroupVersion, entry.Kind, entry.RemovedIn, target, replacement)}
+		}
+		if !target.less(entry.DeprecatedIn) {
+			return []policyViolation{policyWarning("%s %s is deprecated since Kubernetes %s and removed in %s, %s", entry.GroupVersion, entry.Kind, entry.DeprecatedIn, entry.RemovedIn, replacement)}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+var constraintRegex = regexp.MustCompile(`^(>=|<=|>|<|=|!=|\^|~>?)?v?(\d+)(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:[-+].*)?$`)
+
+// upperBound returns the newest release allowed by a single constraint term and
+// whether the term bounds the version at all.
+func upperBound(term string, latest kubeVersion) (kubeVersion, bool, error) {
+	match := constraintRegex.FindStringSubmatch(term)
+	if match == nil {
+		return kubeVersion{}, false, fmt.Errorf("invalid term `%s`", term)
+	}
+
+	major, _ := strconv.Atoi(match[2])
+	minor, err := strconv.Atoi(match[3])
+	if err != nil && match[3] != "" {
+		// A wildcard minor version (`1.x`) imposes no upper bound on Kubernetes 1.x.
+		return latest, false, nil
+	}
+	version := kubeVersion{Major: major, Minor: minor}
+
+	switch match[1] {
+	case "<":
+		// `<1.30` and `<1.30.0` exclude all of 1.30, `<1.30.2` does not.
+		patch, _ := strconv.Atoi(match[4])
+		if patch > 0 {
+			return version, true, nil
+		}
+		if minor == 0 {
+			return latest, version.Major <= latest.Major, nil
+		}
+		return kubeVersion{Major: major, Minor: minor - 1}, true, nil
+	case "<=", "=", "", "~", "~>":
+		return version, true, nil
+	}
+
+	// `>=`, `>`, `!=` and `^` impose no upper bound on Kubernetes 1.x.
+	return latest, false, nil
+}
+
+// maxSupportedVersion returns the newest Kubernetes release satisfying a Chart.yaml
+// `kubeVersion` constraint (e.g. `>=1.22.0-0 <1.30.0`). Constraints without an upper
+// bound yield latest.
+func maxSupportedVersion(constraint string, latest kubeVersion) (kubeVersion, error) {
+	var result kubeVersion
+
+	for _, alternative := range strings.Split(constraint, "||") {
+		// Hyphen ranges: `1.20 - 1.25`
+		if _, upper, found := strings.Cut(alternative, " - "); found {
+			alternative = "<=" + strings.TrimSpace(upper)
+		}
+
+		// Operators may be separated from their versions by spaces.
+		var terms []string
+		fields := strings.Fields(strings.ReplaceAll(alternative, ",", " "))
+		for i := 0; i < len(fields); i++ {
+			term := fields[i]
+			if strings.Trim(term, "<>=!^~") == "" && i+1 < len(fields) {
+				i++
+				term += fields[i]
+			}
+			terms = append(terms, term)
+		}
+
+		upper := latest
+		for _, term := range terms {
+			candidate, bounded, err := upperBound(term, latest)
+			if err != nil {
+				return kubeVersion{}, fmt.Errorf("Invalid kubeVersion constraint `%s`: %w", constraint, err)
+			}
+			if bounded && candidate.less(upper) {
+				upper = candidate
+			}
+		}
+
+		if result.less(upper) {
+			result = upper
+		}
+	}
+
+	return result, nil
+}
+
+// resolveKubeVersion determines the Kubernetes version to check a chart against. An
+// explicit version takes precedence over the chart's `kubeVersion` constraint.
+func resolveKubeVersion(explicit string, chartDir string) (kubeVersion, error) {
+	if explicit != "" {
+		return parseKubeVersion(explicit)
+	}
+
+	content, err := os.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+	if err != nil {
+		return kubeVersion{}, fmt.Errorf("Error reading Chart.yaml: %w", err)
+	}
+
+	var chart struct {
+		KubeVersion string `yaml:"kubeVersion"`
+	}
+	if err := yaml.Unmarshal(content, &chart); err != nil {
+		return kubeVersion{}, fmt.Errorf("Error parsing Chart.yaml: %w", err)
+	}
+
+	if chart.KubeVersion == "" {
+		return DeprecationTableVersion, nil
+	}
+
+	return maxSupportedVersion(chart.KubeVersion, DeprecationTableVersion)
+}
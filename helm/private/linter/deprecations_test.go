@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+func TestMaxSupportedVersion(t *testing.T) {
+	latest := kubeVersion{1, 32}
+	tests := map[string]kubeVersion{
+		">=1.22.0-0 <1.30.0":  {1, 29},
+		">= 1.22.0-0, < 1.28": {1, 27},
+		"<1.30.2":             {1, 30},
+		"<=1.26":              {1, 26},
+		">=1.19.0-0":          {1, 32},
+		"^1.25":               {1, 32},
+		"~1.26":               {1, 26},
+		"1.20 - 1.25":         {1, 25},
+		"<1.21 || >=1.24":     {1, 32},
+		"<1.21 || <=1.23.4":   {1, 23},
+		"v1.27.x":             {1, 27},
+	}
+
+	for constraint, expected := range tests {
+		version, err := maxSupportedVersion(constraint, latest)
+		if err != nil {
+			t.Errorf("Unexpected error for `%s`: %v", constraint, err)
+			continue
+		}
+		if version != expected {
+			t.Errorf("Expected %s for `%s`, got %s", expected, constraint, version)
+		}
+	}
+
+	if _, err := maxSupportedVersion(">=banana", latest); err == nil {
+		t.Error("Expected an error for an invalid constraint")
+	}
+}
+
+func TestResolveKubeVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: mychart\nkubeVersion: \">=1.20.0-0 <1.25.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := resolveKubeVersion("", dir)
+	if err != nil || version != (kubeVersion{1, 24}) {
+		t.Errorf("Expected 1.24 from Chart.yaml, got %s: %v", version, err)
+	}
+
+	version, err = resolveKubeVersion("v1.29.3", dir)
+	if err != nil || version != (kubeVersion{1, 29}) {
+		t.Errorf("Expected the explicit version 1.29, got %s: %v", version, err)
+	}
+}
+
+func TestCheckDeprecatedAPIs(t *testing.T) {
+	manifests, err := helm_utils.ParseManifests(`---
+# Source: mychart/templates/hpa.yaml
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+---
+# Source: mychart/templates/cronjob.yaml
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version  kubeVersion
+		severity string
+	}{
+		{kubeVersion{1, 22}, ""},
+		{kubeVersion{1, 23}, SeverityWarning},
+		{kubeVersion{1, 26}, SeverityError},
+	}
+
+	for _, test := range tests {
+		findings := runPolicyChecks("mychart", policyContext{kubeVersion: test.version}, manifests, []string{"deprecated_apis"})
+		if test.severity == "" {
+			if len(findings) != 0 {
+				t.Errorf("Expected no findings for %s, got %v", test.version, findings)
+			}
+			continue
+		}
+		if len(findings) != 1 || findings[0].Severity != test.severity || findings[0].File != "templates/hpa.yaml" {
+			t.Errorf("Expected a single %s for %s, got %v", test.severity, test.version, findings)
+		}
+	}
+}
+
+// writeCapabilitiesHelm writes a stand-in for helm which logs its arguments and renders a
+// chart gated on the Kubernetes version, like:
+//
+//	{{- if semverCompare ">=1.21-0" .Capabilities.KubeVersion.GitVersion }}
+//	apiVersion: batch/v1
+//	{{- else }}
+//	apiVersion: batch/v1beta1
+//	{{- end }}
+//	kind: CronJob
+//
+// Without `--kube-version` it renders for Kubernetes 1.20.
+func writeCapabilitiesHelm(t *testing.T, dir string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	path := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(dir, "log") + `"
+if [ "$1" = "template" ]; then
+  version=v1.20.0
+  while [ $# -gt 0 ]; do
+    if [ "$1" = "--kube-version" ]; then
+      version="$2"
+    fi
+    shift
+  done
+  if [ "$(echo "$version" | cut -d. -f2)" -lt 21 ]; then
+    api=batch/v1beta1
+  else
+    api=batch/v1
+  fi
+  printf -- '---\n# Source: mychart/templates/cronjob.yaml\napiVersion: %s\nkind: CronJob\nmetadata:\n  name: cleanup\n' "$api"
+fi
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLintScenarioRendersForKubeVersion(t *testing.T) {
+	for _, version := range []kubeVersion{{1, 20}, {1, 25}} {
+		dir := t.TempDir()
+		helm := writeCapabilitiesHelm(t, dir)
+
+		policyCtx := policyContext{kubeVersion: version}
+		_, _, report, err := lintScenario(dir, "mychart", helm, dir, []string{"mychart"}, Scenario{}, false, false, []string{"deprecated_apis"}, policyCtx, nil, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Findings) != 0 {
+			t.Errorf("Expected the CronJob rendered for %s to be supported, got %v", version, report.Findings)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, "log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"lint mychart --kube-version v" + version.String(),
+			"template mychart --kube-version v" + version.String(),
+		}
+		if actual := strings.TrimSpace(string(content)); actual != strings.Join(expected, "\n") {
+			t.Errorf("Unexpected helm commands:\n%s", actual)
+		}
+	}
+}
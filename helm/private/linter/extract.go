@@ -0,0 +1,328 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isWithin reports whether path is root or a descendant of it. Both paths must be clean.
+func isWithin(root string, path string) bool {
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) && !filepath.IsAbs(relative)
+}
+
+// archivePath validates the name of a tar entry and returns its location within targetDir
+// along with the chart directory (the top-level directory) containing it.
+func archivePath(targetDir string, name string) (string, string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", "", fmt.Errorf("Archive entry `%s` has an absolute path", name)
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(slashed))
+	if clean == "." {
+		return targetDir, targetDir, nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("Archive entry `%s` is outside of the extraction directory", name)
+	}
+
+	topLevel, _, _ := strings.Cut(clean, string(filepath.Separator))
+
+	return filepath.Join(targetDir, clean), filepath.Join(targetDir, topLevel), nil
+}
+
+// ensureParent creates the parent directories of path and ensures that, after resolving
+// any symlinks, they remain within root.
+func ensureParent(root string, path string) error {
+	parent := filepath.Dir(path)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return err
+	}
+	if !isWithin(resolvedRoot, resolved) {
+		return fmt.Errorf("Archive entry `%s` resolves outside of the extraction directory", path)
+	}
+
+	return nil
+}
+
+// extractFile writes a single regular file, closing it as soon as it's written.
+func extractFile(path string, reader io.Reader, mode os.FileMode) error {
+	// Replace rather than write through anything already at the path.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode|0200)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// Apply the exact mode, unaffected by the umask.
+	return os.Chmod(path, mode)
+}
+
+// link is a symlink or hardlink whose creation is deferred until all other entries
+// are extracted so that no entry can be written through a link.
+type link struct {
+	header *tar.Header
+	path   string
+	chart  string
+}
+
+// extractPackage extracts a helm package (a `.tgz` file) into targetDir. Entries must be
+// contained within targetDir and links may only refer to files within the chart directory
+// containing them.
+func extractPackage(sourcePath string, targetDir string) error {
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	root, err := filepath.Abs(targetDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+
+	var links []link
+	var directories []*tar.Header
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		targetPath, chartDir, err := archivePath(root, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := ensureParent(root, targetPath); err != nil {
+				return err
+			}
+			// Directories must remain writable while extracting. Their modes are applied at the end.
+			if err := os.MkdirAll(targetPath, 0755); err != nil {
+				return err
+			}
+			directories = append(directories, header)
+
+		case tar.TypeReg:
+			if err := ensureParent(root, targetPath); err != nil {
+				return err
+			}
+			if err := extractFile(targetPath, tarReader, header.FileInfo().Mode().Perm()); err != nil {
+				return fmt.Errorf("Error extracting %s: %w", header.Name, err)
+			}
+
+		case tar.TypeSymlink, tar.TypeLink:
+			links = append(links, link{header: header, path: targetPath, chart: chartDir})
+
+		case tar.TypeXGlobalHeader:
+			continue
+
+		default:
+			return fmt.Errorf("Unsupported tar entry type for %s: %c", header.Name, header.Typeflag)
+		}
+	}
+
+	for _, entry := range links {
+		if err := extractLink(root, entry); err != nil {
+			return err
+		}
+	}
+
+	// Links are checked lexically as they're created, but a chain of links can still
+	// escape once all of them exist, so every symlink is resolved again.
+	for _, entry := range links {
+		if entry.header.Typeflag != tar.TypeSymlink {
+			continue
+		}
+		if err := verifySymlink(root, entry); err != nil {
+			return err
+		}
+	}
+
+	// Apply directory modes last, deepest first, so restrictive modes do not prevent extraction.
+	for i := len(directories) - 1; i >= 0; i-- {
+		targetPath, _, _ := archivePath(root, directories[i].Name)
+		if err := os.Chmod(targetPath, directories[i].FileInfo().Mode().Perm()|0700); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractLink creates a symlink or hardlink after ensuring its target is within the chart.
+func extractLink(root string, entry link) error {
+	header := entry.header
+
+	if err := ensureParent(root, entry.path); err != nil {
+		return err
+	}
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if header.Typeflag == tar.TypeSymlink {
+		target := filepath.FromSlash(header.Linkname)
+		if filepath.IsAbs(target) || strings.HasPrefix(header.Linkname, "/") {
+			return fmt.Errorf("Symlink %s has an absolute target `%s`", header.Name, header.Linkname)
+		}
+		resolved := filepath.Join(filepath.Dir(entry.path), target)
+		if !isWithin(entry.chart, resolved) {
+			return fmt.Errorf("Symlink %s points outside of the chart: `%s`", header.Name, header.Linkname)
+		}
+		return os.Symlink(target, entry.path)
+	}
+
+	// Hardlink names are relative to the root of the archive.
+	targetPath, _, err := archivePath(root, header.Linkname)
+	if err != nil {
+		return err
+	}
+	if !isWithin(entry.chart, targetPath) {
+		return fmt.Errorf("Hardlink %s points outside of the chart: `%s`", header.Name, header.Linkname)
+	}
+
+	// The target may be reached through symlinks, so it's checked again once resolved.
+	resolved, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		return fmt.Errorf("Hardlink %s points to a missing file `%s`: %w", header.Name, header.Linkname, err)
+	}
+	chart, err := resolvedChart(root, entry.chart)
+	if err != nil {
+		return err
+	}
+	if !isWithin(chart, resolved) {
+		return fmt.Errorf("Hardlink %s resolves outside of the chart: `%s`", header.Name, header.Linkname)
+	}
+	info, err := os.Lstat(resolved)
+	if err != nil {
+		return fmt.Errorf("Hardlink %s points to a missing file `%s`: %w", header.Name, header.Linkname, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("Hardlink %s must point to a regular file: `%s`", header.Name, header.Linkname)
+	}
+
+	return os.Link(resolved, entry.path)
+}
+
+// resolvedChart returns the location of a chart directory with any symlinks in root resolved.
+// The chart directory itself is not resolved as it may be a link.
+func resolvedChart(root string, chart string) (string, error) {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(root, chart)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedRoot, relative), nil
+}
+
+// verifySymlink ensures a symlink, with every link along its path resolved, refers to a
+// location within its chart. Dangling links are allowed as they cannot expose anything.
+func verifySymlink(root string, entry link) error {
+	chart, err := resolvedChart(root, entry.chart)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := filepath.EvalSymlinks(entry.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil && isWithin(chart, resolved) {
+		return nil
+	}
+
+	// Remove the link so nothing can read through it.
+	os.Remove(entry.path)
+	if err != nil {
+		return fmt.Errorf("Error resolving symlink %s: %w", entry.header.Name, err)
+	}
+	return fmt.Errorf("Symlink %s resolves outside of the chart: `%s`", entry.header.Name, entry.header.Linkname)
+}
+
+// findPackageRoot returns the name of the chart directory within an extracted package,
+// identified as the only top-level directory containing a `Chart.yaml`. Other top-level
+// entries are ignored.
+func findPackageRoot(extractDir string) (string, error) {
+	entries, err := os.ReadDir(extractDir)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	var roots []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(extractDir, entry.Name(), "Chart.yaml"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		if info.Mode().IsRegular() {
+			roots = append(roots, entry.Name())
+		}
+	}
+
+	switch len(roots) {
+	case 0:
+		return "", fmt.Errorf("No top-level chart directory containing a Chart.yaml was found in the package. Found: [%s]", strings.Join(names, ", "))
+	case 1:
+		return roots[0], nil
+	default:
+		return "", fmt.Errorf("The package root is ambiguous, multiple top-level directories contain a Chart.yaml: [%s]", strings.Join(roots, ", "))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeArchive writes a `.tgz` file containing the given entries.
+func writeArchive(t *testing.T, headers []*tar.Header, contents map[string]string) string {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range headers {
+		content := contents[header.Name]
+		header.Size = int64(len(content))
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "chart.tgz")
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractPackage(t *testing.T) {
+	archive := writeArchive(t, []*tar.Header{
+		{Name: "mychart/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "mychart/Chart.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "mychart/scripts/run.sh", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "mychart/templates/_shared.tpl", Typeflag: tar.TypeSymlink, Linkname: "../shared.tpl"},
+		{Name: "mychart/shared.tpl", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "mychart/values.yaml", Typeflag: tar.TypeLink, Linkname: "mychart/Chart.yaml"},
+	}, map[string]string{
+		"mychart/Chart.yaml":     "name: mychart\n",
+		"mychart/scripts/run.sh": "#!/bin/sh\n",
+		"mychart/shared.tpl":     "{{/* shared */}}\n",
+	})
+
+	dir := t.TempDir()
+	if err := extractPackage(archive, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "mychart/scripts/run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Expected executable mode to be preserved, got %v", info.Mode())
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "mychart/templates/_shared.tpl"))
+	if err != nil || string(content) != "{{/* shared */}}\n" {
+		t.Errorf("Unexpected symlink content %q: %v", content, err)
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, "mychart/values.yaml"))
+	if err != nil || string(content) != "name: mychart\n" {
+		t.Errorf("Unexpected hardlink content %q: %v", content, err)
+	}
+}
+
+func TestExtractPackageRejectsEscapes(t *testing.T) {
+	tests := map[string][]*tar.Header{
+		"outside": {
+			{Name: "mychart/../../evil.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"absolute": {
+			{Name: "/tmp/evil.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"points outside": {
+			{Name: "mychart/templates/evil.yaml", Typeflag: tar.TypeSymlink, Linkname: "../../other/secret"},
+		},
+		"absolute target": {
+			{Name: "mychart/templates/evil.yaml", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		},
+		"Hardlink": {
+			{Name: "other/secret", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "mychart/secret", Typeflag: tar.TypeLink, Linkname: "other/secret"},
+		},
+		"Symlink mychart/z resolves outside": {
+			{Name: "mychart/x/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "mychart/x/y", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "mychart/z", Typeflag: tar.TypeSymlink, Linkname: "x/y/../.."},
+		},
+		"Symlink mychart/a resolves outside": {
+			{Name: "mychart/x/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "mychart/a", Typeflag: tar.TypeSymlink, Linkname: "x/y/../.."},
+			{Name: "mychart/x/y", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		},
+		"Hardlink mychart/h resolves outside": {
+			{Name: "other/secret", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "mychart/x/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "mychart/x/y", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "mychart/z", Typeflag: tar.TypeSymlink, Linkname: "x/y/.."},
+			{Name: "mychart/h", Typeflag: tar.TypeLink, Linkname: "mychart/z/other/secret"},
+		},
+		"Unsupported": {
+			{Name: "mychart/fifo", Typeflag: tar.TypeFifo, Mode: 0644},
+		},
+	}
+
+	for expected, headers := range tests {
+		t.Run(expected, func(t *testing.T) {
+			archive := writeArchive(t, headers, nil)
+			err := extractPackage(archive, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected an error mentioning `%s`, got %v", expected, err)
+			}
+		})
+	}
+}
+
+func TestFindPackageRoot(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"README.md", "aaa/notes.txt", "mychart/Chart.yaml", "mychart/charts/sub/Chart.yaml", "zzz/Chart.yaml/values.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := findPackageRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != "mychart" {
+		t.Errorf("Expected the root `mychart`, got `%s`", root)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other/Chart.yaml"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findPackageRoot(dir); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected an ambiguous root error, got: %v", err)
+	}
+
+	if _, err := findPackageRoot(t.TempDir()); err == nil {
+		t.Error("Expected an error for a package without a chart")
+	}
+}
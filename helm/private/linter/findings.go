@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// Severities reported by `helm lint`.
+const (
+	SeverityInfo    = "INFO"
+	SeverityWarning = "WARNING"
+	SeverityError   = "ERROR"
+)
+
+// Finding is a single message reported by `helm lint`.
+type Finding struct {
+	Severity string `json:"severity"`
+	Chart    string `json:"chart"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+
+	// The policy check which produced the finding. Empty for findings from `helm lint`.
+	Rule string `json:"rule,omitempty"`
+
+	// The scenario the chart was linted with. Empty for the test's own values.
+	Scenario string `json:"scenario,omitempty"`
+
+	// Set when a lint config changed the severity reported by helm.
+	OriginalSeverity string `json:"original_severity,omitempty"`
+
+	// Set when a lint config suppressed the finding.
+	Suppressed    bool   `json:"suppressed,omitempty"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// LintReport is the machine-readable result of linting a chart.
+type LintReport struct {
+	Strict    bool             `json:"strict"`
+	Passed    bool             `json:"passed"`
+	Scenarios []ScenarioResult `json:"scenarios,omitempty"`
+	Findings  []Finding        `json:"findings"`
+}
+
+var (
+	// `==> Linting path/to/chart`
+	lintHeaderRegex = regexp.MustCompile(`^==> Linting (.+)$`)
+
+	// `[WARNING] templates/deployment.yaml: message`
+	findingRegex = regexp.MustCompile(`^\[(INFO|WARNING|ERROR)\] (?:([^\s:]+): )?(.*)$`)
+
+	// Template errors name the failing template relative to the chart's parent:
+	// `template: chart/templates/deployment.yaml:12:3: executing ...`
+	templateLocationRegex = regexp.MustCompile(`template: [^/\s]+/([^\s:]+):(\d+)(?::\d+)?:`)
+
+	// YAML errors: `error converting YAML to JSON: yaml: line 12: ...`
+	yamlLineRegex = regexp.MustCompile(`yaml: line (\d+):`)
+)
+
+// locate refines a finding's file and line from details embedded in its message.
+func (f *Finding) locate() {
+	if match := templateLocationRegex.FindStringSubmatch(f.Message); match != nil {
+		f.File = match[1]
+		f.Line, _ = strconv.Atoi(match[2])
+		return
+	}
+
+	if match := yamlLineRegex.FindStringSubmatch(f.Message); match != nil {
+		f.Line, _ = strconv.Atoi(match[1])
+	}
+}
+
+// Fails reports whether the finding should fail linting.
+func (f Finding) Fails(strict bool) bool {
+	if f.Suppressed {
+		return false
+	}
+	return f.Severity == SeverityError || (strict && f.Severity == SeverityWarning)
+}
+
+// parseFindings parses the stdout of `helm lint` into the names of the linted
+// charts and their findings. Lines which do not start a finding are treated as
+// the continuation of the previous one.
+func parseFindings(output string) ([]string, []Finding) {
+	charts := []string{}
+	findings := []Finding{}
+	chart := ""
+	var current *Finding
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if match := lintHeaderRegex.FindStringSubmatch(line); match != nil {
+			chart = filepath.Base(strings.TrimSpace(match[1]))
+			charts = append(charts, chart)
+			current = nil
+			continue
+		}
+
+		if match := findingRegex.FindStringSubmatch(line); match != nil {
+			findings = append(findings, Finding{
+				Severity: match[1],
+				Chart:    chart,
+				File:     match[2],
+				Message:  match[3],
+			})
+			current = &findings[len(findings)-1]
+			continue
+		}
+
+		// A blank line or the closing summary ends the current finding.
+		if current == nil || strings.TrimSpace(line) == "" || strings.Contains(line, "chart(s) linted") {
+			current = nil
+			continue
+		}
+
+		current.Message += "\n" + line
+	}
+
+	for i := range findings {
+		findings[i].locate()
+	}
+
+	return charts, findings
+}
+
+// newLintReport applies config to findings and summarizes the result. A lint failure
+// not explained by any of helm's findings (e.g. helm failing to start) is recorded as
+// an error finding using detail.
+func newLintReport(findings []Finding, config *LintConfig, strict bool, lintErr error, detail string, chart string) LintReport {
+	report := LintReport{
+		Strict:   strict,
+		Passed:   true,
+		Findings: config.Apply(findings),
+	}
+
+	explained := false
+	for _, finding := range findings {
+		if finding.Rule == "" && finding.Fails(strict) {
+			explained = true
+		}
+	}
+
+	for _, finding := range report.Findings {
+		if finding.Fails(strict) {
+			report.Passed = false
+		}
+	}
+
+	if lintErr != nil && !explained {
+		message := strings.TrimSpace(detail)
+		if message == "" {
+			message = lintErr.Error()
+		}
+		report.Findings = append(report.Findings, Finding{
+			Severity: SeverityError,
+			Chart:    chart,
+			Message:  message,
+		})
+		report.Passed = false
+	}
+
+	return report
+}
+
+// writeJSONReport writes the report as indented JSON to path.
+func writeJSONReport(path string, report LintReport) error {
+	content, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return fmt.Errorf("Error encoding lint report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("Error writing lint report %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// describe renders a finding as a single human readable line.
+func (f Finding) describe() string {
+	location := f.File
+	if location == "" {
+		location = f.Chart
+	}
+	if f.Scenario != "" {
+		location = fmt.Sprintf("[%s] %s", f.Scenario, location)
+	}
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, f.Line)
+	}
+	description := fmt.Sprintf("[%s] %s: %s", f.Severity, location, f.Message)
+	if f.Rule != "" {
+		description = fmt.Sprintf("[%s] %s: (%s) %s", f.Severity, location, f.Rule, f.Message)
+	}
+	if f.Suppressed {
+		description += fmt.Sprintf(" (suppressed: %s)", f.Justification)
+	}
+	return description
+}
+
+// junitReport converts a lint report into JUnit test suites. Each chart (per scenario)
+// is a suite and each file with findings is a test case which fails if any of its
+// findings fail linting. A suite without findings is a single passing case.
+func junitReport(name string, report LintReport, suiteNames []string) helm_utils.JUnitTestSuites {
+	type fileFindings struct {
+		file     string
+		findings []Finding
+	}
+
+	suiteOrder := []string{}
+	suites := map[string][]*fileFindings{}
+	addSuite := func(chart string) {
+		if _, exists := suites[chart]; !exists {
+			suiteOrder = append(suiteOrder, chart)
+			suites[chart] = nil
+		}
+	}
+
+	for _, suite := range suiteNames {
+		addSuite(suite)
+	}
+
+	for _, finding := range report.Findings {
+		suite := suiteName(finding.Chart, finding.Scenario)
+		addSuite(suite)
+
+		file := finding.File
+		if file == "" {
+			file = "(chart)"
+		}
+
+		var entry *fileFindings
+		for _, existing := range suites[suite] {
+			if existing.file == file {
+				entry = existing
+				break
+			}
+		}
+		if entry == nil {
+			entry = &fileFindings{file: file}
+			suites[suite] = append(suites[suite], entry)
+		}
+		entry.findings = append(entry.findings, finding)
+	}
+
+	junit := helm_utils.JUnitTestSuites{Name: name}
+	for _, name := range suiteOrder {
+		suite := helm_utils.JUnitTestSuite{Name: name}
+
+		if len(suites[name]) == 0 {
+			suite.TestCases = append(suite.TestCases, helm_utils.JUnitTestCase{
+				Name:      "helm lint",
+				ClassName: name,
+			})
+		}
+
+		for _, entry := range suites[name] {
+			testCase := helm_utils.JUnitTestCase{
+				Name:      entry.file,
+				ClassName: name,
+			}
+
+			var failures []string
+			var others []string
+			for _, finding := range entry.findings {
+				if finding.Fails(report.Strict) {
+					failures = append(failures, finding.describe())
+				} else {
+					others = append(others, finding.describe())
+				}
+			}
+
+			if len(failures) > 0 {
+				testCase.Failure = &helm_utils.JUnitFailure{
+					Message: fmt.Sprintf("%d lint finding(s) in %s", len(failures), entry.file),
+					Type:    "HelmLint",
+					Content: strings.Join(failures, "\n"),
+				}
+			}
+			if len(others) > 0 {
+				testCase.SystemOut = strings.Join(others, "\n")
+			}
+
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+
+		junit.Suites = append(junit.Suites, suite)
+	}
+
+	return junit
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+const lintOutput = `==> Linting /tmp/rules_helm_lint/mychart
+[INFO] Chart.yaml: icon is recommended
+[WARNING] templates/service.yaml: object name does not conform to Kubernetes naming requirements
+[ERROR] templates/: template: mychart/templates/deployment.yaml:12:3: executing "mychart/templates/deployment.yaml" at <.Values.missing.key>: nil pointer evaluating interface {}.key
+[ERROR] templates/configmap.yaml: unable to parse YAML: error converting YAML to JSON: yaml: line 4: did not find expected key
+
+Error: 1 chart(s) linted, 1 chart(s) failed
+`
+
+func TestParseFindings(t *testing.T) {
+	charts, findings := parseFindings(lintOutput)
+
+	if !reflect.DeepEqual(charts, []string{"mychart"}) {
+		t.Errorf("Unexpected charts: %v", charts)
+	}
+
+	expected := []Finding{
+		{Severity: SeverityInfo, Chart: "mychart", File: "Chart.yaml", Message: "icon is recommended"},
+		{Severity: SeverityWarning, Chart: "mychart", File: "templates/service.yaml", Message: "object name does not conform to Kubernetes naming requirements"},
+		{Severity: SeverityError, Chart: "mychart", File: "templates/deployment.yaml", Line: 12},
+		{Severity: SeverityError, Chart: "mychart", File: "templates/configmap.yaml", Line: 4},
+	}
+
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %d: %v", len(expected), len(findings), findings)
+	}
+
+	for i, want := range expected {
+		got := findings[i]
+		if want.Message == "" {
+			// Only compare the location of long messages.
+			got.Message = ""
+		}
+		if got != want {
+			t.Errorf("Finding %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestLintReport(t *testing.T) {
+	charts, findings := parseFindings(lintOutput)
+
+	if newLintReport(findings[:2], nil, false, nil, "", "mychart").Passed != true {
+		t.Error("Warnings should not fail a non-strict lint")
+	}
+	if newLintReport(findings[:2], nil, true, nil, "", "mychart").Passed != false {
+		t.Error("Warnings should fail a strict lint")
+	}
+
+	report := newLintReport(findings, nil, false, nil, "", "mychart")
+	junit := junitReport("mychart.tgz", report, charts)
+	content, err := helm_utils.MarshalJUnitReport(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fragment := range []string{
+		`<testsuites name="mychart.tgz" tests="4" failures="2"`,
+		`<testsuite name="mychart" tests="4" failures="2"`,
+		`<testcase name="templates/deployment.yaml" classname="mychart" time="0">`,
+		`<system-out>[INFO] Chart.yaml: icon is recommended</system-out>`,
+	} {
+		if !strings.Contains(string(content), fragment) {
+			t.Errorf("Expected JUnit report to contain `%s`:\n%s", fragment, content)
+		}
+	}
+}
+
+func TestLintReportWithoutFindings(t *testing.T) {
+	report := newLintReport(nil, nil, false, errTest("exit status 1"), "Error: unable to load chart\n", "mychart")
+
+	if report.Passed {
+		t.Error("A failed lint should not pass")
+	}
+	if len(report.Findings) != 1 || report.Findings[0].Message != "Error: unable to load chart" {
+		t.Errorf("Unexpected findings: %v", report.Findings)
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string {
+	return string(e)
+}
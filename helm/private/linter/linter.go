@@ -1,16 +1,15 @@
 package main
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/abrisco/rules_helm/helm/private/helm_utils"
@@ -36,6 +35,14 @@ type Arguments struct {
 	helmPlugins   string
 	pkg           string
 	output        string
+	report        string
+	config        string
+	policyChecks  stringSliceFlag
+	scenarios     string
+	kubeVersion   string
+	schemas       stringSliceFlag
+	strictSchemas bool
+	withSubcharts bool
 }
 
 func makeAbsolutePath(path string) string {
@@ -59,6 +66,14 @@ func parse_args() Arguments {
 	flag.StringVar(&args.helmPlugins, "helm_plugins", "", "The path to a helm plugins directory")
 	flag.StringVar(&args.output, "output", "", "The path to the Bazel `HelmPackage` action output")
 	flag.StringVar(&args.pkg, "package", "", "The path to the helm package to lint.")
+	flag.StringVar(&args.report, "report", "", "The path to write a JSON report of lint findings to.")
+	flag.StringVar(&args.config, "config", "", "The path to a lint config of suppressions and severity overrides.")
+	flag.Var(&args.policyChecks, "policy_check", "The name of a policy check to run on the rendered chart.")
+	flag.StringVar(&args.scenarios, "scenarios", "", "The path to a JSON file of named values scenarios to lint.")
+	flag.StringVar(&args.kubeVersion, "kube_version", "", "The Kubernetes version to check deprecated APIs against.")
+	flag.Var(&args.schemas, "schema", "A JSON schema, OpenAPI document or CRD to validate rendered objects with.")
+	flag.BoolVar(&args.strictSchemas, "strict_schemas", false, "Fail on rendered objects without a schema.")
+	flag.BoolVar(&args.withSubcharts, "with_subcharts", false, "Lint the subcharts of the chart as well.")
 
 	args_file, found := os.LookupEnv("RULES_HELM_HELM_LINT_TEST_ARGS_PATH")
 	if found {
@@ -76,107 +91,78 @@ func parse_args() Arguments {
 	return args
 }
 
-func extractPackage(sourcePath string, targetDir string) error {
-	// Open the tar.gz file for reading
-	file, err := os.Open(sourcePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Create a gzip reader
-	gzipReader, err := gzip.NewReader(file)
+// lint runs `helm lint` and returns its stdout, the linted charts, the findings and
+// any details helm wrote to stderr. The error of the helm process is returned to
+// allow reports to be written before exiting.
+func lint(directory string, helm string, helmArgs []string, helmPluginsDir string) (string, []string, []Finding, string, error) {
+	cmd, err := helm_utils.BuildHelmCommand(helm, helmArgs, helmPluginsDir)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-	defer gzipReader.Close()
-
-	// Create a tar reader
-	tarReader := tar.NewReader(gzipReader)
 
-	// Iterate through the tar entries and extract them
-	for {
-		header, err := tarReader.Next()
+	cmd.Dir = directory
 
-		if err == io.EOF {
-			break
-		}
+	out, lintErr := cmd.Output()
+	os.Stderr.WriteString(string(out))
 
-		if err != nil {
-			return err
-		}
+	detail := ""
+	if exitErr, ok := lintErr.(*exec.ExitError); ok {
+		detail = string(exitErr.Stderr)
+		os.Stderr.WriteString(detail)
+	}
 
-		// Construct the target file path
-		targetFilePath := filepath.Join(targetDir, header.Name)
+	charts, findings := parseFindings(string(out))
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			// Create directories if they don't exist
-			err = os.MkdirAll(targetFilePath, 0755)
-			if err != nil {
-				return err
-			}
-
-		case tar.TypeReg:
-			// Ensure the file's parents exist
-			if err := os.MkdirAll(filepath.Dir(targetFilePath), 0755); err != nil {
-				return err
-			}
-			// Create the file
-			file, err := os.Create(targetFilePath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	return string(out), charts, findings, detail, lintErr
+}
 
-			// Copy the file contents
-			_, err = io.Copy(file, tarReader)
-			if err != nil {
-				return err
-			}
+// lintScenario runs `helm lint` and any policy checks for a single scenario.
+func lintScenario(dir string, lintDir string, helm string, helmPlugins string, chartArgs []string, scenario Scenario, strict bool, withSubcharts bool, policyChecks []string, policyCtx policyContext, schemas *SchemaIndex, strictSchemas bool, config *LintConfig) (string, []string, LintReport, error) {
+	// Scenarios follow the test's own values so they take precedence.
+	chartArgs = append(append([]string{}, chartArgs...), scenario.args()...)
 
-		default:
-			return fmt.Errorf("Unsupported tar entry type: %c", header.Typeflag)
-		}
+	// Render for the version deprecated APIs are checked against so templates depending on
+	// `.Capabilities.KubeVersion` produce the objects which would be deployed.
+	if !policyCtx.kubeVersion.isZero() {
+		chartArgs = append(chartArgs, "--kube-version", "v"+policyCtx.kubeVersion.String())
 	}
 
-	return nil
-}
-
-func find_package_root(extract_dir string) string {
-	// After the package is extracted, there should be one directory within it.
-	// locate this and return it for linting
-	dir, err := os.Open(extract_dir)
-	if err != nil {
-		log.Fatal(err)
-	}
-	file_info, err := dir.Readdir(-1)
-	if err != nil {
-		log.Fatal(err)
+	helmArgs := append([]string{"lint"}, chartArgs...)
+	if strict {
+		helmArgs = append(helmArgs, "--strict")
 	}
-	defer dir.Close()
-
-	if len(file_info) == 0 {
-		log.Fatal("Unexpected number of files for", file_info)
+	if withSubcharts {
+		helmArgs = append(helmArgs, "--with-subcharts")
 	}
 
-	return file_info[0].Name()
-}
+	out, charts, findings, detail, lintErr := lint(dir, helm, helmArgs, helmPlugins)
 
-func lint(directory string, helm string, helmArgs []string, helmPluginsDir string, output string) {
-	cmd, err := helm_utils.BuildHelmCommand(helm, helmArgs, helmPluginsDir)
-	if err != nil {
-		log.Fatal(err)
+	if len(policyChecks) > 0 || schemas != nil {
+		manifests, err := renderManifests(dir, helm, chartArgs, helmPlugins)
+		if err != nil {
+			findings = append(findings, Finding{
+				Severity: SeverityError,
+				Chart:    lintDir,
+				Rule:     "render",
+				Message:  err.Error(),
+			})
+		} else {
+			findings = append(findings, runPolicyChecks(lintDir, policyCtx, manifests, policyChecks)...)
+			if schemas != nil {
+				findings = append(findings, runSchemaValidation(lintDir, schemas, manifests, strictSchemas)...)
+			}
+		}
 	}
 
-	cmd.Dir = directory
-
-	out, err := cmd.Output()
-	os.Stderr.WriteString(string(out))
-	if err != nil {
-		log.Fatal(err)
+	report := newLintReport(findings, config, strict, lintErr, detail, lintDir)
+	for i := range report.Findings {
+		report.Findings[i].Scenario = scenario.Name
 	}
 
+	return out, charts, report, lintErr
+}
+
+func writeOutput(output string, out string) {
 	if len(output) > 0 {
 		parent := filepath.Dir(output)
 		dir_err := os.MkdirAll(parent, 0755)
@@ -189,7 +175,7 @@ func lint(directory string, helm string, helmArgs []string, helmPluginsDir strin
 		}
 		defer f.Close()
 
-		_, write_err := f.Write(out)
+		_, write_err := f.WriteString(out)
 		if write_err != nil {
 			log.Fatal(write_err)
 		}
@@ -250,33 +236,152 @@ func main() {
 	var helm = args.helm
 	var helmPlugins = args.helmPlugins
 	var valuesFiles = args.values
+	var configFile = args.config
+	var scenariosFile = args.scenarios
+	var schemaFiles = args.schemas
+	var resolvePath = makeAbsolutePath
 	if is_test {
+		resolvePath = helm_utils.GetRunfile
 		pkg = helm_utils.GetRunfile(pkg)
 		helm = helm_utils.GetRunfile(helm)
 		helmPlugins = helm_utils.GetRunfile(helmPlugins)
 		transformStringSlice(valuesFiles, helm_utils.GetRunfile)
+		transformStringSlice(schemaFiles, helm_utils.GetRunfile)
+		if configFile != "" {
+			configFile = helm_utils.GetRunfile(configFile)
+		}
+		if scenariosFile != "" {
+			scenariosFile = helm_utils.GetRunfile(scenariosFile)
+		}
 	} else {
 		pkg = makeAbsolutePath(pkg)
 		helm = makeAbsolutePath(helm)
 		helmPlugins = makeAbsolutePath(helmPlugins)
 		transformStringSlice(args.values, makeAbsolutePath)
+		transformStringSlice(schemaFiles, makeAbsolutePath)
+	}
+
+	if err := validatePolicyChecks(args.policyChecks); err != nil {
+		log.Fatal(err)
+	}
+
+	var config *LintConfig
+	if configFile != "" {
+		config, err = loadLintConfig(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Without scenarios the chart is linted once with the test's own values.
+	scenarios := []Scenario{{}}
+	if scenariosFile != "" {
+		scenarios, err = loadScenarios(scenariosFile, resolvePath)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	if err := extractPackage(pkg, dir); err != nil {
 		log.Fatal(err)
 	}
 
-	lint_dir := find_package_root(dir)
-	helmArgs := []string{"lint", lint_dir}
-	if args.strict {
-		helmArgs = append(helmArgs, "--strict")
+	lint_dir, err := findPackageRoot(dir)
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	// Arguments shared by `helm lint` and `helm template`
+	chartArgs := []string{lint_dir}
 	if args.substitutions != "" {
-		helmArgs = append(helmArgs, "--set", args.substitutions)
+		chartArgs = append(chartArgs, "--set", args.substitutions)
 	}
 	for _, v := range valuesFiles {
-		helmArgs = append(helmArgs, "--values", v)
+		chartArgs = append(chartArgs, "--values", v)
+	}
+
+	var policyCtx policyContext
+	if slices.Contains(args.policyChecks, "deprecated_apis") {
+		policyCtx.kubeVersion, err = resolveKubeVersion(args.kubeVersion, filepath.Join(dir, lint_dir))
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Checking for deprecated APIs in Kubernetes %s", policyCtx.kubeVersion)
+	}
+
+	// Objects are validated when schemas are given or the chart ships CRDs of its own.
+	schemas, err := loadSchemaIndex(schemaFiles, filepath.Join(dir, lint_dir))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(schemaFiles) == 0 && schemas.empty() {
+		schemas = nil
+	}
+
+	var out strings.Builder
+	var suiteNames []string
+	var reports []LintReport
+	var lintErr error
+	for _, scenario := range scenarios {
+		if scenario.Name != "" {
+			fmt.Fprintf(os.Stderr, "==> Scenario: %s\n", scenario.Name)
+		}
+
+		scenarioOut, charts, scenarioReport, scenarioErr := lintScenario(dir, lint_dir, helm, helmPlugins, chartArgs, scenario, args.strict, args.withSubcharts, args.policyChecks, policyCtx, schemas, args.strictSchemas, config)
+		out.WriteString(scenarioOut)
+		for _, chart := range charts {
+			suiteNames = append(suiteNames, suiteName(chart, scenario.Name))
+		}
+		reports = append(reports, scenarioReport)
+		if scenarioErr != nil && lintErr == nil {
+			lintErr = scenarioErr
+		}
+	}
+
+	report := mergeReports(args.strict, scenarios, reports)
+
+	for _, suppression := range config.UnusedSuppressions() {
+		log.Printf("WARNING: Lint suppression `%s` did not match any findings", suppression.Message)
+	}
+
+	reportPath := args.report
+	if reportPath == "" && is_test {
+		if outputsDir, found := os.LookupEnv("TEST_UNDECLARED_OUTPUTS_DIR"); found {
+			reportPath = filepath.Join(outputsDir, "helm_lint_report.json")
+		}
+	}
+	if reportPath != "" {
+		if err := writeJSONReport(reportPath, report); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if xmlOutput, found := os.LookupEnv("XML_OUTPUT_FILE"); found && is_test {
+		junit := junitReport(filepath.Base(args.pkg), report, suiteNames)
+		if err := helm_utils.WriteJUnitReport(xmlOutput, junit); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, result := range report.Scenarios {
+		status := "PASSED"
+		if !result.Passed {
+			status = "FAILED"
+		}
+		fmt.Fprintf(os.Stderr, "Scenario %s: %s\n", result.Name, status)
+	}
+
+	if !report.Passed {
+		for _, finding := range report.Findings {
+			if finding.Fails(report.Strict) {
+				os.Stderr.WriteString(finding.describe() + "\n")
+			}
+		}
+		if lintErr != nil {
+			log.Fatal(lintErr)
+		}
+		log.Fatal("Linting failed")
 	}
 
-	lint(dir, helm, helmArgs, helmPlugins, args.output)
+	writeOutput(args.output, out.String())
 }
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// container is a container spec found within a rendered object.
+type container struct {
+	name  string
+	field string
+	spec  map[string]interface{}
+}
+
+// policyContext is information about the chart shared by all policy checks.
+type policyContext struct {
+	// The Kubernetes version the chart is checked against.
+	kubeVersion kubeVersion
+}
+
+// policyViolation is a single problem found by a policy check.
+type policyViolation struct {
+	severity string
+	message  string
+}
+
+func policyError(format string, a ...interface{}) policyViolation {
+	return policyViolation{severity: SeverityError, message: fmt.Sprintf(format, a...)}
+}
+
+func policyWarning(format string, a ...interface{}) policyViolation {
+	return policyViolation{severity: SeverityWarning, message: fmt.Sprintf(format, a...)}
+}
+
+// policyCheck inspects a rendered object and returns every violation.
+type policyCheck func(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation
+
+// policyChecks are the checks selectable with `helm_lint_test.policy_checks`.
+var policyChecks = map[string]policyCheck{
+	"deprecated_apis": checkDeprecatedAPIs,
+	"image_digest":    checkImageDigest,
+	"latest_tag":      checkLatestTag,
+	"privileged":      checkPrivileged,
+	"probes":          checkProbes,
+	"resources":       checkResources,
+}
+
+// podSpecPaths locates the pod spec of each workload kind.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// longRunningKinds are the workloads expected to define probes.
+var longRunningKinds = map[string]bool{
+	"Deployment":            true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+	"StatefulSet":           true,
+	"DaemonSet":             true,
+}
+
+// findContainers returns the containers and init containers of a workload.
+func findContainers(manifest helm_utils.Manifest) []container {
+	path, found := podSpecPaths[manifest.Kind()]
+	if !found {
+		return nil
+	}
+
+	var containers []container
+	for _, field := range []string{"initContainers", "containers"} {
+		value, _ := helm_utils.Lookup(manifest.Object, append(append([]string{}, path...), field)...)
+		items, _ := value.([]interface{})
+		for _, item := range items {
+			spec, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := spec["name"].(string)
+			containers = append(containers, container{name: name, field: field, spec: spec})
+		}
+	}
+
+	return containers
+}
+
+func (c container) String() string {
+	if c.field == "initContainers" {
+		return fmt.Sprintf("init container `%s`", c.name)
+	}
+	return fmt.Sprintf("container `%s`", c.name)
+}
+
+func (c container) image() string {
+	image, _ := c.spec["image"].(string)
+	return image
+}
+
+func checkResources(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation {
+	var violations []policyViolation
+	for _, c := range containers {
+		for _, kind := range []string{"requests", "limits"} {
+			value, _ := helm_utils.Lookup(c.spec, "resources", kind)
+			resources, _ := value.(map[string]interface{})
+			var missing []string
+			for _, resource := range []string{"cpu", "memory"} {
+				if _, found := resources[resource]; !found {
+					missing = append(missing, resource)
+				}
+			}
+			if len(missing) > 0 {
+				violations = append(violations, policyError("%s does not set resources.%s for %s", c, kind, strings.Join(missing, ", ")))
+			}
+		}
+	}
+	return violations
+}
+
+func checkImageDigest(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation {
+	var violations []policyViolation
+	for _, c := range containers {
+		if !strings.Contains(c.image(), "@sha256:") {
+			violations = append(violations, policyError("%s image `%s` is not pinned by digest", c, c.image()))
+		}
+	}
+	return violations
+}
+
+// imageTag returns the tag of an image reference, ignoring registry ports and digests.
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := image[strings.LastIndex(image, "/")+1:]
+	if _, tag, found := strings.Cut(name, ":"); found {
+		return tag
+	}
+	return ""
+}
+
+func checkLatestTag(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation {
+	var violations []policyViolation
+	for _, c := range containers {
+		image := c.image()
+		tag := imageTag(image)
+		if tag == "latest" || (tag == "" && !strings.Contains(image, "@")) {
+			violations = append(violations, policyError("%s image `%s` uses the `latest` tag", c, image))
+		}
+	}
+	return violations
+}
+
+func checkPrivileged(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation {
+	var violations []policyViolation
+	for _, c := range containers {
+		if privileged, _ := helm_utils.Lookup(c.spec, "securityContext", "privileged"); privileged == true {
+			violations = append(violations, policyError("%s sets securityContext.privileged", c))
+		}
+	}
+	return violations
+}
+
+func checkProbes(ctx policyContext, manifest helm_utils.Manifest, containers []container) []policyViolation {
+	if !longRunningKinds[manifest.Kind()] {
+		return nil
+	}
+
+	var violations []policyViolation
+	for _, c := range containers {
+		if c.field != "containers" {
+			continue
+		}
+		for _, probe := range []string{"livenessProbe", "readinessProbe"} {
+			if _, found := c.spec[probe]; !found {
+				violations = append(violations, policyError("%s does not define a %s", c, probe))
+			}
+		}
+	}
+	return violations
+}
+
+// validatePolicyChecks ensures all requested checks exist.
+func validatePolicyChecks(names []string) error {
+	for _, name := range names {
+		if _, found := policyChecks[name]; !found {
+			var known []string
+			for check := range policyChecks {
+				known = append(known, check)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("Unknown policy check `%s`. Expected one of: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// chartRelativeSource converts a `# Source:` path (`chart/templates/x.yaml`) into
+// a path relative to the chart, matching the files reported by `helm lint`.
+func chartRelativeSource(source string) string {
+	if _, relative, found := strings.Cut(source, "/"); found {
+		return relative
+	}
+	return source
+}
+
+// runPolicyChecks evaluates the named checks against rendered manifests.
+func runPolicyChecks(chart string, ctx policyContext, manifests []helm_utils.Manifest, names []string) []Finding {
+	var findings []Finding
+	for _, manifest := range manifests {
+		containers := findContainers(manifest)
+		for _, name := range names {
+			for _, violation := range policyChecks[name](ctx, manifest, containers) {
+				findings = append(findings, Finding{
+					Severity: violation.severity,
+					Chart:    chart,
+					File:     chartRelativeSource(manifest.Source),
+					Rule:     name,
+					Message:  fmt.Sprintf("%s: %s", manifest.ID(), violation.message),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// renderManifests runs `helm template` on the chart in directory and parses its output.
+func renderManifests(directory string, helm string, helmArgs []string, helmPluginsDir string) ([]helm_utils.Manifest, error) {
+	cmd, err := helm_utils.BuildHelmCommand(helm, append([]string{"template"}, helmArgs...), helmPluginsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Dir = directory
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error rendering chart: %w", err)
+	}
+
+	return helm_utils.ParseManifests(string(out))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+const policyManifests = `---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: registry.io/init@sha256:0123
+          resources:
+            requests: {cpu: 10m, memory: 16Mi}
+            limits: {cpu: 10m, memory: 16Mi}
+      containers:
+        - name: app
+          image: registry.io:5000/app:latest
+          securityContext:
+            privileged: true
+          readinessProbe:
+            httpGet: {path: /, port: 80}
+          resources:
+            requests: {cpu: 10m}
+---
+# Source: mychart/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: registry.io/migrate:1.0.0
+          resources:
+            requests: {cpu: 10m, memory: 16Mi}
+            limits: {cpu: 10m, memory: 16Mi}
+`
+
+func TestRunPolicyChecks(t *testing.T) {
+	manifests, err := helm_utils.ParseManifests(policyManifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []string{"image_digest", "latest_tag", "privileged", "probes", "resources"}
+	if err := validatePolicyChecks(checks); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for _, finding := range runPolicyChecks("mychart", policyContext{}, manifests, checks) {
+		if finding.Severity != SeverityError || finding.Chart != "mychart" {
+			t.Errorf("Unexpected finding: %+v", finding)
+		}
+		messages = append(messages, finding.File+" "+finding.Rule+" "+finding.Message)
+	}
+
+	expected := []string{
+		"templates/deployment.yaml image_digest Deployment//web: container `app` image `registry.io:5000/app:latest` is not pinned by digest",
+		"templates/deployment.yaml latest_tag Deployment//web: container `app` image `registry.io:5000/app:latest` uses the `latest` tag",
+		"templates/deployment.yaml privileged Deployment//web: container `app` sets securityContext.privileged",
+		"templates/deployment.yaml probes Deployment//web: container `app` does not define a livenessProbe",
+		"templates/deployment.yaml resources Deployment//web: container `app` does not set resources.requests for memory",
+		"templates/deployment.yaml resources Deployment//web: container `app` does not set resources.limits for cpu, memory",
+		"templates/job.yaml image_digest Job//migrate: container `migrate` image `registry.io/migrate:1.0.0` is not pinned by digest",
+	}
+
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected findings:\n%s\nExpected:\n%s", strings.Join(messages, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                           "",
+		"nginx:1.25":                      "1.25",
+		"registry.io:5000/nginx":          "",
+		"registry.io:5000/nginx:latest":   "latest",
+		"registry.io/nginx:1.0@sha256:01": "1.0",
+	}
+
+	for image, expected := range tests {
+		if tag := imageTag(image); tag != expected {
+			t.Errorf("Expected tag `%s` for `%s`, got `%s`", expected, image, tag)
+		}
+	}
+}
+
+func TestValidatePolicyChecks(t *testing.T) {
+	if err := validatePolicyChecks([]string{"resources", "unknown"}); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("Expected an error for an unknown check, got %v", err)
+	}
+}
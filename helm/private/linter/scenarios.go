@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Scenario is a named set of values files and substitutions to lint the chart with.
+// The unnamed scenario lints the chart with only the test's own values.
+type Scenario struct {
+	Name          string            `json:"name"`
+	Values        []string          `json:"values"`
+	Substitutions map[string]string `json:"substitutions"`
+}
+
+// ScenarioResult summarizes the outcome of linting a single scenario.
+type ScenarioResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+}
+
+// loadScenarios reads the scenarios file written by `helm_lint_test`.
+func loadScenarios(path string, resolvePath func(string) string) ([]Scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading scenarios %s: %w", path, err)
+	}
+
+	var scenarios []Scenario
+	if err := json.Unmarshal(content, &scenarios); err != nil {
+		return nil, fmt.Errorf("Error parsing scenarios %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range scenarios {
+		if scenarios[i].Name == "" {
+			return nil, fmt.Errorf("Scenario %d in %s has no name", i, path)
+		}
+		if names[scenarios[i].Name] {
+			return nil, fmt.Errorf("Duplicate scenario `%s` in %s", scenarios[i].Name, path)
+		}
+		names[scenarios[i].Name] = true
+
+		for j, values := range scenarios[i].Values {
+			scenarios[i].Values[j] = resolvePath(values)
+		}
+	}
+
+	return scenarios, nil
+}
+
+// args returns the helm arguments applying the scenario. They are intended to follow
+// the test's own values so that scenarios take precedence.
+func (s Scenario) args() []string {
+	var args []string
+	for _, values := range s.Values {
+		args = append(args, "--values", values)
+	}
+
+	keys := make([]string, 0, len(s.Substitutions))
+	for key := range s.Substitutions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--set", fmt.Sprintf("%s=%s", key, s.Substitutions[key]))
+	}
+
+	return args
+}
+
+// suiteName names the JUnit test suite of a chart linted with a scenario.
+func suiteName(chart string, scenario string) string {
+	if scenario == "" {
+		return chart
+	}
+	return fmt.Sprintf("%s[%s]", chart, scenario)
+}
+
+// mergeReports combines the reports of each scenario into one.
+func mergeReports(strict bool, scenarios []Scenario, reports []LintReport) LintReport {
+	merged := LintReport{
+		Strict:   strict,
+		Passed:   true,
+		Findings: []Finding{},
+	}
+
+	for i, report := range reports {
+		if !report.Passed {
+			merged.Passed = false
+		}
+		merged.Findings = append(merged.Findings, report.Findings...)
+		if scenarios[i].Name != "" {
+			merged.Scenarios = append(merged.Scenarios, ScenarioResult{
+				Name:   scenarios[i].Name,
+				Passed: report.Passed,
+			})
+		}
+	}
+
+	return merged
+}
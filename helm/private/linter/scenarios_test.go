@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadScenarios(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenarios.json")
+	content := `[
+		{"name": "ingress", "values": ["ingress.yaml"], "substitutions": {"b": "2", "a": "1"}},
+		{"name": "defaults", "values": [], "substitutions": {}}
+	]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios, err := loadScenarios(path, func(path string) string { return "/runfiles/" + path })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scenarios) != 2 {
+		t.Fatalf("Expected 2 scenarios, got %d", len(scenarios))
+	}
+
+	expected := []string{"--values", "/runfiles/ingress.yaml", "--set", "a=1", "--set", "b=2"}
+	if args := scenarios[0].args(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+	if args := scenarios[1].args(); len(args) != 0 {
+		t.Errorf("Expected no arguments, got %v", args)
+	}
+}
+
+func TestLoadScenariosDuplicate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenarios.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "a"}, {"name": "a"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadScenarios(path, func(path string) string { return path }); err == nil || !strings.Contains(err.Error(), "Duplicate") {
+		t.Errorf("Expected a duplicate scenario error, got %v", err)
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	scenarios := []Scenario{{Name: "a"}, {Name: "b"}}
+	reports := []LintReport{
+		{Passed: true, Findings: []Finding{{Severity: SeverityInfo, Chart: "mychart", Scenario: "a", Message: "icon is recommended"}}},
+		{Passed: false, Findings: []Finding{{Severity: SeverityError, Chart: "mychart", Scenario: "b", File: "templates/ingress.yaml", Message: "bad"}}},
+	}
+
+	report := mergeReports(false, scenarios, reports)
+	if report.Passed {
+		t.Error("Expected a failing scenario to fail the report")
+	}
+	if !reflect.DeepEqual(report.Scenarios, []ScenarioResult{{"a", true}, {"b", false}}) {
+		t.Errorf("Unexpected scenario results: %v", report.Scenarios)
+	}
+
+	junit := junitReport("mychart.tgz", report, []string{suiteName("mychart", "a"), suiteName("mychart", "b")})
+	if len(junit.Suites) != 2 || junit.Suites[0].Name != "mychart[a]" || junit.Suites[1].Name != "mychart[b]" {
+		t.Errorf("Unexpected suites: %+v", junit.Suites)
+	}
+	if junit.Suites[1].TestCases[0].Failure == nil {
+		t.Errorf("Expected scenario `b` to fail: %+v", junit.Suites[1])
+	}
+}
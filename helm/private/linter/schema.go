@@ -0,0 +1,525 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// schemaRef is a schema along with the document it was loaded from, against which
+// local `$ref`s are resolved.
+type schemaRef struct {
+	schema map[string]interface{}
+	root   map[string]interface{}
+	origin string
+}
+
+// SchemaIndex maps `group/version/kind` to the schema validating it.
+type SchemaIndex struct {
+	schemas map[string]schemaRef
+}
+
+func newSchemaIndex() *SchemaIndex {
+	return &SchemaIndex{schemas: map[string]schemaRef{}}
+}
+
+// gvkKey renders an index key. The core group is empty.
+func gvkKey(group string, version string, kind string) string {
+	return fmt.Sprintf("%s/%s/%s", group, version, kind)
+}
+
+// manifestGVK returns the index key of a rendered object.
+func manifestGVK(manifest helm_utils.Manifest) string {
+	group, version, found := strings.Cut(manifest.APIVersion(), "/")
+	if !found {
+		group, version = "", group
+	}
+	return gvkKey(group, version, manifest.Kind())
+}
+
+// clone copies the index so schemas can be added without affecting the original.
+func (i *SchemaIndex) clone() *SchemaIndex {
+	schemas := make(map[string]schemaRef, len(i.schemas))
+	for key, ref := range i.schemas {
+		schemas[key] = ref
+	}
+	return &SchemaIndex{schemas: schemas}
+}
+
+func (i *SchemaIndex) add(key string, ref schemaRef) {
+	// Schemas for the same kind are taken in order, so earlier inputs win.
+	if _, exists := i.schemas[key]; !exists {
+		i.schemas[key] = ref
+	}
+}
+
+// gvkExtensions indexes a schema by its `x-kubernetes-group-version-kind` extension.
+func (i *SchemaIndex) gvkExtensions(schema map[string]interface{}, root map[string]interface{}, origin string) bool {
+	entries, _ := schema["x-kubernetes-group-version-kind"].([]interface{})
+	for _, entry := range entries {
+		gvk, _ := entry.(map[string]interface{})
+		group, _ := gvk["group"].(string)
+		version, _ := gvk["version"].(string)
+		kind, _ := gvk["kind"].(string)
+		i.add(gvkKey(group, version, kind), schemaRef{schema: schema, root: root, origin: origin})
+	}
+	return len(entries) > 0
+}
+
+// schemaFileNameRegex matches the names used by kubernetes-json-schema, e.g.
+// `deployment-apps-v1.json` or `service-v1.json`.
+var schemaFileNameRegex = regexp.MustCompile(`^([a-z0-9]+)(?:-([a-z0-9.\-]+))?-(v[0-9]+(?:(?:alpha|beta)[0-9]+)?)\.(?:json|ya?ml)$`)
+
+// addDocument indexes every schema found in a parsed file.
+func (i *SchemaIndex) addDocument(document map[string]interface{}, origin string) {
+	if document["kind"] == "CustomResourceDefinition" {
+		i.addCRD(document, origin)
+		return
+	}
+
+	found := i.gvkExtensions(document, document, origin)
+
+	// OpenAPI documents contain many definitions.
+	for _, section := range []string{"definitions", "components"} {
+		definitions, _ := document[section].(map[string]interface{})
+		if section == "components" {
+			definitions, _ = definitions["schemas"].(map[string]interface{})
+		}
+		for _, definition := range definitions {
+			if schema, ok := definition.(map[string]interface{}); ok {
+				found = i.gvkExtensions(schema, document, origin) || found
+			}
+		}
+	}
+
+	if found {
+		return
+	}
+
+	// Fall back to the kind, group and version encoded in the file name. The kind is
+	// lowercase so it's matched case insensitively.
+	if match := schemaFileNameRegex.FindStringSubmatch(strings.ToLower(filepath.Base(origin))); match != nil {
+		group := match[2]
+		// kubernetes-json-schema names groups by their first segment (`apps`, `networking`)
+		i.add(strings.ToLower(gvkKey(group, match[3], match[1])), schemaRef{schema: document, root: document, origin: origin})
+	}
+}
+
+// addCRD indexes the schema of every version served by a CustomResourceDefinition.
+func (i *SchemaIndex) addCRD(crd map[string]interface{}, origin string) {
+	group, _ := helm_utils.Lookup(crd, "spec", "group")
+	kind, _ := helm_utils.Lookup(crd, "spec", "names", "kind")
+	versions, _ := helm_utils.Lookup(crd, "spec", "versions")
+	groupName, _ := group.(string)
+	kindName, _ := kind.(string)
+
+	items, _ := versions.([]interface{})
+	for _, item := range items {
+		version, _ := item.(map[string]interface{})
+		name, _ := version["name"].(string)
+		schema, found := helm_utils.Lookup(version, "schema", "openAPIV3Schema")
+		if !found {
+			// `apiextensions.k8s.io/v1beta1` CRDs define a single validation schema
+			schema, found = helm_utils.Lookup(crd, "spec", "validation", "openAPIV3Schema")
+		}
+		if mapping, ok := schema.(map[string]interface{}); found && ok {
+			mapping = withObjectMeta(mapping)
+			i.add(gvkKey(groupName, name, kindName), schemaRef{schema: mapping, root: mapping, origin: origin})
+		}
+	}
+}
+
+// withObjectMeta returns a copy of the root schema of a CRD which allows the fields the API
+// server accepts on every object. CRDs commonly only declare `spec` and `status`.
+func withObjectMeta(schema map[string]interface{}) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) == 0 {
+		return schema
+	}
+
+	implicit := map[string]interface{}{
+		"apiVersion": map[string]interface{}{"type": "string"},
+		"kind":       map[string]interface{}{"type": "string"},
+		"metadata":   map[string]interface{}{"type": "object"},
+	}
+	for key, value := range properties {
+		implicit[key] = value
+	}
+
+	copied := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		copied[key] = value
+	}
+	copied["properties"] = implicit
+	return copied
+}
+
+// LoadSchemaFile indexes the schemas in a JSON or YAML file. YAML files may contain
+// several documents, such as a set of CRDs.
+func (i *SchemaIndex) LoadSchemaFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading schema %s: %w", path, err)
+	}
+
+	manifests, err := helm_utils.ParseManifests(string(content))
+	if err != nil {
+		return fmt.Errorf("Error parsing schema %s: %w", path, err)
+	}
+
+	for _, manifest := range manifests {
+		i.addDocument(manifest.Object, path)
+	}
+
+	return nil
+}
+
+// LoadChartCRDs indexes the CRDs in the `crds` directories of a chart and its subcharts.
+func (i *SchemaIndex) LoadChartCRDs(chartDir string) error {
+	return filepath.WalkDir(chartDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Base(filepath.Dir(path)) != "crds" {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+			return i.LoadSchemaFile(path)
+		}
+		return nil
+	})
+}
+
+// empty reports whether the index has no schemas.
+func (i *SchemaIndex) empty() bool {
+	return len(i.schemas) == 0
+}
+
+// Lookup returns the schema for a rendered object.
+func (i *SchemaIndex) Lookup(manifest helm_utils.Manifest) (schemaRef, bool) {
+	key := manifestGVK(manifest)
+	if ref, found := i.schemas[key]; found {
+		return ref, true
+	}
+
+	// File name based entries are lowercase and only use the first segment of the group.
+	group, rest, _ := strings.Cut(key, "/")
+	group, _, _ = strings.Cut(group, ".")
+	ref, found := i.schemas[strings.ToLower(group+"/"+rest)]
+	return ref, found
+}
+
+// schemaError is a single validation failure at a path within an object.
+type schemaError struct {
+	path    string
+	message string
+}
+
+type validator struct {
+	root   map[string]interface{}
+	errors []schemaError
+	depth  int
+}
+
+func (v *validator) fail(path string, format string, a ...interface{}) {
+	if path == "" {
+		path = "."
+	}
+	v.errors = append(v.errors, schemaError{path: path, message: fmt.Sprintf(format, a...)})
+}
+
+// resolve follows local `$ref`s such as `#/definitions/io.k8s.api.core.v1.Container`.
+func (v *validator) resolve(schema map[string]interface{}) (map[string]interface{}, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema, nil
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil, fmt.Errorf("unsupported schema reference `%s`", ref)
+		}
+		var current interface{} = v.root
+		for _, segment := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+			mapping, _ := current.(map[string]interface{})
+			current = mapping[segment]
+		}
+		resolved, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolved schema reference `%s`", ref)
+		}
+		schema = resolved
+	}
+	return nil, fmt.Errorf("too many nested schema references")
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func matchesType(value interface{}, expected string) bool {
+	actual := typeName(value)
+	return actual == expected || (expected == "number" && actual == "integer")
+}
+
+// validate checks value against schema, recording errors at path. It returns whether
+// the value is valid so that `anyOf` and `oneOf` can be evaluated.
+func (v *validator) validate(value interface{}, schema map[string]interface{}, path string) bool {
+	v.depth++
+	defer func() { v.depth-- }()
+	if v.depth > 128 {
+		v.fail(path, "schema nesting is too deep")
+		return false
+	}
+
+	// Quantities and IntOrStrings are only described as strings in OpenAPI documents.
+	ref, _ := schema["$ref"].(string)
+	scalar := strings.HasSuffix(ref, ".Quantity") || strings.HasSuffix(ref, ".IntOrString")
+
+	schema, err := v.resolve(schema)
+	if err != nil {
+		v.fail(path, "%s", err)
+		return false
+	}
+
+	before := len(v.errors)
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return true
+		}
+	}
+
+	intOrString, _ := schema["x-kubernetes-int-or-string"].(bool)
+	if intOrString || scalar || schema["format"] == "int-or-string" {
+		if !matchesType(value, "integer") && !matchesType(value, "string") {
+			v.fail(path, "expected an integer or string, got %s", typeName(value))
+		}
+		return len(v.errors) == before
+	}
+
+	switch expected := schema["type"].(type) {
+	case string:
+		if !matchesType(value, expected) {
+			v.fail(path, "expected %s, got %s", expected, typeName(value))
+			return false
+		}
+	case []interface{}:
+		matched := false
+		var names []string
+		for _, item := range expected {
+			name, _ := item.(string)
+			names = append(names, name)
+			matched = matched || matchesType(value, name)
+		}
+		if !matched {
+			v.fail(path, "expected one of %s, got %s", strings.Join(names, ", "), typeName(value))
+			return false
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if reflect.DeepEqual(normalizeNumber(option), normalizeNumber(value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "value `%v` is not one of %v", value, enum)
+		}
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subschemas, _ := schema[key].([]interface{})
+		if len(subschemas) == 0 {
+			continue
+		}
+		valid := 0
+		for _, subschema := range subschemas {
+			mapping, _ := subschema.(map[string]interface{})
+			if key == "allOf" {
+				v.validate(value, mapping, path)
+				continue
+			}
+			// Only the outcome of alternatives matters, not their individual errors.
+			nested := &validator{root: v.root, depth: v.depth}
+			if nested.validate(value, mapping, path) {
+				valid++
+			}
+		}
+		if key == "anyOf" && valid == 0 {
+			v.fail(path, "value does not match any of the allowed schemas")
+		}
+		if key == "oneOf" && valid != 1 {
+			v.fail(path, "value matches %d of the schemas but must match exactly one", valid)
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(typed, schema, path)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range typed {
+				v.validate(item, items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+
+	return len(v.errors) == before
+}
+
+func normalizeNumber(value interface{}) interface{} {
+	switch number := value.(type) {
+	case int:
+		return float64(number)
+	case int64:
+		return float64(number)
+	case uint64:
+		return float64(number)
+	}
+	return value
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (v *validator) validateObject(object map[string]interface{}, schema map[string]interface{}, path string) {
+	properties, hasProperties := schema["properties"].(map[string]interface{})
+
+	required, _ := schema["required"].([]interface{})
+	for _, item := range required {
+		key, _ := item.(string)
+		if _, found := object[key]; !found {
+			v.fail(joinPath(path, key), "required field is missing")
+		}
+	}
+
+	preserveUnknown, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool)
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := object[key]
+		if property, found := properties[key].(map[string]interface{}); found {
+			v.validate(value, property, joinPath(path, key))
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case map[string]interface{}:
+			v.validate(value, additional, joinPath(path, key))
+		case bool:
+			if !additional && !preserveUnknown {
+				v.fail(joinPath(path, key), "unknown field")
+			}
+		default:
+			// Kubernetes schemas describe every field of their objects so, unless told
+			// otherwise, unknown fields are treated as typos.
+			if hasProperties && !preserveUnknown {
+				v.fail(joinPath(path, key), "unknown field")
+			}
+		}
+	}
+}
+
+// validateManifest validates a rendered object against a schema.
+func validateManifest(manifest helm_utils.Manifest, ref schemaRef) []schemaError {
+	v := &validator{root: ref.root}
+	v.validate(manifest.Object, ref.schema, "")
+	return v.errors
+}
+
+// runSchemaValidation validates every rendered object, returning a finding for
+// each violation. Objects without a schema are reported as errors when strict.
+func runSchemaValidation(chart string, index *SchemaIndex, manifests []helm_utils.Manifest, strict bool) []Finding {
+	var findings []Finding
+
+	// CRDs rendered by the chart's templates describe other rendered objects. They only
+	// apply to this render, so they're added to a copy of the shared index.
+	index = index.clone()
+	for _, manifest := range manifests {
+		if manifest.Kind() == "CustomResourceDefinition" {
+			index.addCRD(manifest.Object, manifest.Source)
+		}
+	}
+
+	for _, manifest := range manifests {
+		ref, found := index.Lookup(manifest)
+		if !found {
+			severity := SeverityInfo
+			if strict {
+				severity = SeverityError
+			}
+			findings = append(findings, Finding{
+				Severity: severity,
+				Chart:    chart,
+				File:     chartRelativeSource(manifest.Source),
+				Rule:     "schema",
+				Message:  fmt.Sprintf("%s: no schema found for %s", manifest.ID(), manifest.APIVersion()),
+			})
+			continue
+		}
+
+		for _, err := range validateManifest(manifest, ref) {
+			findings = append(findings, Finding{
+				Severity: SeverityError,
+				Chart:    chart,
+				File:     chartRelativeSource(manifest.Source),
+				Rule:     "schema",
+				Message:  fmt.Sprintf("%s: %s: %s", manifest.ID(), err.path, err.message),
+			})
+		}
+	}
+
+	return findings
+}
+
+// loadSchemaIndex indexes the given schema files followed by the chart's CRDs.
+func loadSchemaIndex(schemaFiles []string, chartDir string) (*SchemaIndex, error) {
+	index := newSchemaIndex()
+	for _, path := range schemaFiles {
+		if err := index.LoadSchemaFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := index.LoadChartCRDs(chartDir); err != nil {
+		return nil, fmt.Errorf("Error loading CRDs: %w", err)
+	}
+
+	return index, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// An excerpt of the Kubernetes OpenAPI document.
+const openAPISchema = `{
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {
+          "type": "object",
+          "required": ["selector"],
+          "properties": {
+            "replicas": {"type": "integer"},
+            "selector": {"type": "object", "additionalProperties": {"type": "string"}},
+            "strategy": {"type": "object", "properties": {"type": {"type": "string", "enum": ["Recreate", "RollingUpdate"]}}},
+            "containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}}
+          }
+        }
+      },
+      "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+    },
+    "io.k8s.api.core.v1.Container": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "resources": {
+          "type": "object",
+          "properties": {
+            "limits": {"type": "object", "additionalProperties": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"}}
+          }
+        }
+      }
+    },
+    "io.k8s.apimachinery.pkg.api.resource.Quantity": {"type": "string"},
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    }
+  }
+}`
+
+const crdSchema = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            apiVersion: {type: string}
+            kind: {type: string}
+            metadata: {type: object, x-kubernetes-preserve-unknown-fields: true}
+            spec:
+              type: object
+              properties:
+                size: {type: integer}
+                port: {x-kubernetes-int-or-string: true}
+`
+
+const schemaManifests = `---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  replicas: "3"
+  strategy:
+    type: Rolling
+  containers:
+    - name: app
+      resoruces:
+        limits:
+          memory: 128Mi
+    - name: sidecar
+      resources:
+        limits:
+          cpu: 1
+---
+# Source: mychart/templates/widget.yaml
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+  annotations:
+    a: b
+spec:
+  size: 3
+  port: http
+  colour: blue
+---
+# Source: mychart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+func writeSchema(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSchemaValidation(t *testing.T) {
+	dir := t.TempDir()
+	openAPI := writeSchema(t, dir, "swagger.json", openAPISchema)
+	writeSchema(t, dir, "mychart/crds/widgets.yaml", crdSchema)
+
+	index, err := loadSchemaIndex([]string{openAPI}, filepath.Join(dir, "mychart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := helm_utils.ParseManifests(schemaManifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for _, finding := range runSchemaValidation("mychart", index, manifests, false) {
+		messages = append(messages, finding.Severity+" "+finding.File+" "+finding.Message)
+	}
+
+	expected := []string{
+		"ERROR templates/deployment.yaml Deployment//web: spec.selector: required field is missing",
+		"ERROR templates/deployment.yaml Deployment//web: spec.containers[0].resoruces: unknown field",
+		"ERROR templates/deployment.yaml Deployment//web: spec.replicas: expected integer, got string",
+		"ERROR templates/deployment.yaml Deployment//web: spec.strategy.type: value `Rolling` is not one of [Recreate RollingUpdate]",
+		"ERROR templates/widget.yaml Widget//gadget: spec.colour: unknown field",
+		"INFO templates/service.yaml Service//web: no schema found for v1",
+	}
+
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected findings:\n%s\nExpected:\n%s", strings.Join(messages, "\n"), strings.Join(expected, "\n"))
+	}
+
+	strict := runSchemaValidation("mychart", index, manifests[2:], true)
+	if len(strict) != 1 || strict[0].Severity != SeverityError {
+		t.Errorf("Expected objects without schemas to fail strict validation: %v", strict)
+	}
+}
+
+func TestSchemaValidationRenderedCRDs(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "mychart/Chart.yaml", "name: mychart\n")
+
+	index, err := loadSchemaIndex(nil, filepath.Join(dir, "mychart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	widget := "# Source: mychart/templates/widget.yaml\napiVersion: example.com/v1\nkind: Widget\nmetadata: {name: gadget}\nspec: {colour: blue}\n"
+	withCRD, err := helm_utils.ParseManifests("# Source: mychart/templates/crd.yaml\n" + crdSchema + "---\n" + widget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutCRD, err := helm_utils.ParseManifests(widget)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := runSchemaValidation("mychart", index, withCRD, false)
+	if len(findings) != 2 || !strings.Contains(findings[1].Message, "Widget//gadget: spec.colour: unknown field") {
+		t.Errorf("Expected the rendered CRD to validate the widget: %v", findings)
+	}
+
+	// CRDs rendered by one scenario must not validate objects of another.
+	findings = runSchemaValidation("mychart", index, withoutCRD, false)
+	if len(findings) != 1 || !strings.Contains(findings[0].Message, "no schema found for example.com/v1") {
+		t.Errorf("Expected the widget of another render to have no schema: %v", findings)
+	}
+}
+
+// A CRD only declaring `spec`, leaving the fields of every object implicit.
+const specOnlyCRDSchema = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Gadget
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                size: {type: integer}
+`
+
+func TestSchemaValidationChartCRDs(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "mychart/crds/gadgets.yaml", specOnlyCRDSchema)
+
+	// The chart's CRDs are used without any other schemas.
+	index, err := loadSchemaIndex(nil, filepath.Join(dir, "mychart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.empty() {
+		t.Fatal("Expected the chart's CRDs to be indexed")
+	}
+
+	manifests, err := helm_utils.ParseManifests(`# Source: mychart/templates/gadget.yaml
+apiVersion: example.com/v1
+kind: Gadget
+metadata:
+  name: gadget
+  labels:
+    app: gadget
+spec:
+  size: 3
+  colour: blue
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := runSchemaValidation("mychart", index, manifests, false)
+	if len(findings) != 1 || !strings.HasSuffix(findings[0].Message, "Gadget//gadget: spec.colour: unknown field") {
+		t.Errorf("Expected only the undeclared spec field to be reported: %v", findings)
+	}
+}
+
+func TestSchemaFileNames(t *testing.T) {
+	dir := t.TempDir()
+	service := writeSchema(t, dir, "service-v1.json", `{"type": "object", "properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}, "metadata": {"type": "object"}}}`)
+	ingress := writeSchema(t, dir, "ingress-networking-v1.json", `{"type": "object"}`)
+	writeSchema(t, dir, "mychart/Chart.yaml", "name: mychart\n")
+
+	index, err := loadSchemaIndex([]string{service, ingress}, filepath.Join(dir, "mychart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := helm_utils.ParseManifests("apiVersion: v1\nkind: Service\nmetadata: {name: web}\nspec: {}\n---\napiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata: {name: web}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := runSchemaValidation("mychart", index, manifests, true)
+	if len(findings) != 1 || !strings.Contains(findings[0].Message, "Service//web: spec: unknown field") {
+		t.Errorf("Unexpected findings: %v", findings)
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/abrisco/rules_helm/helm/private/helm_utils"
 	"gopkg.in/yaml.v3"
@@ -35,32 +37,6 @@ type ImageManifest struct {
 	RemoteTagsPath string `json:"remote_tags_path"`
 }
 
-type ImageIndexManifest struct {
-	MediaType string `json:"mediaType"`
-	Size      int    `json:"size"`
-	Digest    string `json:"digest"`
-}
-
-type ImageIndex struct {
-	SchemaVersion int                  `json:"schemaVersion"`
-	MediaType     string               `json:"mediaType"`
-	Manifests     []ImageIndexManifest `json:"manifests"`
-}
-
-// OCI Image Manifest structures
-type OCIDescriptor struct {
-	MediaType string `json:"mediaType"`
-	Digest    string `json:"digest"`
-	Size      int64  `json:"size"`
-}
-
-type OCIManifest struct {
-	SchemaVersion int             `json:"schemaVersion"`
-	MediaType     string          `json:"mediaType"`
-	Config        OCIDescriptor   `json:"config"`
-	Layers        []OCIDescriptor `json:"layers"`
-}
-
 type TemplatesManfiest map[string]string
 type FilesManfiest map[string]string
 type CrdsManfiest map[string]string
@@ -106,23 +82,27 @@ type HelmChart struct {
 }
 
 type Arguments struct {
-	TemplatesManifest  string
-	FilesManifest      string
-	CrdsManifest       string
-	Package            string
-	Chart              string
-	Values             string
-	Schema             string
-	Substitutions      string
-	DepsManifest       string
-	Helm               string
-	HelmPlugins        string
-	Output             string
-	MetadataOutput     string
-	ImageManifest      string
-	StableStatusFile   string
-	VolatileStatusFile string
-	WorkspaceName      string
+	TemplatesManifest    string
+	FilesManifest        string
+	CrdsManifest         string
+	Package              string
+	Chart                string
+	Values               string
+	Schema               string
+	Substitutions        string
+	DepsManifest         string
+	Helm                 string
+	HelmPlugins          string
+	Output               string
+	MetadataOutput       string
+	ImageManifest        string
+	StableStatusFile     string
+	VolatileStatusFile   string
+	WorkspaceName        string
+	PlaceholderSyntax    string
+	BuildInfoAnnotations bool
+	ImageHelpers         bool
+	Label                string
 }
 
 func parseArgs() Arguments {
@@ -145,44 +125,15 @@ func parseArgs() Arguments {
 	flag.StringVar(&args.StableStatusFile, "stable_status_file", "", "The stable status file (`ctx.info_file`).")
 	flag.StringVar(&args.VolatileStatusFile, "volatile_status_file", "", "The stable status file (`ctx.version_file`).")
 	flag.StringVar(&args.WorkspaceName, "workspace_name", "", "The name of the current Bazel workspace.")
+	flag.StringVar(&args.PlaceholderSyntax, "placeholder_syntax", "", "The name of the delimiters used for substitution and stamp placeholders.")
+	flag.BoolVar(&args.BuildInfoAnnotations, "build_info_annotations", false, "Whether or not to add build information annotations to `Chart.yaml`.")
+	flag.BoolVar(&args.ImageHelpers, "image_helpers", false, "Whether or not to generate named templates for each image in `templates/_images.tpl`.")
+	flag.StringVar(&args.Label, "label", "", "The label of the Bazel target producing the helm package.")
 	flag.Parse()
 
 	return args
 }
 
-func loadStamps(volatileStatusFile string, stableStatusFile string) ([]ReplacementGroup, error) {
-	replacementGroups := []ReplacementGroup{}
-
-	stampFiles := []string{volatileStatusFile, stableStatusFile}
-	for _, stampFile := range stampFiles {
-		// The files may not be defined
-		if len(stampFile) == 0 {
-			continue
-		}
-
-		content, err := os.ReadFile(stampFile)
-		if err != nil {
-			return nil, fmt.Errorf("Error reading file %s: %w", stampFile, err)
-		}
-
-		for _, line := range strings.Split(string(content), "\n") {
-			split := strings.SplitN(strings.TrimRight(line, "\r"), " ", 2)
-			if len(split) < 2 {
-				continue
-			}
-			key, val := split[0], split[1]
-			replacementGroups = append(replacementGroups, ReplacementGroup{
-				Name: key,
-				Replacements: map[string]string{
-					key: val,
-				},
-			})
-		}
-	}
-
-	return replacementGroups, nil
-}
-
 func loadImageInfos(imageManifestPath string) ([]ImageInfo, error) {
 	if len(imageManifestPath) == 0 {
 		return nil, fmt.Errorf("No image manifest path provided")
@@ -253,39 +204,11 @@ func imageManifestToImageInfo(imageManifest ImageManifest) (ImageInfo, error) {
 		return imageInfo, fmt.Errorf("Image %s: both oci_layout_dir and manifest_file are set (mutually exclusive)", imageManifest.Label)
 	}
 
-	if hasOciLayout {
-		// rules_oci format: OCI layout directory with index.json
-		imageIndexPath := filepath.Join(imageManifest.OciLayoutDir, "index.json")
-		imageIndexContent, err := os.ReadFile(imageIndexPath)
-		if err != nil {
-			return imageInfo, fmt.Errorf("Error reading file %s: %w", imageIndexPath, err)
-		}
-
-		var imageIndex ImageIndex
-		err = json.Unmarshal(imageIndexContent, &imageIndex)
-		if err != nil {
-			return imageInfo, fmt.Errorf("Error unmarshalling file %s: %w", imageIndexPath, err)
-		}
-
-		imageInfo.Digest = imageIndex.Manifests[0].Digest
-	} else {
-		// rules_img format: direct manifest JSON file
-		manifestContent, err := os.ReadFile(imageManifest.ManifestFile)
-		if err != nil {
-			return imageInfo, fmt.Errorf("Error reading manifest file %s: %w", imageManifest.ManifestFile, err)
-		}
-
-		var ociManifest OCIManifest
-		err = json.Unmarshal(manifestContent, &ociManifest)
-		if err != nil {
-			return imageInfo, fmt.Errorf("Error unmarshalling manifest file %s: %w", imageManifest.ManifestFile, err)
-		}
-
-		// For rules_img, we need to compute the digest of the manifest itself
-		// The digest should be sha256 of the manifest content
-		hash := sha256.Sum256(manifestContent)
-		imageInfo.Digest = "sha256:" + hex.EncodeToString(hash[:])
+	digest, err := helm_utils.ImageDigest(imageManifest.OciLayoutDir, imageManifest.ManifestFile)
+	if err != nil {
+		return imageInfo, fmt.Errorf("Image %s: %w", imageManifest.Label, err)
 	}
+	imageInfo.Digest = digest
 
 	if imageManifest.RemoteTagsPath != "" {
 		remoteTagsContent, err := os.ReadFile(imageManifest.RemoteTagsPath)
@@ -308,12 +231,7 @@ type ReplacementGroup struct {
 	Replacements map[string]string
 }
 
-func loadImageStamps(imageManifestPath string) ([]ReplacementGroup, error) {
-	imageInfos, err := loadImageInfos(imageManifestPath)
-	if err != nil {
-		return nil, fmt.Errorf("Error loading image infos: %w", err)
-	}
-
+func makeImageStamps(imageInfos []ImageInfo) []ReplacementGroup {
 	replacementGroups := []ReplacementGroup{}
 
 	isSingleImage := len(imageInfos) == 1
@@ -356,19 +274,24 @@ func loadImageStamps(imageManifestPath string) ([]ReplacementGroup, error) {
 		})
 	}
 
-	return replacementGroups, nil
+	return replacementGroups
 }
 
-func replaceKeyValues(content string, replacementGroups []ReplacementGroup, mustReplace bool) (string, error) {
+func replaceKeyValues(content string, replacementGroups []ReplacementGroup, mustReplace bool, syntax helm_utils.PlaceholderSyntax) (string, error) {
 	for _, replacementGroup := range replacementGroups {
 		replaced := false
 
-		for key, val := range replacementGroup.Replacements {
-			replaceKey := fmt.Sprintf("{%s}", key)
+		for key := range replacementGroup.Replacements {
 			if strings.Contains(content, key) {
 				replaced = true
+				break
 			}
-			content = strings.ReplaceAll(content, replaceKey, val)
+		}
+
+		var err error
+		content, _, err = helm_utils.ExpandPlaceholders(content, helm_utils.MapLookup(replacementGroup.Replacements), helm_utils.ExpandOptions{Syntax: syntax})
+		if err != nil {
+			return content, fmt.Errorf("Error replacing keys for %s: %w", replacementGroup.Name, err)
 		}
 
 		if !replaced && mustReplace {
@@ -379,7 +302,7 @@ func replaceKeyValues(content string, replacementGroups []ReplacementGroup, must
 	return content, nil
 }
 
-func applySubstitutions(content string, substitutions_file string) (string, error) {
+func applySubstitutions(content string, substitutions_file string, syntax helm_utils.PlaceholderSyntax) (string, error) {
 	if len(substitutions_file) == 0 {
 		return content, nil
 	}
@@ -395,42 +318,48 @@ func applySubstitutions(content string, substitutions_file string) (string, erro
 		return content, fmt.Errorf("Error unmarshalling substitutions file %s: %w", substitutions_file, err)
 	}
 
-	for key, val := range substitutions {
-		replaceKey := fmt.Sprintf("{%s}", key)
-		content = strings.ReplaceAll(content, replaceKey, val)
+	content, _, err = helm_utils.ExpandPlaceholders(content, helm_utils.MapLookup(substitutions), helm_utils.ExpandOptions{Syntax: syntax})
+	if err != nil {
+		return content, fmt.Errorf("Error applying substitutions: %w", err)
 	}
 
 	return content, nil
 }
 
-func applyStamping(content string, stamps []ReplacementGroup, imageStamps []ReplacementGroup, requireImageStamps bool) (string, error) {
-	content, err := replaceKeyValues(content, stamps, false)
+func applyStamping(content string, stamps []ReplacementGroup, imageStamps []ReplacementGroup, requireImageStamps bool, syntax helm_utils.PlaceholderSyntax) (string, error) {
+	content, err := replaceKeyValues(content, stamps, false, syntax)
 	if err != nil {
 		return content, fmt.Errorf("Error replacing stamps: %w", err)
 	}
 
-	content, err = replaceKeyValues(content, imageStamps, requireImageStamps)
+	content, err = replaceKeyValues(content, imageStamps, requireImageStamps, syntax)
 	if err != nil {
 		return content, fmt.Errorf("Error replacing image stamps: %w", err)
 	}
 
+	// Anything still unresolved falls back to the defaults declared in the placeholder.
+	content, _, err = helm_utils.ExpandPlaceholders(content, helm_utils.MapLookup(nil), helm_utils.ExpandOptions{Finalize: true, Syntax: syntax})
+	if err != nil {
+		return content, fmt.Errorf("Error applying placeholder defaults: %w", err)
+	}
+
 	return content, nil
 }
 
-func sanitizeChartContent(content string) (string, error) {
+func sanitizeChartContent(content string, syntax helm_utils.PlaceholderSyntax) (string, error) {
 	var chart HelmChart
 	err := yaml.Unmarshal([]byte(content), &chart)
 	if err != nil {
 		return "", fmt.Errorf("Error unmarshalling chart content: %w", err)
 	}
 
-	re := regexp.MustCompile(`.*{.+}.*`)
+	re := regexp.MustCompile(`.*` + regexp.QuoteMeta(syntax.Open) + `.+` + regexp.QuoteMeta(syntax.Close) + `.*`)
 
 	versionMatch := re.FindAllString(chart.Version, 1)
 	if len(versionMatch) != 0 {
 		var replacement = versionMatch[0]
-		replacement = strings.ReplaceAll(replacement, "{", "")
-		replacement = strings.ReplaceAll(replacement, "}", "")
+		replacement = strings.ReplaceAll(replacement, syntax.Open, "")
+		replacement = strings.ReplaceAll(replacement, syntax.Close, "")
 		replacement = strings.ReplaceAll(replacement, "_", "-")
 
 		content = strings.ReplaceAll(content, versionMatch[0], replacement)
@@ -439,8 +368,8 @@ func sanitizeChartContent(content string) (string, error) {
 	appVersionMatch := re.FindAllString(chart.AppVersion, 1)
 	if len(appVersionMatch) != 0 {
 		var replacement = appVersionMatch[0]
-		replacement = strings.ReplaceAll(replacement, "{", "")
-		replacement = strings.ReplaceAll(replacement, "}", "")
+		replacement = strings.ReplaceAll(replacement, syntax.Open, "")
+		replacement = strings.ReplaceAll(replacement, syntax.Close, "")
 		replacement = strings.ReplaceAll(replacement, "_", "-")
 
 		content = strings.ReplaceAll(content, appVersionMatch[0], replacement)
@@ -449,6 +378,181 @@ func sanitizeChartContent(content string) (string, error) {
 	return content, nil
 }
 
+const (
+	AnnotationRevision = "org.opencontainers.image.revision"
+	AnnotationCreated  = "org.opencontainers.image.created"
+	AnnotationBuilder  = "rules-helm/builder"
+	AnnotationTarget   = "rules-helm/target"
+	AnnotationImages   = "artifacthub.io/images"
+)
+
+// ArtifactHubImage is an entry of the `artifacthub.io/images` annotation.
+type ArtifactHubImage struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+}
+
+// buildInfoAnnotations derives chart annotations from workspace status keys, the
+// producing target's label and the images of the chart. Values which are not
+// available (e.g. when stamping is disabled) are omitted.
+func buildInfoAnnotations(workspaceStatus map[string]string, imageInfos []ImageInfo, label string) (map[string]string, error) {
+	annotations := map[string]string{}
+
+	if commit := workspaceStatus["STABLE_GIT_COMMIT"]; commit != "" {
+		annotations[AnnotationRevision] = commit
+	}
+
+	if timestamp := workspaceStatus["BUILD_TIMESTAMP"]; timestamp != "" {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing BUILD_TIMESTAMP `%s`: %w", timestamp, err)
+		}
+		annotations[AnnotationCreated] = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+	}
+
+	builder := []string{}
+	for _, key := range []string{"BUILD_USER", "BUILD_HOST"} {
+		if value := workspaceStatus[key]; value != "" {
+			builder = append(builder, value)
+		}
+	}
+	if len(builder) > 0 {
+		annotations[AnnotationBuilder] = strings.Join(builder, "@")
+	}
+
+	if label != "" {
+		annotations[AnnotationTarget] = label
+	}
+
+	if len(imageInfos) > 0 {
+		images := []ArtifactHubImage{}
+		for _, imageInfo := range imageInfos {
+			name := imageInfo.Label
+			if _, target, found := strings.Cut(name, ":"); found {
+				name = target
+			}
+
+			image := imageInfo.Repository
+			if imageInfo.RemoteTag != "" {
+				image = fmt.Sprintf("%s:%s", image, imageInfo.RemoteTag)
+			}
+
+			images = append(images, ArtifactHubImage{
+				Name:  name,
+				Image: fmt.Sprintf("%s@%s", image, imageInfo.Digest),
+			})
+		}
+
+		content, err := yaml.Marshal(images)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling images annotation: %w", err)
+		}
+		annotations[AnnotationImages] = string(content)
+	}
+
+	return annotations, nil
+}
+
+// addBuildInfoAnnotations adds build information annotations to the chart. Annotations
+// already defined in the chart take precedence.
+func addBuildInfoAnnotations(chartContent string, workspaceStatus map[string]string, imageInfos []ImageInfo, label string) (string, error) {
+	chart, err := loadChart(chartContent)
+	if err != nil {
+		return chartContent, fmt.Errorf("Error loading chart content: %w", err)
+	}
+
+	annotations, err := buildInfoAnnotations(workspaceStatus, imageInfos, label)
+	if err != nil {
+		return chartContent, err
+	}
+
+	if chart.Annotations == nil {
+		chart.Annotations = map[string]string{}
+	}
+	for key, val := range annotations {
+		if _, exists := chart.Annotations[key]; !exists {
+			chart.Annotations[key] = val
+		}
+	}
+
+	chartContentBytes, err := yaml.Marshal(chart)
+	if err != nil {
+		return chartContent, fmt.Errorf("Error marshalling chart content: %w", err)
+	}
+
+	return string(chartContentBytes), nil
+}
+
+// ImageHelpersTemplate is the name of the generated template file defining image helpers.
+const ImageHelpersTemplate = "_images.tpl"
+
+// imageHelperName derives the name of the named templates for an image from the
+// name of its push target. E.g. `//app:api` becomes `bazel.image.api`.
+func imageHelperName(label string) string {
+	name := label
+	if _, target, found := strings.Cut(label, ":"); found {
+		name = target
+	}
+
+	return fmt.Sprintf("bazel.image.%s", name)
+}
+
+// renderImageHelpers renders a named template for each image's url as well as its
+// repository, digest and (if known) tag.
+func renderImageHelpers(imageInfos []ImageInfo, label string) (string, error) {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "{{/* Generated by rules_helm for %s. DO NOT EDIT. */}}\n", label)
+
+	owners := map[string]string{}
+	for _, imageInfo := range imageInfos {
+		name := imageHelperName(imageInfo.Label)
+		if owner, exists := owners[name]; exists {
+			return "", fmt.Errorf("Images %s and %s both produce the named template `%s`", owner, imageInfo.Label, name)
+		}
+		owners[name] = imageInfo.Label
+
+		defines := [][2]string{
+			{name, fmt.Sprintf("%s@%s", imageInfo.Repository, imageInfo.Digest)},
+			{name + ".repository", imageInfo.Repository},
+			{name + ".digest", imageInfo.Digest},
+		}
+		if imageInfo.RemoteTag != "" {
+			defines = append(defines, [2]string{name + ".tag", imageInfo.RemoteTag})
+		}
+
+		fmt.Fprintf(&builder, "\n{{/* %s */}}\n", imageInfo.Label)
+		for _, define := range defines {
+			fmt.Fprintf(&builder, "{{- define %q -}}\n%s\n{{- end -}}\n", define[0], define[1])
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// writeImageHelpers writes the image helpers template to path, refusing to replace
+// a template provided by the chart.
+func writeImageHelpers(path string, imageInfos []ImageInfo, label string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("The chart already contains a template named %s", filepath.Base(path))
+	}
+
+	content, err := renderImageHelpers(imageInfos, label)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating templates directory %s: %w", filepath.Dir(path), err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("Error writing image helpers %s: %w", path, err)
+	}
+
+	return nil
+}
+
 func copyFile(source string, dest string) error {
 	srcFile, err := os.Open(source)
 	if err != nil {
@@ -985,40 +1089,57 @@ func main() {
 		schemaContent = string(schemaBytes)
 	}
 
-	// Collect all stamp values
-	stamps, err := loadStamps(args.VolatileStatusFile, args.StableStatusFile)
+	syntax, err := helm_utils.ParsePlaceholderSyntax(args.PlaceholderSyntax)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	imageStamps, err := loadImageStamps(args.ImageManifest)
+	// Collect all stamp values
+	workspaceStatus, err := helm_utils.LoadWorkspaceStatus(args.StableStatusFile, args.VolatileStatusFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	stamps := []ReplacementGroup{{
+		Name:         "workspace status",
+		Replacements: workspaceStatus,
+	}}
+
+	imageInfos, err := loadImageInfos(args.ImageManifest)
+	if err != nil {
+		log.Fatalf("Error loading image infos: %s", err)
+	}
+	imageStamps := makeImageStamps(imageInfos)
 
 	// Apply substitutions.
-	valuesContent, err = applySubstitutions(valuesContent, args.Substitutions)
+	valuesContent, err = applySubstitutions(valuesContent, args.Substitutions, syntax)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Stamp any templates out of top level helm sources
-	stampedValuesContent, err := applyStamping(string(valuesContent), stamps, imageStamps, true)
+	// Images exposed through named templates don't need to be referenced by values.
+	stampedValuesContent, err := applyStamping(string(valuesContent), stamps, imageStamps, !args.ImageHelpers, syntax)
 	if err != nil {
 		log.Fatal(err)
 	}
-	stampedChartContent, err := applyStamping(string(chartContent), stamps, imageStamps, false)
+	stampedChartContent, err := applyStamping(string(chartContent), stamps, imageStamps, false, syntax)
 	if err != nil {
 		log.Fatal(err)
 	}
-	stampedSchemaContent, err := applyStamping(string(schemaContent), stamps, imageStamps, false)
+	stampedSchemaContent, err := applyStamping(string(schemaContent), stamps, imageStamps, false, syntax)
 	if err != nil {
 		log.Fatal(err)
 	}
-	stampedChartContent, err = sanitizeChartContent(stampedChartContent)
+	stampedChartContent, err = sanitizeChartContent(stampedChartContent, syntax)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if args.BuildInfoAnnotations {
+		stampedChartContent, err = addBuildInfoAnnotations(stampedChartContent, workspaceStatus, imageInfos, args.Label)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Create a directory in which to run helm package
 	helmDir, err := installHelmContent(dir, args.Package, stampedChartContent, stampedValuesContent, stampedSchemaContent, args.TemplatesManifest, args.FilesManifest, args.CrdsManifest, args.DepsManifest)
@@ -1026,6 +1147,13 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if args.ImageHelpers {
+		err = writeImageHelpers(filepath.Join(helmDir, "templates", ImageHelpersTemplate), imageInfos, args.Label)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Build the helm package
 	cmd, err := helm_utils.BuildHelmCommand(filepath.Join(cwd, args.Helm), []string{"package", "."}, filepath.Join(cwd, args.HelmPlugins))
 	if err != nil {
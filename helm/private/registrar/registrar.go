@@ -7,7 +7,6 @@ import (
 	"log"
 	"net/url"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/abrisco/rules_helm/helm/private/helm_utils"
@@ -60,6 +59,8 @@ func main() {
 		log.Fatalf("Error loading command line args: %s", err)
 	}
 
+	argv, isPlan := helm_utils.PlanRequested(argv)
+
 	// Setup flags for helm, chart, registry_url, and image_pushers
 	rawHelmPath := flag.String("helm", "", "Path to helm binary")
 	rawHelmPluginsPath := flag.String("helm_plugins", "", "The path to helm plugins.")
@@ -68,6 +69,7 @@ func main() {
 	rawLoginURL := flag.String("login_url", "", "URL of registry to login to.")
 	pushCmd := flag.String("push_cmd", "push", "Command to publish helm chart.")
 	rawImagePushers := flag.String("image_pushers", "", "Comma-separated list of image pusher executables")
+	rawImageManifest := flag.String("image_manifest", "", "Path to a JSON list of image pushers and the images they push")
 
 	// Parse command line arguments
 	flag.CommandLine.Parse(argv)
@@ -81,12 +83,19 @@ func main() {
 	helmPluginsPath := helm_utils.GetRunfile(*rawHelmPluginsPath)
 	chartPath := helm_utils.GetRunfile(*rawChartPath)
 
-	var imagePushers []string
+	var imagePushers []helm_utils.ImagePusher
 	if *rawImagePushers != "" {
 		for _, pusher := range strings.Split(*rawImagePushers, ",") {
-			imagePushers = append(imagePushers, helm_utils.GetRunfile(pusher))
+			imagePushers = append(imagePushers, helm_utils.ImagePusher{Pusher: helm_utils.GetRunfile(pusher)})
 		}
 	}
+	if *rawImageManifest != "" {
+		pushers, err := helm_utils.LoadImagePushers(helm_utils.GetRunfile(*rawImageManifest))
+		if err != nil {
+			log.Fatal(err)
+		}
+		imagePushers = append(imagePushers, pushers...)
+	}
 
 	// Check for registry login credentials
 	helmUser := os.Getenv("HELM_REGISTRY_USERNAME")
@@ -113,20 +122,41 @@ func main() {
 		helmPassword = os.Getenv("HELM_REGISTRY_PASSWORD")
 	}
 
-	// Proceed with login if both username and password are available
-	if helmUser != "" && helmPassword != "" {
-		loginUrl := *rawLoginURL
-
-		// If an explicit login url was not set, attempt to parse it from registryURL.
-		if loginUrl == "" {
-			host, err := getHostFromURL(*registryURL)
-			if err == nil {
-				loginUrl = host
-			}
+	// If an explicit login url was not set, attempt to parse it from registryURL.
+	loginUrl := *rawLoginURL
+	if loginUrl == "" {
+		host, err := getHostFromURL(*registryURL)
+		if err == nil {
+			loginUrl = host
 		}
+	}
+
+	login := helmUser != "" && helmPassword != ""
+	loginArgs := []string{"registry", "login", "--username", helmUser, "--password-stdin", loginUrl}
+	pushArgs := []string{*pushCmd, chartPath, *registryURL}
 
+	// Describe what would be done without doing it.
+	if isPlan {
+		plan := helm_utils.Plan{
+			Chart:  chartPath,
+			Images: imagePushers,
+		}
+		if login {
+			plan.RegistryHost = loginUrl
+			plan.Commands = append(plan.Commands, append([]string{helmPath}, loginArgs...))
+		}
+		plan.Commands = append(plan.Commands, append([]string{helmPath}, pushArgs...))
+
+		if err := plan.Write(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Proceed with login if both username and password are available
+	if login {
 		log.Printf("Logging into Helm registry `%s`...\n", loginUrl)
-		runHelm(helmPath, []string{"registry", "login", "--username", helmUser, "--password-stdin", loginUrl}, helmPluginsPath, &helmPassword)
+		runHelm(helmPath, loginArgs, helmPluginsPath, &helmPassword)
 	} else if helmUser != "" {
 		log.Printf("WARNING: A Helm registry username was set but no associated `HELM_REGISTRY_PASSWORD`/`HELM_REGISTRY_PASSWORD_FILE` var was found. Skipping `helm registry login`.")
 	} else if helmPassword != "" {
@@ -134,18 +164,19 @@ func main() {
 	}
 
 	// Subprocess image pushers
-	for _, pusher := range imagePushers {
-		cmd := exec.Command(pusher)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		log.Printf("Running image pusher: %s", pusher)
-		if err := cmd.Run(); err != nil {
-			log.Fatalf("Failed to run image pusher %s: %v", pusher, err)
+	if len(imagePushers) > 0 {
+		options, err := helm_utils.PushOptionsFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Pushing %d image(s)...\n", len(imagePushers))
+		if err := helm_utils.PushImages(imagePushers, options); err != nil {
+			log.Fatalf("Failed to push images:\n%s", err)
 		}
 	}
 
 	// Subprocess helm push
 	log.Printf("Running helm %s...\n", *pushCmd)
-	runHelm(helmPath, []string{*pushCmd, chartPath, *registryURL}, helmPluginsPath, nil)
+	runHelm(helmPath, pushArgs, helmPluginsPath, nil)
 }
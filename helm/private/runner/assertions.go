@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+	"gopkg.in/yaml.v3"
+)
+
+// assertion is a structured check of the documents addressed by a target. Supported forms:
+//
+//	<path> == <value>   Every value at the path equals the YAML value.
+//	<path> != <value>   No value at the path equals the YAML value.
+//	<path> =~ <regex>   Every value at the path matches the regex.
+//	<path> exists       The path exists.
+//	<path> absent       The path does not exist.
+//	count == <n>        Exactly n documents are addressed by the target.
+//	=~ <regex>          The text of the documents matches the regex.
+//	!~ <regex>          The text of the documents does not match the regex.
+type assertion struct {
+	raw      string
+	operator string
+	path     []helm_utils.PathSegment
+	value    interface{}
+	regex    *regexp.Regexp
+	count    int
+}
+
+// splitPath splits the leading path from an assertion, allowing quoted keys to contain spaces.
+func splitPath(text string) (string, string) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch {
+		case quote != 0:
+			if text[i] == quote {
+				quote = 0
+			}
+		case text[i] == '"' || text[i] == '\'':
+			quote = text[i]
+		case text[i] == ' ' || text[i] == '\t':
+			return text[:i], strings.TrimSpace(text[i:])
+		}
+	}
+	return text, ""
+}
+
+// parseAssertion parses a single assertion.
+func parseAssertion(text string) (assertion, error) {
+	parsed := assertion{raw: strings.TrimSpace(text)}
+
+	for _, operator := range []string{"=~", "!~"} {
+		if pattern, found := strings.CutPrefix(parsed.raw, operator+" "); found {
+			regex, err := regexp.Compile(strings.TrimSpace(pattern))
+			if err != nil {
+				return parsed, fmt.Errorf("Error compiling regex in assertion `%s`: %w", parsed.raw, err)
+			}
+			parsed.operator = "text " + operator
+			parsed.regex = regex
+			return parsed, nil
+		}
+	}
+
+	path, rest := splitPath(parsed.raw)
+	operator, operand, _ := strings.Cut(rest, " ")
+	operand = strings.TrimSpace(operand)
+	parsed.operator = operator
+
+	if path == "count" {
+		count, err := strconv.Atoi(operand)
+		if operator != "==" || err != nil {
+			return parsed, fmt.Errorf("Invalid assertion `%s`, expected `count == <number>`", parsed.raw)
+		}
+		parsed.operator = "count"
+		parsed.count = count
+		return parsed, nil
+	}
+
+	segments, err := helm_utils.ParsePath(path)
+	if err != nil {
+		return parsed, err
+	}
+	parsed.path = segments
+
+	switch operator {
+	case "exists", "absent":
+		if operand != "" {
+			return parsed, fmt.Errorf("Invalid assertion `%s`, `%s` takes no value", parsed.raw, operator)
+		}
+	case "==", "!=":
+		if operand == "" {
+			return parsed, fmt.Errorf("Invalid assertion `%s`, `%s` requires a value", parsed.raw, operator)
+		}
+		if err := yaml.Unmarshal([]byte(operand), &parsed.value); err != nil {
+			return parsed, fmt.Errorf("Error parsing the value of assertion `%s`: %w", parsed.raw, err)
+		}
+		parsed.value = helm_utils.NormalizeValue(parsed.value)
+	case "=~":
+		regex, err := regexp.Compile(operand)
+		if err != nil {
+			return parsed, fmt.Errorf("Error compiling regex in assertion `%s`: %w", parsed.raw, err)
+		}
+		parsed.regex = regex
+	default:
+		return parsed, fmt.Errorf("Invalid assertion `%s`, unknown operator `%s`", parsed.raw, operator)
+	}
+
+	return parsed, nil
+}
+
+// formatValues renders the values selected by a path.
+func formatValues(values []interface{}) string {
+	switch len(values) {
+	case 0:
+		return "nothing (the path does not exist)"
+	case 1:
+		return helm_utils.FormatValue(values[0])
+	}
+	var formatted []string
+	for _, value := range values {
+		formatted = append(formatted, helm_utils.FormatValue(value))
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
+
+// scalarText returns the text of a scalar value for regex matching.
+func scalarText(value interface{}) (string, bool) {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, nil:
+		return "", false
+	case string:
+		return value.(string), true
+	}
+	return fmt.Sprintf("%v", value), true
+}
+
+// evaluate checks the assertion against the addressed documents, returning a description
+// of the failure or an empty string.
+func (a assertion) evaluate(manifests []helm_utils.Manifest) string {
+	switch a.operator {
+	case "count":
+		if len(manifests) != a.count {
+			return fmt.Sprintf("expected %d documents, got %d", a.count, len(manifests))
+		}
+		return ""
+	case "text =~":
+		if !a.regex.MatchString(content(manifests)) {
+			return fmt.Sprintf("expected the documents to match `%s`", a.regex)
+		}
+		return ""
+	case "text !~":
+		if match := a.regex.FindStringIndex(content(manifests)); match != nil {
+			return fmt.Sprintf("expected the documents not to match `%s`, found `%s`", a.regex, content(manifests)[match[0]:match[1]])
+		}
+		return ""
+	}
+
+	var values []interface{}
+	for _, manifest := range manifests {
+		for _, value := range helm_utils.ResolvePath(manifest.Object, a.path) {
+			values = append(values, helm_utils.NormalizeValue(value))
+		}
+	}
+	path := helm_utils.FormatPath(a.path)
+
+	switch a.operator {
+	case "exists":
+		if len(values) == 0 {
+			return fmt.Sprintf("expected `%s` to exist", path)
+		}
+	case "absent":
+		if len(values) > 0 {
+			return fmt.Sprintf("expected `%s` to be absent, got %s", path, formatValues(values))
+		}
+	case "==":
+		for _, value := range values {
+			if !reflect.DeepEqual(value, a.value) {
+				return fmt.Sprintf("expected `%s` to equal %s, got %s", path, helm_utils.FormatValue(a.value), formatValues(values))
+			}
+		}
+		if len(values) == 0 {
+			return fmt.Sprintf("expected `%s` to equal %s, got %s", path, helm_utils.FormatValue(a.value), formatValues(values))
+		}
+	case "!=":
+		for _, value := range values {
+			if reflect.DeepEqual(value, a.value) {
+				return fmt.Sprintf("expected `%s` not to equal %s", path, helm_utils.FormatValue(a.value))
+			}
+		}
+	case "=~":
+		for _, value := range values {
+			if text, ok := scalarText(value); !ok || !a.regex.MatchString(text) {
+				return fmt.Sprintf("expected `%s` to match `%s`, got %s", path, a.regex, formatValues(values))
+			}
+		}
+		if len(values) == 0 {
+			return fmt.Sprintf("expected `%s` to match `%s`, got %s", path, a.regex, formatValues(values))
+		}
+	}
+
+	return ""
+}
+
+func sortedTargets(assertions map[string][]string) []string {
+	targets := make([]string, 0, len(assertions))
+	for target := range assertions {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// checkAssertions evaluates the assertions for each target and returns a message for
+// every failure.
+func checkAssertions(documents renderedDocuments, assertions map[string][]string) ([]string, error) {
+	var failures []string
+	for _, target := range sortedTargets(assertions) {
+		manifests, found := documents.find(target)
+		for _, text := range assertions[target] {
+			parsed, err := parseAssertion(text)
+			if err != nil {
+				return nil, err
+			}
+
+			// Only document counts may address targets which were not rendered.
+			if !found && parsed.operator != "count" {
+				failures = append(failures, fmt.Sprintf("%s: `%s`: no rendered template or object matches the target", target, parsed.raw))
+				continue
+			}
+
+			if failure := parsed.evaluate(manifests); failure != "" {
+				failures = append(failures, fmt.Sprintf("%s: `%s`: %s", target, parsed.raw, failure))
+			}
+		}
+	}
+	return failures, nil
+}
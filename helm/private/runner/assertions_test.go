@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const assertionsOutput = `---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app.kubernetes.io/name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: app
+          image: registry.io/app:1.0
+          args: ["--port", "8080"]
+        - name: sidecar
+          image: registry.io/sidecar:1.0
+---
+# Source: mychart/templates/configmaps.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+# Source: mychart/templates/configmaps.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+`
+
+func TestCheckAssertions(t *testing.T) {
+	documents, err := indexDocuments(assertionsOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := checkAssertions(documents, map[string][]string{
+		"Deployment//web": {
+			".spec.replicas == 3",
+			`.metadata.labels["app.kubernetes.io/name"] == web`,
+			".spec.template.spec.containers[0].args == [--port, \"8080\"]",
+			".spec.template.spec.containers[*].image =~ ^registry\\.io/",
+			".spec.template.spec.hostNetwork absent",
+			".spec.template.spec.containers[1].name exists",
+			".spec.replicas != \"3\"",
+			"count == 1",
+			"!~ :latest",
+			"=~ sidecar",
+		},
+		"mychart/templates/configmaps.yaml": {
+			"count == 2",
+			".metadata.name exists",
+		},
+		"Secret//missing": {
+			"count == 0",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Errorf("Unexpected failures:\n%s", strings.Join(failures, "\n"))
+	}
+
+	failures, err = checkAssertions(documents, map[string][]string{
+		"Deployment//web": {
+			".spec.replicas == \"3\"",
+			".spec.missing == 1",
+			".spec.template.spec.containers[*].name == app",
+			".spec.replicas absent",
+			"!~ registry\\.io/\\w+",
+		},
+		"mychart/templates/configmaps.yaml": {
+			"count == 1",
+		},
+		"Secret//missing": {
+			".data exists",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Deployment//web: `.spec.replicas == \"3\"`: expected `.spec.replicas` to equal \"3\", got 3",
+		"Deployment//web: `.spec.missing == 1`: expected `.spec.missing` to equal 1, got nothing (the path does not exist)",
+		"Deployment//web: `.spec.template.spec.containers[*].name == app`: expected `.spec.template.spec.containers[*].name` to equal \"app\", got [\"app\", \"sidecar\"]",
+		"Deployment//web: `.spec.replicas absent`: expected `.spec.replicas` to be absent, got 3",
+		"Deployment//web: `!~ registry\\.io/\\w+`: expected the documents not to match `registry\\.io/\\w+`, found `registry.io/app`",
+		"Secret//missing: `.data exists`: no rendered template or object matches the target",
+		"mychart/templates/configmaps.yaml: `count == 1`: expected 1 documents, got 2",
+	}
+	if strings.Join(failures, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected failures:\n%s\nExpected:\n%s", strings.Join(failures, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestParseAssertionErrors(t *testing.T) {
+	for _, text := range []string{
+		"count == two",
+		"count > 1",
+		".spec.replicas ==",
+		".spec.replicas exists 1",
+		".spec..replicas exists",
+		".spec.name =~ (",
+		".spec.name !~ unknown",
+		"!~ (",
+	} {
+		if _, err := parseAssertion(text); err == nil {
+			t.Errorf("Expected an error parsing `%s`", text)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// deploymentRelease is a `helm_install` or `helm_upgrade` target deployed by a `helm_deployment`.
+type deploymentRelease struct {
+	// Label is the label of the target.
+	Label string `json:"label"`
+
+	// Release is the name of the release.
+	Release string `json:"release"`
+
+	// ArgsFile is the runfiles location of the arguments file of the target.
+	ArgsFile string `json:"args_file"`
+
+	// Dependencies are the labels of the releases which must be deployed first.
+	Dependencies []string `json:"dependencies"`
+}
+
+// deploymentConfig describes a `helm_deployment` target.
+type deploymentConfig struct {
+	// Releases are the releases to deploy.
+	Releases []deploymentRelease `json:"releases"`
+
+	// RollbackOnFailure rolls back the releases which were deployed if any release fails.
+	RollbackOnFailure bool `json:"rollback_on_failure"`
+}
+
+func loadDeploymentConfig(path string) (deploymentConfig, error) {
+	var config deploymentConfig
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("Error reading deployment config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("Error parsing deployment config %s: %w", path, err)
+	}
+
+	if _, err := config.stages(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// stages groups the releases into stages whose releases only depend on earlier stages.
+func (c deploymentConfig) stages() ([][]deploymentRelease, error) {
+	remaining := make(map[string]deploymentRelease, len(c.Releases))
+	for _, release := range c.Releases {
+		if _, found := remaining[release.Label]; found {
+			return nil, fmt.Errorf("Release %s is deployed more than once", release.Label)
+		}
+		remaining[release.Label] = release
+	}
+	for _, release := range c.Releases {
+		for _, dependency := range release.Dependencies {
+			if _, found := remaining[dependency]; !found {
+				return nil, fmt.Errorf("Release %s depends on %s, which is not part of the deployment", release.Label, dependency)
+			}
+		}
+	}
+
+	deployed := make(map[string]bool, len(c.Releases))
+	var stages [][]deploymentRelease
+	for len(remaining) > 0 {
+		var stage []deploymentRelease
+		for _, release := range c.Releases {
+			if _, found := remaining[release.Label]; found && allDeployed(release.Dependencies, deployed) {
+				stage = append(stage, release)
+			}
+		}
+
+		if len(stage) == 0 {
+			var cycle []string
+			for label := range remaining {
+				cycle = append(cycle, label)
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("The dependencies of the deployment contain a cycle between:\n  %s", strings.Join(cycle, "\n  "))
+		}
+
+		for _, release := range stage {
+			delete(remaining, release.Label)
+			deployed[release.Label] = true
+		}
+		stages = append(stages, stage)
+	}
+
+	return stages, nil
+}
+
+func allDeployed(dependencies []string, deployed map[string]bool) bool {
+	for _, dependency := range dependencies {
+		if !deployed[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+// deployer deploys the releases of a deployment, running releases whose dependencies
+// have been deployed in parallel.
+type deployer struct {
+	config deploymentConfig
+
+	// deploy deploys a single release.
+	deploy func(release deploymentRelease, output io.Writer) error
+
+	// revision returns the current revision of a release, or 0 if it is not installed.
+	revision func(release deploymentRelease) (int, error)
+
+	// rollback restores a release to a revision, uninstalling it for revision 0.
+	rollback func(release deploymentRelease, revision int, output io.Writer) error
+
+	output io.Writer
+}
+
+// deployResult is the outcome of deploying a single release.
+type deployResult struct {
+	release  deploymentRelease
+	revision int
+	err      error
+}
+
+func (d deployer) deployRelease(release deploymentRelease, lock *sync.Mutex) deployResult {
+	output := helm_utils.NewPrefixWriter(release.Label, d.output, lock)
+	defer output.Flush()
+
+	result := deployResult{release: release}
+	if d.config.RollbackOnFailure {
+		revision, err := d.revision(release)
+		if err != nil {
+			result.err = fmt.Errorf("Error determining the current revision of %s, which is required to roll it back: %w", release.Label, err)
+			return result
+		}
+		result.revision = revision
+	}
+
+	if err := d.deploy(release, output); err != nil {
+		result.err = fmt.Errorf("Error deploying %s: %w", release.Label, err)
+	}
+	return result
+}
+
+// run deploys the releases. Once a release fails no further releases are started, and
+// if requested the releases which were deployed are rolled back in reverse order.
+func (d deployer) run() error {
+	lock := &sync.Mutex{}
+	results := make(chan deployResult)
+
+	started := make(map[string]bool, len(d.config.Releases))
+	deployed := make(map[string]bool, len(d.config.Releases))
+	var completed []deployResult
+	var errs []error
+	running := 0
+
+	for {
+		if len(errs) == 0 {
+			for _, release := range d.config.Releases {
+				if started[release.Label] || !allDeployed(release.Dependencies, deployed) {
+					continue
+				}
+				started[release.Label] = true
+				running++
+				go func(release deploymentRelease) {
+					results <- d.deployRelease(release, lock)
+				}(release)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+		deployed[result.release.Label] = true
+		completed = append(completed, result)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var skipped []string
+	for _, release := range d.config.Releases {
+		if !started[release.Label] {
+			skipped = append(skipped, release.Label)
+		}
+	}
+	if len(skipped) > 0 {
+		errs = append(errs, fmt.Errorf("Releases not deployed because of the failure:\n  %s", strings.Join(skipped, "\n  ")))
+	}
+
+	if d.config.RollbackOnFailure {
+		for i := len(completed) - 1; i >= 0; i-- {
+			result := completed[i]
+			output := helm_utils.NewPrefixWriter(result.release.Label, d.output, lock)
+			if err := d.rollback(result.release, result.revision, output); err != nil {
+				errs = append(errs, fmt.Errorf("Error rolling back %s: %w", result.release.Label, err))
+			}
+			output.Flush()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// readArgsFile reads the arguments of a release, split into runner and helm arguments.
+func readArgsFile(path string) ([]string, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error opening arguments file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var args []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		args = append(args, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("Error reading arguments file %s: %w", path, err)
+	}
+
+	internalArgs, helmArgs := parseArgsUpToDashDash(args)
+	return internalArgs, helmArgs, nil
+}
+
+// runnerFlag returns the value of a runner flag, e.g. `-helm`.
+func runnerFlag(args []string, name string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == name {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// releaseHelm runs helm commands against the release of a `helm_install` target.
+type releaseHelm struct {
+	helm      string
+	plugins   string
+	kubeFlags []string
+}
+
+func newReleaseHelm(argsFile string) (releaseHelm, error) {
+	internalArgs, helmArgs, err := readArgsFile(argsFile)
+	if err != nil {
+		return releaseHelm{}, err
+	}
+
+	helm, plugins := runnerFlag(internalArgs, "-helm"), runnerFlag(internalArgs, "-helm_plugins")
+	if helm == "" || plugins == "" {
+		return releaseHelm{}, fmt.Errorf("Missing required arguments in %s: helm or helm_plugins", argsFile)
+	}
+
+	return releaseHelm{
+		helm:      helm_utils.GetRunfile(helm),
+		plugins:   helm_utils.GetRunfile(plugins),
+		kubeFlags: helm_utils.KubeFlags(helm_utils.ParseHelmCommand(helmArgs)),
+	}, nil
+}
+
+func (h releaseHelm) command(args ...string) (exec.Cmd, error) {
+	cmd, err := helm_utils.BuildHelmCommand(h.helm, append(args, h.kubeFlags...), h.plugins)
+	if err != nil {
+		return cmd, err
+	}
+	cmd.Env = helm_utils.SandboxFreeEnv(cmd.Env)
+	return cmd, nil
+}
+
+// revision returns the latest revision of a release, or 0 if it is not installed.
+func (h releaseHelm) revision(release string) (int, error) {
+	cmd, err := h.command("history", release, "--max", "1", "--output", "json")
+	if err != nil {
+		return 0, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "release: not found") {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%w\n%s", err, stderr.String())
+	}
+
+	var history []struct {
+		Revision int `json:"revision"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &history); err != nil {
+		return 0, fmt.Errorf("Error parsing the history of release %s: %w", release, err)
+	}
+	if len(history) == 0 {
+		return 0, nil
+	}
+	return history[len(history)-1].Revision, nil
+}
+
+// rollback restores a release to a revision, uninstalling it for revision 0.
+func (h releaseHelm) rollback(release string, revision int, output io.Writer) error {
+	args := []string{"uninstall", release}
+	if revision > 0 {
+		args = []string{"rollback", release, strconv.Itoa(revision)}
+	}
+
+	cmd, err := h.command(args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	fmt.Fprintf(output, "Rolling back: %s\n", helm_utils.QuoteCommand(cmd.Args))
+	return cmd.Run()
+}
+
+// releaseEnv is the environment used to run the runner for a single release.
+func releaseEnv(release deploymentRelease, extraEnv ...string) []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, "RULES_HELM_HELM_DEPLOYMENT_CONFIG=") && !strings.HasPrefix(entry, "RULES_HELM_HELM_RUNNER_ARGS_FILE=") {
+			env = append(env, entry)
+		}
+	}
+	env = append(env, helm_utils.RunfilesEnv()...)
+	env = append(env, "RULES_HELM_HELM_RUNNER_ARGS_FILE="+release.ArgsFile)
+	return append(env, extraEnv...)
+}
+
+// runRelease runs the runner for a single release.
+func runRelease(release deploymentRelease, output io.Writer, extraEnv ...string) error {
+	runner, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Error locating the runner: %w", err)
+	}
+
+	cmd := exec.Command(runner)
+	cmd.Env = releaseEnv(release, extraEnv...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	return cmd.Run()
+}
+
+// runDeployment deploys all releases of a `helm_deployment` target.
+func runDeployment(configPath string, isPlan bool) error {
+	config, err := loadDeploymentConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	// Plans are printed one release at a time in the order releases would be deployed.
+	if isPlan {
+		stages, err := config.stages()
+		if err != nil {
+			return err
+		}
+		for i, stage := range stages {
+			for _, release := range stage {
+				fmt.Printf("Stage %d: %s (release `%s`)\n", i+1, release.Label, release.Release)
+				if err := runRelease(release, os.Stdout, "RULES_HELM_PLAN=1"); err != nil {
+					return fmt.Errorf("Error planning %s: %w", release.Label, err)
+				}
+			}
+		}
+		if config.RollbackOnFailure {
+			fmt.Println("Releases which were deployed are rolled back if any release fails.")
+		}
+		return nil
+	}
+
+	helms := make(map[string]releaseHelm, len(config.Releases))
+	if config.RollbackOnFailure {
+		for _, release := range config.Releases {
+			helm, err := newReleaseHelm(helm_utils.GetRunfile(release.ArgsFile))
+			if err != nil {
+				return err
+			}
+			helms[release.Label] = helm
+		}
+	}
+
+	return deployer{
+		config: config,
+		deploy: func(release deploymentRelease, output io.Writer) error {
+			return runRelease(release, output)
+		},
+		revision: func(release deploymentRelease) (int, error) {
+			return helms[release.Label].revision(release.Release)
+		},
+		rollback: func(release deploymentRelease, revision int, output io.Writer) error {
+			return helms[release.Label].rollback(release.Release, revision, output)
+		},
+		output: os.Stderr,
+	}.run()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testReleases are a CRDs chart, two operators depending on it, and an app depending on both.
+func testReleases() []deploymentRelease {
+	return []deploymentRelease{
+		{Label: "//:app", Release: "app", Dependencies: []string{"//:operator_a", "//:operator_b"}},
+		{Label: "//:crds", Release: "crds"},
+		{Label: "//:operator_a", Release: "operator-a", Dependencies: []string{"//:crds"}},
+		{Label: "//:operator_b", Release: "operator-b", Dependencies: []string{"//:crds"}},
+	}
+}
+
+func stageLabels(stages [][]deploymentRelease) string {
+	var labels []string
+	for _, stage := range stages {
+		var stageLabels []string
+		for _, release := range stage {
+			stageLabels = append(stageLabels, release.Label)
+		}
+		labels = append(labels, strings.Join(stageLabels, ","))
+	}
+	return strings.Join(labels, " ")
+}
+
+func TestDeploymentStages(t *testing.T) {
+	stages, err := deploymentConfig{Releases: testReleases()}.stages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := stageLabels(stages); actual != "//:crds //:operator_a,//:operator_b //:app" {
+		t.Errorf("Unexpected stages: %s", actual)
+	}
+
+	cyclic := deploymentConfig{Releases: []deploymentRelease{
+		{Label: "//:a", Dependencies: []string{"//:b"}},
+		{Label: "//:b", Dependencies: []string{"//:a"}},
+		{Label: "//:c"},
+	}}
+	if _, err := cyclic.stages(); err == nil || !strings.Contains(err.Error(), "cycle between:\n  //:a\n  //:b") {
+		t.Errorf("Expected a cycle to be reported, got %v", err)
+	}
+
+	unknown := deploymentConfig{Releases: []deploymentRelease{{Label: "//:a", Dependencies: []string{"//:b"}}}}
+	if _, err := unknown.stages(); err == nil {
+		t.Error("Expected an error for an unknown dependency")
+	}
+}
+
+// fakeDeployer records the order of deploys and rollbacks.
+type fakeDeployer struct {
+	lock      sync.Mutex
+	events    []string
+	running   map[string]bool
+	failures  map[string]bool
+	revisions map[string]int
+}
+
+func (f *fakeDeployer) record(event string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.events = append(f.events, event)
+}
+
+func (f *fakeDeployer) deployer(config deploymentConfig) deployer {
+	return deployer{
+		config: config,
+		deploy: func(release deploymentRelease, output io.Writer) error {
+			for _, dependency := range release.Dependencies {
+				if !f.deployed(dependency) {
+					return fmt.Errorf("%s was deployed before %s", release.Label, dependency)
+				}
+			}
+			fmt.Fprintf(output, "deploying %s\n", release.Release)
+			if f.failures[release.Label] {
+				f.record("failed " + release.Label)
+				return fmt.Errorf("exit status 1")
+			}
+			f.record("deployed " + release.Label)
+			return nil
+		},
+		revision: func(release deploymentRelease) (int, error) {
+			return f.revisions[release.Label], nil
+		},
+		rollback: func(release deploymentRelease, revision int, output io.Writer) error {
+			f.record(fmt.Sprintf("rolled back %s to %d", release.Label, revision))
+			return nil
+		},
+		output: io.Discard,
+	}
+}
+
+func (f *fakeDeployer) deployed(label string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, event := range f.events {
+		if event == "deployed "+label {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeployerRun(t *testing.T) {
+	fake := &fakeDeployer{}
+	if err := fake.deployer(deploymentConfig{Releases: testReleases()}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.events) != 4 || fake.events[0] != "deployed //:crds" || fake.events[3] != "deployed //:app" {
+		t.Errorf("Unexpected deploys: %v", fake.events)
+	}
+}
+
+func TestDeployerStopsOnFailure(t *testing.T) {
+	releases := []deploymentRelease{
+		{Label: "//:crds", Release: "crds"},
+		{Label: "//:operator", Release: "operator", Dependencies: []string{"//:crds"}},
+		{Label: "//:app", Release: "app", Dependencies: []string{"//:operator"}},
+	}
+	fake := &fakeDeployer{
+		failures:  map[string]bool{"//:operator": true},
+		revisions: map[string]int{"//:crds": 3},
+	}
+
+	err := fake.deployer(deploymentConfig{Releases: releases}).run()
+	if err == nil || !strings.Contains(err.Error(), "Error deploying //:operator") || !strings.Contains(err.Error(), "not deployed because of the failure:\n  //:app") {
+		t.Errorf("Expected the operator to fail and the app to be skipped, got %v", err)
+	}
+	expected := []string{"deployed //:crds", "failed //:operator"}
+	if strings.Join(fake.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected events: %v", fake.events)
+	}
+
+	fake.events = nil
+	err = fake.deployer(deploymentConfig{Releases: releases, RollbackOnFailure: true}).run()
+	if err == nil {
+		t.Fatal("Expected the deployment to fail")
+	}
+	expected = []string{"deployed //:crds", "failed //:operator", "rolled back //:crds to 3"}
+	if strings.Join(fake.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected events: %v", fake.events)
+	}
+}
+
+// writeFakeHelm writes a stand-in for helm which logs its arguments and reports a history
+// for the `installed` release only.
+func writeFakeHelm(t *testing.T, dir string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	path := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(dir, "log") + `"
+if [ "$1" = "history" ]; then
+  if [ "$2" = "installed" ]; then
+    echo '[{"revision": 7, "status": "deployed"}]'
+    exit 0
+  fi
+  echo "Error: release: not found" >&2
+  exit 1
+fi
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReleaseHelm(t *testing.T) {
+	dir := t.TempDir()
+	helm := releaseHelm{
+		helm:      writeFakeHelm(t, dir),
+		plugins:   dir,
+		kubeFlags: []string{"--kube-context", "prod", "--namespace", "apps"},
+	}
+
+	revision, err := helm.revision("installed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != 7 {
+		t.Errorf("Expected revision 7, got %d", revision)
+	}
+
+	revision, err = helm.revision("missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != 0 {
+		t.Errorf("Expected no revision for a missing release, got %d", revision)
+	}
+
+	var output bytes.Buffer
+	if err := helm.rollback("installed", 7, &output); err != nil {
+		t.Fatal(err)
+	}
+	if err := helm.rollback("missing", 0, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"history installed --max 1 --output json --kube-context prod --namespace apps",
+		"history missing --max 1 --output json --kube-context prod --namespace apps",
+		"rollback installed 7 --kube-context prod --namespace apps",
+		"uninstall missing --kube-context prod --namespace apps",
+	}
+	if actual := strings.TrimSpace(string(content)); actual != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected helm commands:\n%s", actual)
+	}
+}
+
+func TestNewReleaseHelmRequiresHelm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "args.txt")
+	content := "-chart\nchart.tgz\n--\nupgrade\n--kube-context=prod\nweb\nchart.tgz\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newReleaseHelm(path); err == nil {
+		t.Error("Expected an error for an arguments file without helm")
+	}
+}
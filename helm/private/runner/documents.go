@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// renderedDocuments indexes the documents rendered by `helm template` so they can be
+// addressed either by the template which produced them or by the object they define.
+type renderedDocuments struct {
+	// bySource maps a template path (e.g. `chart/templates/service.yaml`) to the
+	// documents it rendered.
+	bySource map[string][]helm_utils.Manifest
+
+	// byID maps `kind/namespace/name` to the documents defining that object.
+	byID map[string][]helm_utils.Manifest
+}
+
+// indexDocuments parses the output of `helm template`.
+func indexDocuments(output string) (renderedDocuments, error) {
+	manifests, err := helm_utils.ParseManifests(output)
+	if err != nil {
+		return renderedDocuments{}, fmt.Errorf("Error parsing rendered templates: %w", err)
+	}
+
+	documents := renderedDocuments{
+		bySource: map[string][]helm_utils.Manifest{},
+		byID:     map[string][]helm_utils.Manifest{},
+	}
+	for _, manifest := range manifests {
+		if manifest.Source != "" {
+			documents.bySource[manifest.Source] = append(documents.bySource[manifest.Source], manifest)
+		}
+		if manifest.Kind() != "" {
+			documents.byID[manifest.ID()] = append(documents.byID[manifest.ID()], manifest)
+		}
+	}
+
+	return documents, nil
+}
+
+// find returns the documents addressed by target, which is either a template path or
+// an object's `kind/namespace/name`. Template paths take precedence.
+func (d renderedDocuments) find(target string) ([]helm_utils.Manifest, bool) {
+	if manifests, found := d.bySource[target]; found {
+		return manifests, true
+	}
+	manifests, found := d.byID[target]
+	return manifests, found
+}
+
+// content joins the text of documents into a single YAML stream.
+func content(manifests []helm_utils.Manifest) string {
+	var documents []string
+	for _, manifest := range manifests {
+		documents = append(documents, manifest.Content)
+	}
+	return strings.Join(documents, "---\n")
+}
+
+// targets lists every address which may be used to find documents.
+func (d renderedDocuments) targets() []string {
+	var targets []string
+	for source := range d.bySource {
+		targets = append(targets, source)
+	}
+	for id := range d.byID {
+		targets = append(targets, id)
+	}
+	sort.Strings(targets)
+	return targets
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const renderedOutput = `---
+# Source: mychart/templates/configmaps.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  namespace: apps
+data:
+  script: |
+    echo "---"
+    --- not a separator
+---
+# Source: mychart/templates/configmaps.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+data:
+  key: value
+---
+# Source: mychart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+func TestIndexDocuments(t *testing.T) {
+	documents, err := indexDocuments(renderedOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, found := documents.find("mychart/templates/configmaps.yaml")
+	if !found || len(manifests) != 2 {
+		t.Fatalf("Expected both documents from the template, got %d", len(manifests))
+	}
+	text := content(manifests)
+	if !strings.Contains(text, "--- not a separator") || !strings.Contains(text, "name: second") {
+		t.Errorf("Unexpected template content:\n%s", text)
+	}
+
+	manifests, found = documents.find("ConfigMap/apps/first")
+	if !found || len(manifests) != 1 || manifests[0].Name() != "first" {
+		t.Errorf("Expected to find the namespaced object, got %v", manifests)
+	}
+
+	manifests, found = documents.find("Service//web")
+	if !found || manifests[0].Source != "mychart/templates/service.yaml" {
+		t.Errorf("Expected to find the object without a namespace, got %v", manifests)
+	}
+
+	if _, found := documents.find("ConfigMap/default/first"); found {
+		t.Error("Expected no object in the `default` namespace")
+	}
+
+	expected := []string{
+		"ConfigMap//second",
+		"ConfigMap/apps/first",
+		"Service//web",
+		"mychart/templates/configmaps.yaml",
+		"mychart/templates/service.yaml",
+	}
+	if strings.Join(documents.targets(), ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected targets: %v", documents.targets())
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// Conditions under which a post-deploy hook runs.
+const (
+	hookOnSuccess = "success"
+	hookOnFailure = "failure"
+	hookAlways    = "always"
+)
+
+// postHook is a hook run after the helm command.
+type postHook struct {
+	// Executable is the runfiles location of the hook.
+	Executable string `json:"executable"`
+
+	// When is the condition under which the hook runs.
+	When string `json:"when"`
+}
+
+// hooksConfig describes the hooks of a `helm_install` or `helm_upgrade` target.
+type hooksConfig struct {
+	// Release is the name of the release.
+	Release string `json:"release"`
+
+	// Metadata is the runfiles location of the metadata of the chart.
+	Metadata string `json:"metadata"`
+
+	// Pre are the hooks run before the helm command.
+	Pre []string `json:"pre"`
+
+	// Post are the hooks run after the helm command.
+	Post []postHook `json:"post"`
+}
+
+func loadHooksConfig(path string) (hooksConfig, error) {
+	var config hooksConfig
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("Error reading hooks config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("Error parsing hooks config %s: %w", path, err)
+	}
+
+	for _, hook := range config.Post {
+		switch hook.When {
+		case hookOnSuccess, hookOnFailure, hookAlways:
+		default:
+			return config, fmt.Errorf("Unknown condition `%s` for post-deploy hook %s", hook.When, hook.Executable)
+		}
+	}
+
+	return config, nil
+}
+
+// describe describes every hook for plans.
+func (c hooksConfig) describe() []string {
+	var descriptions []string
+	for _, hook := range c.Pre {
+		descriptions = append(descriptions, "pre: "+hook)
+	}
+	for _, hook := range c.Post {
+		descriptions = append(descriptions, fmt.Sprintf("post (on %s): %s", hook.When, hook.Executable))
+	}
+	return descriptions
+}
+
+// runsAfter reports whether a post-deploy hook runs after the helm command exited with exitCode.
+func (h postHook) runsAfter(exitCode int) bool {
+	switch h.When {
+	case hookAlways:
+		return true
+	case hookOnFailure:
+		return exitCode != 0
+	default:
+		return exitCode == 0
+	}
+}
+
+// chartMetadata is the metadata `helm_package` writes for a chart.
+type chartMetadata struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func loadChartMetadata(path string) (chartMetadata, error) {
+	var metadata chartMetadata
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return metadata, fmt.Errorf("Error reading chart metadata %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return metadata, fmt.Errorf("Error parsing chart metadata %s: %w", path, err)
+	}
+
+	return metadata, nil
+}
+
+// hookRunner runs deploy hooks with information about the release.
+type hookRunner struct {
+	// env is the environment shared by every hook.
+	env []string
+}
+
+// newHookRunner creates a hookRunner exposing the release to hooks.
+func newHookRunner(release string, namespace string, context string, metadata chartMetadata, runfilesEnv []string) hookRunner {
+	env := append(os.Environ(), runfilesEnv...)
+	env = append(env,
+		"RULES_HELM_RELEASE_NAME="+release,
+		"RULES_HELM_RELEASE_NAMESPACE="+namespace,
+		"RULES_HELM_KUBE_CONTEXT="+context,
+		"RULES_HELM_CHART_NAME="+metadata.Name,
+		"RULES_HELM_CHART_VERSION="+metadata.Version,
+	)
+	return hookRunner{env: env}
+}
+
+// run runs a hook, returning an error if it fails.
+func (r hookRunner) run(executable string, phase string, extraEnv ...string) error {
+	cmd := exec.Command(executable)
+	cmd.Env = append(append(append([]string{}, r.env...), "RULES_HELM_HOOK_PHASE="+phase), extraEnv...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("The %s-deploy hook %s failed: %w", phase, executable, err)
+	}
+	return nil
+}
+
+// runPre runs every pre-deploy hook, stopping at the first failure.
+func (r hookRunner) runPre(hooks []string) error {
+	for _, hook := range hooks {
+		if err := r.run(hook, "pre"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPost runs the post-deploy hooks whose condition matches the exit code of helm.
+// Every matching hook runs even if another fails, and all failures are returned.
+func (r hookRunner) runPost(hooks []postHook, exitCode int) []error {
+	var errs []error
+	for _, hook := range hooks {
+		if !hook.runsAfter(exitCode) {
+			continue
+		}
+		if err := r.run(hook.Executable, "post", "RULES_HELM_HELM_EXIT_CODE="+strconv.Itoa(exitCode)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// resolve resolves the runfiles locations of every hook.
+func (c *hooksConfig) resolve() {
+	for i, hook := range c.Pre {
+		c.Pre[i] = helm_utils.GetRunfile(hook)
+	}
+	for i, hook := range c.Post {
+		c.Post[i].Executable = helm_utils.GetRunfile(hook.Executable)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeHook writes a hook which appends its phase and environment to a log.
+func writeHook(t *testing.T, dir string, name string, exitCode int) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	path := filepath.Join(dir, name)
+	script := `#!/bin/sh
+echo "` + name + ` $RULES_HELM_HOOK_PHASE $RULES_HELM_RELEASE_NAME $RULES_HELM_RELEASE_NAMESPACE $RULES_HELM_CHART_VERSION exit=$RULES_HELM_HELM_EXIT_CODE" >> "` + filepath.Join(dir, "log") + `"
+exit ` + strconv.Itoa(exitCode) + `
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readLog(t *testing.T, dir string) []string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, "log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestLoadHooksConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hooks.json")
+
+	content := `{"release": "web", "pre": ["migrate"], "post": [{"executable": "smoke", "when": "success"}, {"executable": "alert", "when": "failure"}]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadHooksConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"pre: migrate", "post (on success): smoke", "post (on failure): alert"}
+	if strings.Join(config.describe(), "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected hooks: %v", config.describe())
+	}
+
+	content = `{"post": [{"executable": "smoke", "when": "sometimes"}]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHooksConfig(path); err == nil {
+		t.Error("Expected an error for an unknown condition")
+	}
+}
+
+func TestRunsAfter(t *testing.T) {
+	tests := []struct {
+		when     string
+		exitCode int
+		expected bool
+	}{
+		{hookOnSuccess, 0, true},
+		{hookOnSuccess, 1, false},
+		{hookOnFailure, 0, false},
+		{hookOnFailure, 1, true},
+		{hookAlways, 0, true},
+		{hookAlways, 1, true},
+	}
+
+	for _, test := range tests {
+		if actual := (postHook{When: test.when}).runsAfter(test.exitCode); actual != test.expected {
+			t.Errorf("runsAfter(%d) for `%s` = %v, expected %v", test.exitCode, test.when, actual, test.expected)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	runner := newHookRunner("web", "apps", "prod", chartMetadata{Name: "chart", Version: "1.2.3"}, nil)
+
+	pre := []string{writeHook(t, dir, "migrate", 0), writeHook(t, dir, "seed", 0)}
+	if err := runner.runPre(pre); err != nil {
+		t.Fatal(err)
+	}
+
+	post := []postHook{
+		{Executable: writeHook(t, dir, "smoke", 1), When: hookOnSuccess},
+		{Executable: writeHook(t, dir, "alert", 0), When: hookOnFailure},
+		{Executable: writeHook(t, dir, "report", 0), When: hookAlways},
+	}
+	if errs := runner.runPost(post, 0); len(errs) != 1 || !strings.Contains(errs[0].Error(), "smoke") {
+		t.Errorf("Expected only the smoke hook to fail, got %v", errs)
+	}
+	if errs := runner.runPost(post, 1); len(errs) != 0 {
+		t.Errorf("Expected no failures, got %v", errs)
+	}
+
+	expected := []string{
+		"migrate pre web apps 1.2.3 exit=",
+		"seed pre web apps 1.2.3 exit=",
+		"smoke post web apps 1.2.3 exit=0",
+		"report post web apps 1.2.3 exit=0",
+		"alert post web apps 1.2.3 exit=1",
+		"report post web apps 1.2.3 exit=1",
+	}
+	if log := readLog(t, dir); strings.Join(log, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected hook runs:\n%s", strings.Join(log, "\n"))
+	}
+}
+
+func TestRunPreHooksStopsOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	runner := newHookRunner("web", "apps", "prod", chartMetadata{}, nil)
+
+	pre := []string{writeHook(t, dir, "migrate", 1), writeHook(t, dir, "seed", 0)}
+	if err := runner.runPre(pre); err == nil || !strings.Contains(err.Error(), "pre-deploy hook") {
+		t.Errorf("Expected the pre-deploy hook to fail, got %v", err)
+	}
+
+	if log := readLog(t, dir); len(log) != 1 {
+		t.Errorf("Expected hooks after a failure not to run:\n%s", strings.Join(log, "\n"))
+	}
+}
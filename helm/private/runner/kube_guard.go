@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// kubeGuard restricts the clusters and namespaces a target may operate on.
+type kubeGuard struct {
+	// Release is the name of the release.
+	Release string `json:"release"`
+
+	// Contexts are the kube contexts the target may use. Any context is allowed if empty.
+	Contexts []string `json:"contexts"`
+
+	// Clusters are the clusters the target may use. Any cluster is allowed if empty.
+	Clusters []string `json:"clusters"`
+
+	// Namespace is the namespace the target must use, if set.
+	Namespace string `json:"namespace"`
+
+	// ProductionContexts are the kube contexts which require confirmation before use.
+	ProductionContexts []string `json:"production_contexts"`
+}
+
+func loadKubeGuard(path string) (kubeGuard, error) {
+	var guard kubeGuard
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return guard, fmt.Errorf("Error reading kube guard %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, &guard); err != nil {
+		return guard, fmt.Errorf("Error parsing kube guard %s: %w", path, err)
+	}
+
+	return guard, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error describing every way the target violates the guard.
+func (g kubeGuard) check(target helm_utils.KubeTarget) error {
+	var violations []string
+	if len(g.Contexts) > 0 && !contains(g.Contexts, target.Context) {
+		violations = append(violations, fmt.Sprintf("kube context `%s` is not one of: %s", target.Context, strings.Join(g.Contexts, ", ")))
+	}
+	if len(g.Clusters) > 0 && !contains(g.Clusters, target.Cluster) {
+		violations = append(violations, fmt.Sprintf("cluster `%s` of kube context `%s` is not one of: %s", target.Cluster, target.Context, strings.Join(g.Clusters, ", ")))
+	}
+	if g.Namespace != "" && g.Namespace != target.Namespace {
+		violations = append(violations, fmt.Sprintf("namespace `%s` is not the required namespace `%s`", target.Namespace, g.Namespace))
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	kubeconfig := target.Kubeconfig
+	if kubeconfig == "" {
+		kubeconfig = "<none>"
+	}
+	return fmt.Errorf("Refusing to run against an unexpected cluster (kubeconfig: %s):\n  %s", kubeconfig, strings.Join(violations, "\n  "))
+}
+
+// isProduction reports whether using the target requires confirmation.
+func (g kubeGuard) isProduction(target helm_utils.KubeTarget) bool {
+	return contains(g.ProductionContexts, target.Context)
+}
+
+// confirm asks for the name of a production context to be typed before using it. Setting
+// `RULES_HELM_CONFIRM_KUBE_CONTEXT` to the name of the context confirms it non-interactively.
+func (g kubeGuard) confirm(target helm_utils.KubeTarget, input io.Reader, interactive bool, output io.Writer) error {
+	if !g.isProduction(target) {
+		return nil
+	}
+	if os.Getenv("RULES_HELM_CONFIRM_KUBE_CONTEXT") == target.Context {
+		return nil
+	}
+	if !interactive {
+		return fmt.Errorf("Kube context `%s` is marked as production and requires confirmation. Run interactively or set RULES_HELM_CONFIRM_KUBE_CONTEXT=%s", target.Context, target.Context)
+	}
+
+	fmt.Fprintf(output, "Release `%s` is about to be changed in production kube context `%s` (namespace `%s`).\n", g.Release, target.Context, target.Namespace)
+	fmt.Fprintf(output, "Type the name of the kube context to continue: ")
+
+	answer, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("Error reading confirmation: %w", err)
+	}
+	if strings.TrimSpace(answer) != target.Context {
+		return fmt.Errorf("Kube context `%s` was not confirmed", target.Context)
+	}
+	return nil
+}
+
+// isTerminal reports whether a file is an interactive terminal.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
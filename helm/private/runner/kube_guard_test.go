@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+func TestLoadKubeGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kube_guard.json")
+	content := `{"release": "web", "contexts": ["staging"], "clusters": [], "namespace": "apps", "production_contexts": ["prod"]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	guard, err := loadKubeGuard(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guard.Release != "web" || guard.Namespace != "apps" || len(guard.Contexts) != 1 || len(guard.ProductionContexts) != 1 {
+		t.Errorf("Unexpected guard: %+v", guard)
+	}
+}
+
+func TestKubeGuardCheck(t *testing.T) {
+	staging := helm_utils.KubeTarget{Kubeconfig: "/kubeconfig", Context: "staging", Cluster: "staging-cluster", Namespace: "apps"}
+
+	tests := []struct {
+		name       string
+		guard      kubeGuard
+		violations []string
+	}{
+		{
+			name:  "unrestricted",
+			guard: kubeGuard{},
+		},
+		{
+			name:  "allowed",
+			guard: kubeGuard{Contexts: []string{"dev", "staging"}, Clusters: []string{"staging-cluster"}, Namespace: "apps"},
+		},
+		{
+			name:       "wrong context",
+			guard:      kubeGuard{Contexts: []string{"dev"}},
+			violations: []string{"kube context `staging` is not one of: dev"},
+		},
+		{
+			name:  "wrong cluster and namespace",
+			guard: kubeGuard{Clusters: []string{"dev-cluster"}, Namespace: "web"},
+			violations: []string{
+				"cluster `staging-cluster` of kube context `staging` is not one of: dev-cluster",
+				"namespace `apps` is not the required namespace `web`",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.guard.check(staging)
+			if len(test.violations) == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected the guard to refuse the target")
+			}
+			if !strings.Contains(err.Error(), "kubeconfig: /kubeconfig") {
+				t.Errorf("Expected the kubeconfig to be reported: %s", err)
+			}
+			for _, violation := range test.violations {
+				if !strings.Contains(err.Error(), violation) {
+					t.Errorf("Expected `%s` in: %s", violation, err)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeGuardConfirm(t *testing.T) {
+	t.Setenv("RULES_HELM_CONFIRM_KUBE_CONTEXT", "")
+
+	guard := kubeGuard{Release: "web", ProductionContexts: []string{"prod"}}
+	prod := helm_utils.KubeTarget{Context: "prod", Namespace: "apps"}
+	var output bytes.Buffer
+
+	if err := guard.confirm(helm_utils.KubeTarget{Context: "staging"}, strings.NewReader(""), false, &output); err != nil {
+		t.Errorf("Expected contexts which are not production to need no confirmation: %s", err)
+	}
+
+	if err := guard.confirm(prod, strings.NewReader("prod\n"), false, &output); err == nil {
+		t.Error("Expected confirmation to be required when not interactive")
+	}
+
+	if err := guard.confirm(prod, strings.NewReader("staging\n"), true, &output); err == nil {
+		t.Error("Expected a mismatched answer to be refused")
+	}
+
+	if err := guard.confirm(prod, strings.NewReader("prod\n"), true, &output); err != nil {
+		t.Errorf("Expected the context to be confirmed: %s", err)
+	}
+	if !strings.Contains(output.String(), "Release `web` is about to be changed in production kube context `prod`") {
+		t.Errorf("Unexpected prompt:\n%s", output.String())
+	}
+
+	t.Setenv("RULES_HELM_CONFIRM_KUBE_CONTEXT", "prod")
+	if err := guard.confirm(prod, strings.NewReader(""), false, &output); err != nil {
+		t.Errorf("Expected the environment to confirm the context: %s", err)
+	}
+}
@@ -33,29 +33,6 @@ func parseArgsUpToDashDash(argv []string) ([]string, []string) {
 	return before, after
 }
 
-// ParseHelmOutput extracts sections of Helm output and maps them to their respective sources.
-func parseHelmOutput(input string) map[string]string {
-	result := make(map[string]string)
-	sections := strings.Split(input, "---")
-	sourceRegex := regexp.MustCompile(`(?m)^# Source: (.+)$`)
-
-	for _, section := range sections {
-		section = strings.TrimSpace(section)
-		if section == "" {
-			continue
-		}
-
-		matches := sourceRegex.FindStringSubmatch(section)
-		if len(matches) > 1 {
-			source := matches[1]
-			content := strings.TrimSpace(strings.Replace(section, matches[0], "", 1))
-			result[source] = content
-		}
-	}
-
-	return result
-}
-
 func loadTemplatePatterns(path string) (map[string][]string, error) {
 	var data map[string][]string
 
@@ -76,6 +53,15 @@ func loadTemplatePatterns(path string) (map[string][]string, error) {
 }
 
 func main() {
+	// Deploy a set of releases when running a `helm_deployment` target.
+	if configRlocation := os.Getenv("RULES_HELM_HELM_DEPLOYMENT_CONFIG"); configRlocation != "" {
+		_, is_plan := helm_utils.PlanRequested(os.Args[1:])
+		if err := runDeployment(helm_utils.GetRunfile(configRlocation), is_plan); err != nil {
+			log.Fatalf("Deployment failed:\n%s", err)
+		}
+		os.Exit(0)
+	}
+
 	// Get the file path for args
 	argsRlocation := os.Getenv("RULES_HELM_HELM_RUNNER_ARGS_FILE")
 	if argsRlocation == "" {
@@ -90,6 +76,8 @@ func main() {
 		log.Fatalf("Error loading command line args: %s", err)
 	}
 
+	argv, is_plan := helm_utils.PlanRequested(argv)
+
 	internalArgs, helmArgs := parseArgsUpToDashDash(argv)
 
 	// Setup flags for helm, chart, registry_url, and image_pushers
@@ -97,6 +85,9 @@ func main() {
 	rawHelmPluginsPath := flag.String("helm_plugins", "", "The path to helm plugins.")
 	rawChartPath := flag.String("chart", "", "Path to Helm .tgz file")
 	rawImagePushers := flag.String("image_pushers", "", "Comma-separated list of image pusher executables")
+	rawImageManifest := flag.String("image_manifest", "", "Path to a JSON list of image pushers and the images they push")
+	rawHooks := flag.String("hooks", "", "Path to a JSON description of pre- and post-deploy hooks")
+	rawKubeGuard := flag.String("kube_guard", "", "Path to a JSON description of the allowed kube contexts and namespace")
 
 	// Parse command line arguments
 	flag.CommandLine.Parse(internalArgs)
@@ -104,51 +95,131 @@ func main() {
 	_, is_test := os.LookupEnv("RULES_HELM_HELM_TEMPLATE_TEST")
 	_, is_debug := os.LookupEnv("RULES_HELM_DEBUG")
 
-	// force template when testing and check in uninstall
-	is_uninstall := false
-	for _, item := range helmArgs {
-		is_uninstall = is_uninstall || item == "uninstall"
-		if is_test {
-			if item == "install" || item == "upgrade" {
-				item = "template"
-			}
+	// Render installs and upgrades when testing so they can be checked without a cluster.
+	if is_test {
+		helmArgs, err = helm_utils.ConvertToTemplateArgs(helmArgs)
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
 
+	command := helm_utils.ParseHelmCommand(helmArgs)
+
 	// Check required arguments
-	if *rawHelmPath == "" || *rawHelmPluginsPath == "" || (!is_uninstall && *rawChartPath == "") {
+	if *rawHelmPath == "" || *rawHelmPluginsPath == "" || (command.RequiresChart() && *rawChartPath == "") {
 		log.Fatalf("Missing required arguments: helm, helm_plugins or chart")
 	}
 
 	helmPath := helm_utils.GetRunfile(*rawHelmPath)
 	helmPluginsPath := helm_utils.GetRunfile(*rawHelmPluginsPath)
 
-	// Update the chart path whenever it's found.
+	// Point the chart argument at the chart in runfiles.
+	var chartPath string
 	if *rawChartPath != "" {
-		chartPath := helm_utils.GetRunfile(*rawChartPath)
-		for i, item := range helmArgs {
-			helmArgs[i] = strings.ReplaceAll(item, *rawChartPath, chartPath)
+		chartPath = helm_utils.GetRunfile(*rawChartPath)
+		if !command.ReplaceChart(*rawChartPath, chartPath) && command.RequiresChart() {
+			log.Fatalf("Unable to locate the chart `%s` within the arguments of `helm %s`: %s", *rawChartPath, command.Subcommand, strings.Join(helmArgs, " "))
 		}
+		helmArgs = command.Args()
 	}
 
-	var imagePushers []string
+	var imagePushers []helm_utils.ImagePusher
 	if *rawImagePushers != "" {
 		for _, pusher := range strings.Split(*rawImagePushers, ",") {
-			imagePushers = append(imagePushers, helm_utils.GetRunfile(pusher))
+			imagePushers = append(imagePushers, helm_utils.ImagePusher{Pusher: helm_utils.GetRunfile(pusher)})
+		}
+	}
+	if *rawImageManifest != "" {
+		pushers, err := helm_utils.LoadImagePushers(helm_utils.GetRunfile(*rawImageManifest))
+		if err != nil {
+			log.Fatal(err)
+		}
+		imagePushers = append(imagePushers, pushers...)
+	}
+
+	// Deploy hooks never run when testing.
+	var hooks hooksConfig
+	if *rawHooks != "" && !is_test {
+		hooks, err = loadHooksConfig(helm_utils.GetRunfile(*rawHooks))
+		if err != nil {
+			log.Fatal(err)
+		}
+		hooks.resolve()
+	}
+	has_hooks := len(hooks.Pre) > 0 || len(hooks.Post) > 0
+
+	// Refuse to operate on clusters and namespaces the target does not allow.
+	if *rawKubeGuard != "" && !is_test {
+		guard, err := loadKubeGuard(helm_utils.GetRunfile(*rawKubeGuard))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		kube, err := helm_utils.ResolveKubeTarget(command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := guard.check(kube); err != nil {
+			log.Fatal(err)
+		}
+		if !is_plan {
+			if err := guard.confirm(kube, os.Stdin, isTerminal(os.Stdin), os.Stderr); err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
 
+	// Describe what would be done without doing it.
+	if is_plan && !is_test {
+		kube, err := helm_utils.ResolveKubeTarget(command)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		plan := helm_utils.Plan{
+			Commands: [][]string{append([]string{helmPath}, helmArgs...)},
+			Chart:    chartPath,
+			Kube:     &kube,
+			Images:   imagePushers,
+			Hooks:    hooks.describe(),
+		}
+		if err := plan.Write(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	// Subprocess image pushers
-	if !is_test {
-		for _, pusher := range imagePushers {
-			cmd := exec.Command(pusher)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-
-			if err := cmd.Run(); err != nil {
-				log.Fatalf("Failed to run image pusher %s: %v", pusher, err)
+	if !is_test && len(imagePushers) > 0 {
+		options, err := helm_utils.PushOptionsFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := helm_utils.PushImages(imagePushers, options); err != nil {
+			log.Fatalf("Failed to push images:\n%s", err)
+		}
+	}
+
+	// Run pre-deploy hooks, any of which failing aborts the deploy.
+	var hook_runner hookRunner
+	if has_hooks {
+		kube, err := helm_utils.ResolveKubeTarget(command)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var metadata chartMetadata
+		if hooks.Metadata != "" {
+			metadata, err = loadChartMetadata(helm_utils.GetRunfile(hooks.Metadata))
+			if err != nil {
+				log.Fatal(err)
 			}
 		}
+
+		hook_runner = newHookRunner(hooks.Release, kube.Namespace, kube.Context, metadata, helm_utils.RunfilesEnv())
+		if err := hook_runner.runPre(hooks.Pre); err != nil {
+			log.Fatalf("%s\nAborting the deploy.", err)
+		}
 	}
 
 	cmd, err := helm_utils.BuildHelmCommand(helmPath, helmArgs, helmPluginsPath)
@@ -159,8 +230,9 @@ func main() {
 	var test_stream bytes.Buffer
 
 	if is_test {
+		// Only stdout is parsed so warnings from helm are not mistaken for documents.
 		cmd.Stdout = &test_stream
-		cmd.Stderr = &test_stream
+		cmd.Stderr = os.Stderr
 	} else {
 		cmd.Env = helm_utils.SandboxFreeEnv(cmd.Env)
 		cmd.Stdout = os.Stdout
@@ -172,7 +244,6 @@ func main() {
 	}
 
 	var exitCode int = 0
-	var cmdError error = nil
 
 	cmdErr := cmd.Run()
 	if cmdErr != nil {
@@ -181,45 +252,107 @@ func main() {
 				exitCode = status.ExitStatus()
 			}
 		} else {
-			cmdError = cmdErr
+			// Helm could not be run at all, which is still reported to the post-deploy hooks.
+			log.Println(cmdErr)
 			exitCode = 1
 		}
 	}
 
-	if cmdError != nil {
-		log.Fatal(cmdError)
+	// Run the post-deploy hooks matching the outcome of helm.
+	if has_hooks {
+		if errs := hook_runner.runPost(hooks.Post, exitCode); len(errs) > 0 {
+			for _, err := range errs {
+				log.Println(err)
+			}
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
 	}
 
-	// Perform any regex pattern checks requested.
+	// Perform any regex pattern checks and assertions requested.
 	if is_test {
 		fmt.Print(test_stream.String())
 
-		patternsVar, exists := os.LookupEnv("RULES_HELM_HELM_TEMPLATE_TEST_PATTERNS")
-		if exists {
-			patternsFile := helm_utils.GetRunfile(patternsVar)
-			patterns, err := loadTemplatePatterns(patternsFile)
+		snapshotVar, hasSnapshot := os.LookupEnv("RULES_HELM_HELM_TEMPLATE_TEST_SNAPSHOT")
+		if hasSnapshot && exitCode == 0 {
+			config, err := loadSnapshotConfig(helm_utils.GetRunfile(snapshotVar))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			update := os.Getenv("RULES_HELM_UPDATE_SNAPSHOTS") == "1"
+			if err := checkSnapshot(test_stream.String(), config, helm_utils.GetRunfile(config.Snapshot), update); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Record which templates of the chart rendered documents.
+		if *rawChartPath != "" && exitCode == 0 {
+			coverage, err := helm_utils.NewTemplateCoverage(helm_utils.GetRunfile(*rawChartPath))
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			templates := parseHelmOutput(test_stream.String())
-			for templatePath, testPatterns := range patterns {
-				content, found := templates[templatePath]
-				if !found {
-					log.Fatalf("Template not found in the helm chart: %s", templatePath)
+			manifests, err := helm_utils.ParseManifests(test_stream.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+			coverage.Record(manifests)
+
+			if err := helm_utils.WriteTemplateCoverage(coverage); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		patternsVar, hasPatterns := os.LookupEnv("RULES_HELM_HELM_TEMPLATE_TEST_PATTERNS")
+		assertionsVar, hasAssertions := os.LookupEnv("RULES_HELM_HELM_TEMPLATE_TEST_ASSERTIONS")
+		if (hasPatterns || hasAssertions) && exitCode == 0 {
+			documents, err := indexDocuments(test_stream.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if hasPatterns {
+				patterns, err := loadTemplatePatterns(helm_utils.GetRunfile(patternsVar))
+				if err != nil {
+					log.Fatal(err)
 				}
 
-				for _, pattern := range testPatterns {
-					regex, err := regexp.Compile(pattern)
-					if err != nil {
-						log.Fatal("Error compiling regex:", err)
+				for templatePath, testPatterns := range patterns {
+					manifests, found := documents.find(templatePath)
+					if !found {
+						log.Fatalf("Template not found in the helm chart: %s\nAvailable templates and objects:\n  %s", templatePath, strings.Join(documents.targets(), "\n  "))
 					}
+					text := content(manifests)
+
+					for _, pattern := range testPatterns {
+						regex, err := regexp.Compile(pattern)
+						if err != nil {
+							log.Fatal("Error compiling regex:", err)
+						}
 
-					if !regex.MatchString(content) {
-						log.Fatalf("Error: The file `%s` does not contain the pattern:\n```\n%s\n```", templatePath, pattern)
+						if !regex.MatchString(text) {
+							log.Fatalf("Error: The file `%s` does not contain the pattern:\n```\n%s\n```", templatePath, pattern)
+						}
 					}
 				}
 			}
+
+			if hasAssertions {
+				assertions, err := loadTemplatePatterns(helm_utils.GetRunfile(assertionsVar))
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				failures, err := checkAssertions(documents, assertions)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if len(failures) > 0 {
+					log.Fatalf("%d assertion(s) failed:\n  %s", len(failures), strings.Join(failures, "\n  "))
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+	"gopkg.in/yaml.v3"
+)
+
+// snapshotConfig describes the golden snapshot of a `helm_template_test`.
+type snapshotConfig struct {
+	// Snapshot is the runfiles location of the golden file.
+	Snapshot string `json:"snapshot"`
+
+	// Path is the location of the golden file relative to the workspace root.
+	Path string `json:"path"`
+
+	// Masks are paths whose values are replaced in snapshots.
+	Masks []string `json:"masks"`
+}
+
+func loadSnapshotConfig(path string) (snapshotConfig, error) {
+	var config snapshotConfig
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("Error reading snapshot config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("Error parsing snapshot config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// maskedValue replaces the values of masked paths in snapshots.
+const maskedValue = "<masked>"
+
+// maskPath replaces every value selected by path within object.
+func maskPath(object interface{}, path []helm_utils.PathSegment) {
+	if len(path) == 0 {
+		return
+	}
+
+	parents := helm_utils.ResolvePath(object, path[:len(path)-1])
+	last := path[len(path)-1]
+	for _, parent := range parents {
+		switch typed := parent.(type) {
+		case map[string]interface{}:
+			for key := range typed {
+				if last.Wildcard || (!last.IsIndex && key == last.Key) {
+					typed[key] = maskedValue
+				}
+			}
+		case []interface{}:
+			for i := range typed {
+				index := last.Index
+				if index < 0 {
+					index += len(typed)
+				}
+				if last.Wildcard || (last.IsIndex && i == index) {
+					typed[i] = maskedValue
+				}
+			}
+		}
+	}
+}
+
+// normalizeSnapshot renders the output of `helm template` in a stable form: documents are
+// sorted by their template and object, keys are sorted, and masked paths are replaced.
+func normalizeSnapshot(output string, masks []string) (string, error) {
+	var paths [][]helm_utils.PathSegment
+	for _, mask := range masks {
+		path, err := helm_utils.ParsePath(mask)
+		if err != nil {
+			return "", err
+		}
+		paths = append(paths, path)
+	}
+
+	manifests, err := helm_utils.ParseManifests(output)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing rendered templates: %w", err)
+	}
+
+	sort.SliceStable(manifests, func(i, j int) bool {
+		if manifests[i].Source != manifests[j].Source {
+			return manifests[i].Source < manifests[j].Source
+		}
+		return manifests[i].ID() < manifests[j].ID()
+	})
+
+	var builder strings.Builder
+	for _, manifest := range manifests {
+		for _, path := range paths {
+			maskPath(manifest.Object, path)
+		}
+
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(manifest.Object); err != nil {
+			return "", fmt.Errorf("Error rendering %s: %w", manifest.ID(), err)
+		}
+		encoder.Close()
+
+		builder.WriteString("---\n")
+		if manifest.Source != "" {
+			fmt.Fprintf(&builder, "# Source: %s\n", manifest.Source)
+		}
+		builder.Write(buffer.Bytes())
+	}
+
+	return builder.String(), nil
+}
+
+// checkSnapshot compares the normalized output with the golden snapshot. When updating,
+// the snapshot within the workspace is rewritten instead.
+func checkSnapshot(output string, config snapshotConfig, snapshotPath string, update bool) error {
+	workspacePath := config.Path
+	rendered, err := normalizeSnapshot(output, config.Masks)
+	if err != nil {
+		return err
+	}
+
+	if update {
+		workspaceDir, found := os.LookupEnv("BUILD_WORKSPACE_DIRECTORY")
+		if !found {
+			return fmt.Errorf("Snapshots can only be updated with `bazel run`")
+		}
+		if strings.HasPrefix(workspacePath, "../") {
+			return fmt.Errorf("Snapshot `%s` is not in the current workspace and cannot be updated", workspacePath)
+		}
+		target := filepath.Join(workspaceDir, filepath.FromSlash(workspacePath))
+		if err := os.WriteFile(target, []byte(rendered), 0644); err != nil {
+			return fmt.Errorf("Error updating snapshot %s: %w", target, err)
+		}
+		fmt.Fprintf(os.Stderr, "Updated snapshot %s\n", workspacePath)
+		return nil
+	}
+
+	golden, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("Error reading snapshot %s: %w", workspacePath, err)
+	}
+
+	diff := helm_utils.UnifiedDiff(workspacePath, "rendered", string(golden), rendered, 3)
+	if diff == "" {
+		return nil
+	}
+
+	target := os.Getenv("TEST_TARGET")
+	if target == "" {
+		target = "<target>"
+	}
+	return fmt.Errorf("The rendered templates do not match the snapshot %s:\n%s\nTo update the snapshot, run:\n  RULES_HELM_UPDATE_SNAPSHOTS=1 bazel run %s", workspacePath, diff, target)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const snapshotOutput = `---
+# Source: mychart/templates/service.yaml
+kind: Service
+apiVersion: v1
+metadata:
+  name: web
+---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      annotations:
+        checksum/config: 2b9d6e1f
+        owner: team
+`
+
+const expectedSnapshot = `---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      annotations:
+        checksum/config: <masked>
+        owner: team
+---
+# Source: mychart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+var snapshotMasks = []string{`.spec.template.metadata.annotations["checksum/config"]`}
+
+func TestNormalizeSnapshot(t *testing.T) {
+	rendered, err := normalizeSnapshot(snapshotOutput, snapshotMasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != expectedSnapshot {
+		t.Errorf("Unexpected snapshot:\n%s\nExpected:\n%s", rendered, expectedSnapshot)
+	}
+}
+
+func TestCheckSnapshot(t *testing.T) {
+	workspace := t.TempDir()
+	golden := filepath.Join(workspace, "tests/golden.yaml")
+	if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(golden, []byte(strings.Replace(expectedSnapshot, "owner: team", "owner: other", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := snapshotConfig{Path: "tests/golden.yaml", Masks: snapshotMasks}
+
+	err := checkSnapshot(snapshotOutput, config, golden, false)
+	if err == nil {
+		t.Fatal("Expected the snapshot to mismatch")
+	}
+	for _, line := range []string{"--- tests/golden.yaml", "+++ rendered", "-        owner: other", "+        owner: team"} {
+		if !strings.Contains(err.Error(), line+"\n") {
+			t.Errorf("Expected the diff to contain `%s`:\n%s", line, err)
+		}
+	}
+
+	t.Setenv("BUILD_WORKSPACE_DIRECTORY", "")
+	os.Unsetenv("BUILD_WORKSPACE_DIRECTORY")
+	if err := checkSnapshot(snapshotOutput, config, golden, true); err == nil {
+		t.Error("Expected updating snapshots to require `bazel run`")
+	}
+
+	t.Setenv("BUILD_WORKSPACE_DIRECTORY", workspace)
+	if err := checkSnapshot(snapshotOutput, config, golden, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSnapshot(snapshotOutput, config, golden, false); err != nil {
+		t.Errorf("Expected the updated snapshot to match: %v", err)
+	}
+}
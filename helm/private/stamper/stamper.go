@@ -6,40 +6,14 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
-)
-
-func loadStamps(stampFiles ...string) (map[string]string, error) {
-	stamps := map[string]string{}
 
-	for _, stampFile := range stampFiles {
-		// The files may not be defined
-		if len(stampFile) == 0 {
-			continue
-		}
-
-		content, err := os.ReadFile(stampFile)
-		if err != nil {
-			return nil, fmt.Errorf("Error reading file %s: %w", stampFile, err)
-		}
-
-		for _, line := range strings.Split(string(content), "\n") {
-			split := strings.SplitN(line, " ", 2)
-			if len(split) < 2 {
-				continue
-			}
-			key, val := split[0], split[1]
-			stamps[key] = val
-		}
-	}
-
-	return stamps, nil
-}
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
 
-func replaceKeyValues(content string, stamps map[string]string) (string, error) {
-	for key, value := range stamps {
-		replaceKey := fmt.Sprintf("{%s}", key)
-		content = strings.ReplaceAll(content, replaceKey, value)
+func replaceKeyValues(content string, stamps map[string]string, syntax helm_utils.PlaceholderSyntax) (string, error) {
+	content, _, err := helm_utils.ExpandPlaceholders(content, helm_utils.MapLookup(stamps), helm_utils.ExpandOptions{Finalize: true, Syntax: syntax})
+	if err != nil {
+		return content, err
 	}
 
 	return content, nil
@@ -97,19 +71,26 @@ func main() {
 	output := flag.String("output", "", "The output file.")
 	stableStatusFile := flag.String("stable_status_file", "", "The path to the stable workspace status file.")
 	volatileStatusFile := flag.String("volatile_status_file", "", "The path to the volatile workspace status file.")
+	placeholderSyntax := flag.String("placeholder_syntax", "", "The name of the delimiters used for stamp placeholders.")
 
 	flag.CommandLine.Parse(internalArgs)
 
+	syntax, err := helm_utils.ParsePlaceholderSyntax(*placeholderSyntax)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Collect all stamp values
-	stamps, err := loadStamps(*stableStatusFile, *volatileStatusFile)
+	stamps, err := helm_utils.LoadWorkspaceStatus(*stableStatusFile, *volatileStatusFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	for i, item := range stampableArgs {
-		updated, err := replaceKeyValues(item, stamps)
+		updated, err := replaceKeyValues(item, stamps, syntax)
 		if err != nil {
-			log.Fatal(err)
+			// The argument itself is not reported as it may contain secrets.
+			log.Fatalf("Error stamping argument %d: %s", i+1, err)
 		}
 		stampableArgs[i] = updated
 	}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// negatedAsserts maps assert types to the positive types they negate.
+var negatedAsserts = map[string]string{
+	"isNotEmpty":    "isEmpty",
+	"isNotNull":     "isNull",
+	"isNotSubset":   "isSubset",
+	"notContains":   "contains",
+	"notEqual":      "equal",
+	"notExists":     "exists",
+	"notMatchRegex": "matchRegex",
+}
+
+// Assert is a single entry of the `asserts` of a test case.
+type Assert struct {
+	Type     string
+	Params   map[string]interface{}
+	Not      bool
+	Template string
+
+	DocumentIndex    *int
+	DocumentSelector *DocumentSelector
+}
+
+// parseAssert reads an assert such as `{equal: {path: spec.replicas, value: 3}, not: true}`.
+func parseAssert(raw map[string]interface{}) (Assert, error) {
+	var assert Assert
+
+	for key, value := range raw {
+		switch key {
+		case "not":
+			not, ok := value.(bool)
+			if !ok {
+				return assert, fmt.Errorf("`not` must be a boolean")
+			}
+			assert.Not = not
+		case "template":
+			assert.Template, _ = value.(string)
+		case "documentIndex":
+			index, ok := value.(int)
+			if !ok {
+				return assert, fmt.Errorf("`documentIndex` must be an integer")
+			}
+			assert.DocumentIndex = &index
+		case "documentSelector":
+			selector, _ := value.(map[string]interface{})
+			path, _ := selector["path"].(string)
+			if path == "" {
+				return assert, fmt.Errorf("`documentSelector` requires a `path`")
+			}
+			assert.DocumentSelector = &DocumentSelector{Path: path, Value: selector["value"]}
+		default:
+			if assert.Type != "" {
+				return assert, fmt.Errorf("An assert may only have one type, found `%s` and `%s`", assert.Type, key)
+			}
+			assert.Type = key
+			assert.Params, _ = value.(map[string]interface{})
+			if assert.Params == nil {
+				assert.Params = map[string]interface{}{}
+			}
+		}
+	}
+
+	if assert.Type == "" {
+		return assert, fmt.Errorf("The assert has no type")
+	}
+
+	if positive, found := negatedAsserts[assert.Type]; found {
+		assert.Type = positive
+		assert.Not = !assert.Not
+	}
+	if _, found := documentAsserts[assert.Type]; !found && assert.Type != "hasDocuments" && assert.Type != "failedTemplate" {
+		return assert, fmt.Errorf("Unsupported assert type `%s`", assert.Type)
+	}
+
+	return assert, nil
+}
+
+// lookup resolves the `path` parameter of an assert within a document.
+func lookup(object map[string]interface{}, params map[string]interface{}) (interface{}, bool, error) {
+	path, _ := params["path"].(string)
+	if path == "" {
+		return nil, false, fmt.Errorf("`path` is required")
+	}
+	segments, err := helm_utils.ParsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	values := helm_utils.ResolvePath(object, segments)
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	return helm_utils.NormalizeValue(values[0]), true, nil
+}
+
+// isSubset reports whether every key of subset has an equal value in value.
+func isSubset(value interface{}, subset interface{}) bool {
+	mapping, ok := value.(map[string]interface{})
+	expected, isMap := subset.(map[string]interface{})
+	if !ok || !isMap {
+		return reflect.DeepEqual(value, subset)
+	}
+	for key, item := range expected {
+		if !reflect.DeepEqual(mapping[key], item) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmpty reports whether a value is null, empty, or zero.
+func isEmpty(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case string:
+		return typed == ""
+	case bool:
+		return !typed
+	case float64:
+		return typed == 0
+	case map[string]interface{}:
+		return len(typed) == 0
+	case []interface{}:
+		return len(typed) == 0
+	}
+	return false
+}
+
+// documentAssert checks a single document. It returns whether the assert holds and a
+// description of the actual value for failure messages.
+type documentAssert func(object map[string]interface{}, params map[string]interface{}) (bool, string, error)
+
+var documentAsserts = map[string]documentAssert{
+	"equal": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, _, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		expected := helm_utils.NormalizeValue(params["value"])
+		return reflect.DeepEqual(value, expected), fmt.Sprintf("expected %s, got %s", helm_utils.FormatValue(expected), helm_utils.FormatValue(value)), nil
+	},
+	"matchRegex": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, found, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		pattern, _ := params["pattern"].(string)
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, "", fmt.Errorf("Error compiling `pattern`: %w", err)
+		}
+		text, isString := value.(string)
+		if !found || !isString {
+			return false, fmt.Sprintf("expected a string matching `%s`, got %s", pattern, helm_utils.FormatValue(value)), nil
+		}
+		return regex.MatchString(text), fmt.Sprintf("pattern `%s`, value %s", pattern, helm_utils.FormatValue(text)), nil
+	},
+	"contains": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, _, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return false, fmt.Sprintf("expected a list, got %s", helm_utils.FormatValue(value)), nil
+		}
+		content := helm_utils.NormalizeValue(params["content"])
+		anyMatch, _ := params["any"].(bool)
+		matches := 0
+		for _, item := range items {
+			if (anyMatch && isSubset(item, content)) || reflect.DeepEqual(item, content) {
+				matches++
+			}
+		}
+		description := fmt.Sprintf("content %s, list %s", helm_utils.FormatValue(content), helm_utils.FormatValue(items))
+		if count, hasCount := params["count"].(int); hasCount {
+			return matches == count, fmt.Sprintf("expected %d matches, got %d: %s", count, matches, description), nil
+		}
+		return matches > 0, description, nil
+	},
+	"isNull": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, _, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		return value == nil, fmt.Sprintf("value %s", helm_utils.FormatValue(value)), nil
+	},
+	"isEmpty": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, _, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		return isEmpty(value), fmt.Sprintf("value %s", helm_utils.FormatValue(value)), nil
+	},
+	"exists": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, found, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		if !found {
+			return false, "the path does not exist", nil
+		}
+		return true, fmt.Sprintf("value %s", helm_utils.FormatValue(value)), nil
+	},
+	"isSubset": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, _, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		content := helm_utils.NormalizeValue(params["content"])
+		if _, ok := content.(map[string]interface{}); !ok {
+			return false, "", fmt.Errorf("`content` must be a mapping")
+		}
+		return isSubset(value, content), fmt.Sprintf("content %s, value %s", helm_utils.FormatValue(content), helm_utils.FormatValue(value)), nil
+	},
+	"lengthEqual": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		value, _, err := lookup(object, params)
+		if err != nil {
+			return false, "", err
+		}
+		count, ok := params["count"].(int)
+		if !ok {
+			return false, "", fmt.Errorf("`count` must be an integer")
+		}
+		length := -1
+		switch typed := value.(type) {
+		case []interface{}:
+			length = len(typed)
+		case map[string]interface{}:
+			length = len(typed)
+		}
+		return length == count, fmt.Sprintf("expected length %d, got %s", count, helm_utils.FormatValue(value)), nil
+	},
+	"isKind": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		of, _ := params["of"].(string)
+		return object["kind"] == of, fmt.Sprintf("expected kind %s, got %s", helm_utils.FormatValue(of), helm_utils.FormatValue(object["kind"])), nil
+	},
+	"isAPIVersion": func(object map[string]interface{}, params map[string]interface{}) (bool, string, error) {
+		of, _ := params["of"].(string)
+		return object["apiVersion"] == of, fmt.Sprintf("expected apiVersion %s, got %s", helm_utils.FormatValue(of), helm_utils.FormatValue(object["apiVersion"])), nil
+	},
+}
+
+// rendering is the outcome of rendering the chart for a test case.
+type rendering struct {
+	// documents are those rendered from the templates under test.
+	documents []helm_utils.Manifest
+
+	// err is the error helm reported, if rendering failed.
+	err string
+}
+
+// selectDocuments narrows documents to those the assert targets.
+func selectDocuments(documents []helm_utils.Manifest, test TestCase, assert Assert) ([]helm_utils.Manifest, error) {
+	if assert.Template != "" {
+		template := normalizeTemplate(assert.Template)
+		var selected []helm_utils.Manifest
+		for _, document := range documents {
+			if matchesTemplate(document.Source, []string{template}) {
+				selected = append(selected, document)
+			}
+		}
+		documents = selected
+	}
+
+	selector := test.DocumentSelector
+	if assert.DocumentSelector != nil {
+		selector = assert.DocumentSelector
+	}
+	if selector != nil {
+		segments, err := helm_utils.ParsePath(selector.Path)
+		if err != nil {
+			return nil, err
+		}
+		var selected []helm_utils.Manifest
+		for _, document := range documents {
+			for _, value := range helm_utils.ResolvePath(document.Object, segments) {
+				if reflect.DeepEqual(helm_utils.NormalizeValue(value), helm_utils.NormalizeValue(selector.Value)) {
+					selected = append(selected, document)
+					break
+				}
+			}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("No document matches the selector `%s: %s`", selector.Path, helm_utils.FormatValue(selector.Value))
+		}
+		documents = selected
+	}
+
+	index := test.DocumentIndex
+	if assert.DocumentIndex != nil {
+		index = assert.DocumentIndex
+	}
+	if index != nil {
+		if *index < 0 || *index >= len(documents) {
+			return nil, fmt.Errorf("documentIndex %d is out of range, %d documents were rendered", *index, len(documents))
+		}
+		documents = documents[*index : *index+1]
+	}
+
+	return documents, nil
+}
+
+// evaluate checks an assert against the rendering of a test case and returns a
+// description of the failure or an empty string.
+func (a Assert) evaluate(result rendering, test TestCase) string {
+	negation := ""
+	if a.Not {
+		negation = "not "
+	}
+
+	if a.Type == "failedTemplate" {
+		failed := result.err != ""
+		if failed {
+			if message, found := a.Params["errorMessage"].(string); found {
+				failed = strings.Contains(result.err, message)
+			}
+			if pattern, found := a.Params["errorPattern"].(string); found {
+				regex, err := regexp.Compile(pattern)
+				if err != nil {
+					return fmt.Sprintf("Error compiling `errorPattern`: %s", err)
+				}
+				failed = failed && regex.MatchString(result.err)
+			}
+		}
+		if failed == a.Not {
+			return fmt.Sprintf("expected rendering %sto fail as specified by %s, got error: %s", negation, helm_utils.FormatValue(a.Params), helm_utils.FormatValue(result.err))
+		}
+		return ""
+	}
+
+	if result.err != "" {
+		return fmt.Sprintf("rendering failed: %s", result.err)
+	}
+
+	// hasDocuments counts documents before any documentIndex is applied.
+	if a.Type == "hasDocuments" {
+		documents, err := selectDocuments(result.documents, TestCase{DocumentSelector: test.DocumentSelector}, Assert{Template: a.Template, DocumentSelector: a.DocumentSelector})
+		if err != nil {
+			documents = nil
+		}
+		count, ok := a.Params["count"].(int)
+		if !ok {
+			return "`count` must be an integer"
+		}
+		if (len(documents) == count) == a.Not {
+			return fmt.Sprintf("expected %s%d documents, got %d", negation, count, len(documents))
+		}
+		return ""
+	}
+
+	documents, err := selectDocuments(result.documents, test, a)
+	if err != nil {
+		return err.Error()
+	}
+	if len(documents) == 0 {
+		return "no documents were rendered by the templates under test"
+	}
+
+	var failures []string
+	for _, document := range documents {
+		holds, description, err := documentAsserts[a.Type](document.Object, a.Params)
+		if err != nil {
+			return err.Error()
+		}
+		if holds == a.Not {
+			failures = append(failures, fmt.Sprintf("%s[%d]: %s", document.Source, document.Index, description))
+		}
+	}
+	sort.Strings(failures)
+
+	if len(failures) > 0 {
+		return fmt.Sprintf("%s%s %s failed:\n    %s", negation, a.Type, helm_utils.FormatValue(a.Params), strings.Join(failures, "\n    "))
+	}
+	return ""
+}
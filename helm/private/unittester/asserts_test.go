@@ -0,0 +1,249 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+	"gopkg.in/yaml.v3"
+)
+
+const renderedDocuments = `---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app.kubernetes.io/name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: app
+          image: registry.io/app:1.0
+          ports:
+            - name: http
+              containerPort: 80
+      nodeSelector: {}
+---
+# Source: mychart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - name: http
+      port: 80
+---
+# Source: mychart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web-headless
+spec:
+  clusterIP: None
+`
+
+func parseAsserts(t *testing.T, content string) []Assert {
+	t.Helper()
+
+	var raw []map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	var asserts []Assert
+	for _, entry := range raw {
+		assert, err := parseAssert(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asserts = append(asserts, assert)
+	}
+	return asserts
+}
+
+func evaluateAll(t *testing.T, result rendering, test TestCase, content string) []string {
+	t.Helper()
+
+	var failures []string
+	for _, assert := range parseAsserts(t, content) {
+		if failure := assert.evaluate(result, test); failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+func TestAssertsPass(t *testing.T) {
+	manifests, err := helm_utils.ParseManifests(renderedDocuments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := rendering{documents: manifests}
+
+	failures := evaluateAll(t, result, TestCase{}, `
+- hasDocuments:
+    count: 3
+- hasDocuments:
+    count: 2
+  template: service.yaml
+- isKind:
+    of: Deployment
+  documentIndex: 0
+- isAPIVersion:
+    of: v1
+  template: service.yaml
+- equal:
+    path: spec.replicas
+    value: 3
+  template: deployment.yaml
+- notEqual:
+    path: spec.replicas
+    value: "3"
+  template: deployment.yaml
+- equal:
+    path: metadata.labels["app.kubernetes.io/name"]
+    value: web
+  documentIndex: 0
+- matchRegex:
+    path: metadata.name
+    pattern: ^web
+- notMatchRegex:
+    path: spec.template.spec.containers[0].image
+    pattern: :latest$
+  template: deployment.yaml
+- contains:
+    path: spec.template.spec.containers[0].ports
+    content:
+      name: http
+      containerPort: 80
+    count: 1
+  template: deployment.yaml
+- contains:
+    path: spec.template.spec.containers
+    content:
+      name: app
+    any: true
+  template: deployment.yaml
+- notContains:
+    path: spec.ports
+    content:
+      name: https
+  documentSelector:
+    path: metadata.name
+    value: web
+- isNull:
+    path: spec.clusterIP
+  documentSelector:
+    path: metadata.name
+    value: web
+- isNotNull:
+    path: spec.clusterIP
+  documentIndex: 1
+  template: service.yaml
+- isEmpty:
+    path: spec.template.spec.nodeSelector
+  template: deployment.yaml
+- isNotEmpty:
+    path: metadata.name
+- exists:
+    path: spec
+- notExists:
+    path: spec.template.spec.hostNetwork
+  template: deployment.yaml
+- isSubset:
+    path: metadata.labels
+    content:
+      app.kubernetes.io/name: web
+  template: deployment.yaml
+- lengthEqual:
+    path: spec.template.spec.containers
+    count: 1
+  template: deployment.yaml
+- failedTemplate: {}
+  not: true
+`)
+	if len(failures) > 0 {
+		t.Errorf("Unexpected failures:\n%s", strings.Join(failures, "\n"))
+	}
+}
+
+func TestAssertsFail(t *testing.T) {
+	manifests, err := helm_utils.ParseManifests(renderedDocuments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := rendering{documents: manifests}
+
+	failures := evaluateAll(t, result, TestCase{}, `
+- hasDocuments:
+    count: 1
+- equal:
+    path: spec.replicas
+    value: 2
+  template: deployment.yaml
+- isKind:
+    of: Service
+- equal:
+    path: spec.replicas
+    value: 3
+  documentIndex: 5
+- failedTemplate:
+    errorMessage: required
+`)
+
+	expected := []string{
+		"expected 1 documents, got 3",
+		"equal {\"path\":\"spec.replicas\",\"value\":2} failed:\n    mychart/templates/deployment.yaml[0]: expected 2, got 3",
+		"isKind {\"of\":\"Service\"} failed:\n    mychart/templates/deployment.yaml[0]: expected kind \"Service\", got \"Deployment\"",
+		"documentIndex 5 is out of range, 3 documents were rendered",
+		"expected rendering to fail as specified by {\"errorMessage\":\"required\"}, got error: \"\"",
+	}
+	if strings.Join(failures, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected failures:\n%s\nExpected:\n%s", strings.Join(failures, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestFailedTemplate(t *testing.T) {
+	result := rendering{err: "Error: execution error at (mychart/templates/deployment.yaml:3:4): image.tag is required"}
+
+	failures := evaluateAll(t, result, TestCase{}, `
+- failedTemplate:
+    errorMessage: image.tag is required
+- failedTemplate:
+    errorPattern: "deployment.yaml:\\d+:\\d+"
+`)
+	if len(failures) > 0 {
+		t.Errorf("Unexpected failures:\n%s", strings.Join(failures, "\n"))
+	}
+
+	failures = evaluateAll(t, result, TestCase{}, `
+- equal:
+    path: spec.replicas
+    value: 1
+`)
+	if len(failures) != 1 || !strings.HasPrefix(failures[0], "rendering failed: ") {
+		t.Errorf("Expected a rendering failure, got %v", failures)
+	}
+}
+
+func TestParseAssertErrors(t *testing.T) {
+	for _, content := range []string{
+		`{unknownAssert: {path: spec}}`,
+		`{equal: {path: spec}, isKind: {of: Service}}`,
+		`{not: true}`,
+		`{equal: {path: spec}, not: "yes"}`,
+	} {
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal([]byte(content), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseAssert(raw); err == nil {
+			t.Errorf("Expected an error parsing %s", content)
+		}
+	}
+}
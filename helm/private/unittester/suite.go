@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Release overrides the release the chart is rendered as.
+type Release struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Upgrade   bool   `yaml:"upgrade"`
+}
+
+// Capabilities overrides the capabilities of the cluster the chart is rendered for.
+type Capabilities struct {
+	MajorVersion string   `yaml:"majorVersion"`
+	MinorVersion string   `yaml:"minorVersion"`
+	APIVersions  []string `yaml:"apiVersions"`
+}
+
+// DocumentSelector selects the documents whose value at Path equals Value.
+type DocumentSelector struct {
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+}
+
+// TestCase is a single entry of the `tests` of a suite.
+type TestCase struct {
+	It               string                   `yaml:"it"`
+	Template         string                   `yaml:"template"`
+	Templates        []string                 `yaml:"templates"`
+	DocumentIndex    *int                     `yaml:"documentIndex"`
+	DocumentSelector *DocumentSelector        `yaml:"documentSelector"`
+	Set              map[string]interface{}   `yaml:"set"`
+	Values           []string                 `yaml:"values"`
+	Release          Release                  `yaml:"release"`
+	Capabilities     Capabilities             `yaml:"capabilities"`
+	Asserts          []map[string]interface{} `yaml:"asserts"`
+	Skip             interface{}              `yaml:"skip"`
+}
+
+// Suite is a helm-unittest test suite, typically `tests/*_test.yaml` within a chart.
+type Suite struct {
+	Name         string                 `yaml:"suite"`
+	Templates    []string               `yaml:"templates"`
+	Release      Release                `yaml:"release"`
+	Capabilities Capabilities           `yaml:"capabilities"`
+	Set          map[string]interface{} `yaml:"set"`
+	Values       []string               `yaml:"values"`
+	Tests        []TestCase             `yaml:"tests"`
+
+	// path is the location of the suite file, which values files are relative to.
+	path string
+}
+
+// Defaults used by helm-unittest. `helm template` requires release names to be lowercase.
+const (
+	defaultReleaseName      = "release-name"
+	defaultReleaseNamespace = "NAMESPACE"
+)
+
+// loadSuite reads a suite file.
+func loadSuite(suitePath string) (Suite, error) {
+	var suite Suite
+
+	content, err := os.ReadFile(suitePath)
+	if err != nil {
+		return suite, fmt.Errorf("Error reading suite %s: %w", suitePath, err)
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&suite); err != nil {
+		return suite, fmt.Errorf("Error parsing suite %s: %w", suitePath, err)
+	}
+
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(suitePath), filepath.Ext(suitePath))
+	}
+	if len(suite.Tests) == 0 {
+		return suite, fmt.Errorf("Suite %s has no tests", suitePath)
+	}
+	for i, test := range suite.Tests {
+		if test.It == "" {
+			return suite, fmt.Errorf("Test %d of suite %s has no `it` description", i, suitePath)
+		}
+	}
+
+	suite.path = suitePath
+	return suite, nil
+}
+
+// skipped reports whether a test case is marked to be skipped, along with the reason.
+func (t TestCase) skipped() (bool, string) {
+	switch skip := t.Skip.(type) {
+	case bool:
+		return skip, ""
+	case map[string]interface{}:
+		reason, _ := skip["reason"].(string)
+		return true, reason
+	}
+	return false, ""
+}
+
+// release merges the release of a test case over that of its suite.
+func (s Suite) release(test TestCase) Release {
+	release := Release{Name: defaultReleaseName, Namespace: defaultReleaseNamespace}
+	for _, override := range []Release{s.Release, test.Release} {
+		if override.Name != "" {
+			release.Name = override.Name
+		}
+		if override.Namespace != "" {
+			release.Namespace = override.Namespace
+		}
+		release.Upgrade = release.Upgrade || override.Upgrade
+	}
+	return release
+}
+
+// capabilities merges the capabilities of a test case over those of its suite.
+func (s Suite) capabilities(test TestCase) Capabilities {
+	capabilities := s.Capabilities
+	if test.Capabilities.MajorVersion != "" {
+		capabilities.MajorVersion = test.Capabilities.MajorVersion
+	}
+	if test.Capabilities.MinorVersion != "" {
+		capabilities.MinorVersion = test.Capabilities.MinorVersion
+	}
+	capabilities.APIVersions = append(append([]string{}, capabilities.APIVersions...), test.Capabilities.APIVersions...)
+	return capabilities
+}
+
+// kubeVersion returns the `--kube-version` of the capabilities, or an empty string if no
+// version is set. Kubernetes has only ever had a major version of 1, so that part defaults
+// to `1`, while the minor version must be given.
+func (c Capabilities) kubeVersion() (string, error) {
+	if c.MajorVersion == "" && c.MinorVersion == "" {
+		return "", nil
+	}
+	major := c.MajorVersion
+	if major == "" {
+		major = "1"
+	}
+	if c.MinorVersion == "" {
+		return "", fmt.Errorf("`capabilities` sets `majorVersion: %s` without a `minorVersion`", major)
+	}
+	return fmt.Sprintf("v%s.%s", major, c.MinorVersion), nil
+}
+
+// templates returns the templates a test case asserts on, relative to the chart.
+func (s Suite) templates(test TestCase) []string {
+	templates := s.Templates
+	if test.Template != "" {
+		templates = []string{test.Template}
+	} else if len(test.Templates) > 0 {
+		templates = test.Templates
+	}
+
+	var normalized []string
+	for _, template := range templates {
+		normalized = append(normalized, normalizeTemplate(template))
+	}
+	return normalized
+}
+
+// normalizeTemplate makes a template path relative to the chart root. helm-unittest
+// allows templates to be named relative to the `templates` directory.
+func normalizeTemplate(template string) string {
+	template = path.Clean(filepath.ToSlash(template))
+	if strings.HasPrefix(template, "templates/") || strings.HasPrefix(template, "charts/") {
+		return template
+	}
+	return path.Join("templates", template)
+}
+
+// matchesTemplate reports whether a rendered document's source (e.g.
+// `mychart/templates/deployment.yaml`) is one of the templates, which may be globs.
+func matchesTemplate(source string, templates []string) bool {
+	_, relative, found := strings.Cut(source, "/")
+	if !found {
+		return false
+	}
+	for _, template := range templates {
+		if matched, _ := path.Match(template, relative); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSetKey splits a `set` key into its path, honoring `\.` escapes for keys containing dots.
+func splitSetKey(key string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] == '\\' && i+1 < len(key) && key[i+1] == '.' {
+			current.WriteByte('.')
+			i++
+			continue
+		}
+		if key[i] == '.' {
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteByte(key[i])
+	}
+	return append(parts, current.String())
+}
+
+// setValues converts `set` entries into a nested values mapping. Unlike `helm --set`
+// the types of the values are preserved.
+func setValues(set map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for key, value := range set {
+		parts := splitSetKey(key)
+		current := values
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := current[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				current[part] = next
+			}
+			current = next
+		}
+		current[parts[len(parts)-1]] = value
+	}
+	return values
+}
+
+// valuesArgs returns the `--values` arguments for a test case. Values files are relative
+// to the suite file and `set` entries are written to files within tempDir. Suite values
+// are applied before those of the test case and `set` entries after values files.
+func (s Suite) valuesArgs(test TestCase, tempDir string) ([]string, error) {
+	var args []string
+	suiteDir := filepath.Dir(s.path)
+
+	for i, layer := range []struct {
+		values []string
+		set    map[string]interface{}
+	}{
+		{s.Values, s.Set},
+		{test.Values, test.Set},
+	} {
+		for _, values := range layer.values {
+			if !filepath.IsAbs(values) {
+				values = filepath.Join(suiteDir, values)
+			}
+			if _, err := os.Stat(values); err != nil {
+				return nil, fmt.Errorf("Error reading values file: %w", err)
+			}
+			args = append(args, "--values", values)
+		}
+
+		if len(layer.set) == 0 {
+			continue
+		}
+		content, err := yaml.Marshal(setValues(layer.set))
+		if err != nil {
+			return nil, fmt.Errorf("Error rendering `set` values: %w", err)
+		}
+		setFile := filepath.Join(tempDir, fmt.Sprintf("set_%d.yaml", i))
+		if err := os.WriteFile(setFile, content, 0644); err != nil {
+			return nil, err
+		}
+		args = append(args, "--values", setFile)
+	}
+
+	return args, nil
+}
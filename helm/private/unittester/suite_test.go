@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const suiteContent = `suite: deployment
+templates:
+  - deployment.yaml
+release:
+  namespace: prod
+set:
+  image.tag: "1.0"
+values:
+  - values/base.yaml
+tests:
+  - it: uses the tag
+    release:
+      name: web
+    set:
+      replicaCount: 3
+      podAnnotations.prometheus\.io/scrape: true
+    asserts:
+      - equal:
+          path: spec.replicas
+          value: 3
+  - it: is skipped
+    template: templates/service.yaml
+    skip:
+      reason: not yet
+    asserts:
+      - isKind:
+          of: Service
+`
+
+func writeSuite(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	suitePath := filepath.Join(dir, "tests/deployment_test.yaml")
+	for path, content := range map[string]string{
+		suitePath: suiteContent,
+		filepath.Join(dir, "tests/values/base.yaml"): "replicaCount: 1\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return suitePath
+}
+
+func TestLoadSuite(t *testing.T) {
+	suitePath := writeSuite(t)
+	suite, err := loadSuite(suitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release := suite.release(suite.Tests[0]); release != (Release{Name: "web", Namespace: "prod"}) {
+		t.Errorf("Unexpected release: %v", release)
+	}
+	if release := suite.release(suite.Tests[1]); release != (Release{Name: defaultReleaseName, Namespace: "prod"}) {
+		t.Errorf("Unexpected release: %v", release)
+	}
+
+	if templates := suite.templates(suite.Tests[0]); !reflect.DeepEqual(templates, []string{"templates/deployment.yaml"}) {
+		t.Errorf("Unexpected templates: %v", templates)
+	}
+	if templates := suite.templates(suite.Tests[1]); !reflect.DeepEqual(templates, []string{"templates/service.yaml"}) {
+		t.Errorf("Unexpected templates: %v", templates)
+	}
+
+	if skip, reason := suite.Tests[1].skipped(); !skip || reason != "not yet" {
+		t.Errorf("Expected the second test to be skipped")
+	}
+
+	tempDir := t.TempDir()
+	args, err := suite.valuesArgs(suite.Tests[0], tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"--values", filepath.Join(filepath.Dir(suitePath), "values/base.yaml"),
+		"--values", filepath.Join(tempDir, "set_0.yaml"),
+		"--values", filepath.Join(tempDir, "set_1.yaml"),
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Unexpected values args: %v", args)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "set_1.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "prometheus.io/scrape: true") || !strings.Contains(string(content), "replicaCount: 3") {
+		t.Errorf("Unexpected set values:\n%s", content)
+	}
+}
+
+func TestLoadSuiteErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty.yaml":   "suite: empty\n",
+		"unknown.yaml": "suite: unknown\nunknownField: true\ntests:\n  - it: works\n",
+		"no_it.yaml":   "tests:\n  - asserts: []\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadSuite(path); err == nil {
+			t.Errorf("Expected an error loading %s", name)
+		}
+	}
+}
+
+func TestMatchesTemplate(t *testing.T) {
+	templates := []string{"templates/deployment.yaml", "charts/sub/templates/*.yaml"}
+	for source, expected := range map[string]bool{
+		"mychart/templates/deployment.yaml":        true,
+		"mychart/templates/service.yaml":           false,
+		"mychart/charts/sub/templates/config.yaml": true,
+		"deployment.yaml":                          false,
+	} {
+		if matchesTemplate(source, templates) != expected {
+			t.Errorf("matchesTemplate(%s) != %v", source, expected)
+		}
+	}
+}
+
+func TestCapabilitiesKubeVersion(t *testing.T) {
+	tests := []struct {
+		capabilities Capabilities
+		expected     string
+	}{
+		{Capabilities{}, ""},
+		{Capabilities{MajorVersion: "1", MinorVersion: "29"}, "v1.29"},
+		{Capabilities{MinorVersion: "29"}, "v1.29"},
+	}
+	for _, test := range tests {
+		version, err := test.capabilities.kubeVersion()
+		if err != nil || version != test.expected {
+			t.Errorf("Expected %s for %+v, got %s (%v)", test.expected, test.capabilities, version, err)
+		}
+	}
+
+	if _, err := (Capabilities{MajorVersion: "1"}).kubeVersion(); err == nil || !strings.Contains(err.Error(), "minorVersion") {
+		t.Errorf("Expected an error for a missing minor version, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abrisco/rules_helm/helm/private/helm_utils"
+)
+
+// stringSliceFlag is a custom flag type for collecting multiple values
+type stringSliceFlag []string
+
+func (i *stringSliceFlag) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *stringSliceFlag) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
+type Arguments struct {
+	helm        string
+	helmPlugins string
+	chart       string
+	suites      stringSliceFlag
+}
+
+func parseArgs() Arguments {
+	var args Arguments
+
+	flag.StringVar(&args.helm, "helm", "", "The path to a helm executable")
+	flag.StringVar(&args.helmPlugins, "helm_plugins", "", "The path to a helm plugins directory")
+	flag.StringVar(&args.chart, "chart", "", "The path to the helm package to test.")
+	flag.Var(&args.suites, "suite", "The path to a helm-unittest suite file.")
+
+	argsFile, found := os.LookupEnv("RULES_HELM_HELM_UNITTEST_TEST_ARGS_PATH")
+	if found {
+		content, err := os.ReadFile(helm_utils.GetRunfile(argsFile))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		os.Args = append(os.Args, strings.Split(string(content), "\n")...)
+	}
+
+	flag.Parse()
+
+	return args
+}
+
+// renderer renders the chart under test.
+type renderer struct {
+	helm        string
+	helmPlugins string
+	chart       string
+	tempDir     string
+
+	// coverage records the templates rendered by each test case.
+	coverage *helm_utils.TemplateCoverage
+}
+
+// render runs `helm template` for a test case and returns the documents rendered from
+// the templates under test.
+func (r renderer) render(suite Suite, test TestCase) (rendering, error) {
+	release := suite.release(test)
+	capabilities := suite.capabilities(test)
+	kubeVersion, err := capabilities.kubeVersion()
+	if err != nil {
+		return rendering{}, fmt.Errorf("Invalid capabilities in suite %s: %w", suite.Name, err)
+	}
+
+	args := []string{"template", release.Name, r.chart, "--namespace", release.Namespace}
+	if release.Upgrade {
+		args = append(args, "--is-upgrade")
+	}
+	if kubeVersion != "" {
+		args = append(args, "--kube-version", kubeVersion)
+	}
+	for _, apiVersion := range capabilities.APIVersions {
+		args = append(args, "--api-versions", apiVersion)
+	}
+
+	tempDir, err := os.MkdirTemp(r.tempDir, "test-")
+	if err != nil {
+		return rendering{}, err
+	}
+	valuesArgs, err := suite.valuesArgs(test, tempDir)
+	if err != nil {
+		return rendering{}, err
+	}
+	args = append(args, valuesArgs...)
+
+	cmd, err := helm_utils.BuildHelmCommand(r.helm, args, r.helmPlugins)
+	if err != nil {
+		return rendering{}, err
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return rendering{err: strings.TrimSpace(string(exitErr.Stderr))}, nil
+		}
+		return rendering{}, err
+	}
+
+	manifests, err := helm_utils.ParseManifests(string(out))
+	if err != nil {
+		return rendering{}, err
+	}
+	if r.coverage != nil {
+		r.coverage.Record(manifests)
+	}
+
+	templates := suite.templates(test)
+	var documents []helm_utils.Manifest
+	for _, manifest := range manifests {
+		if len(templates) == 0 || matchesTemplate(manifest.Source, templates) {
+			documents = append(documents, manifest)
+		}
+	}
+
+	return rendering{documents: documents}, nil
+}
+
+// runTest renders and checks a single test case, returning its failures.
+func (r renderer) runTest(suite Suite, test TestCase) []string {
+	var asserts []Assert
+	for i, raw := range test.Asserts {
+		assert, err := parseAssert(raw)
+		if err != nil {
+			return []string{fmt.Sprintf("asserts[%d]: %s", i, err)}
+		}
+		asserts = append(asserts, assert)
+	}
+
+	result, err := r.render(suite, test)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var failures []string
+	for i, assert := range asserts {
+		if failure := assert.evaluate(result, test); failure != "" {
+			failures = append(failures, fmt.Sprintf("asserts[%d]: %s", i, failure))
+		}
+	}
+	return failures
+}
+
+// runSuite runs every test case of a suite and records the results as a JUnit test suite.
+func (r renderer) runSuite(suite Suite, className string) helm_utils.JUnitTestSuite {
+	junitSuite := helm_utils.JUnitTestSuite{Name: suite.Name}
+
+	for _, test := range suite.Tests {
+		testCase := helm_utils.JUnitTestCase{
+			Name:      test.It,
+			ClassName: className,
+		}
+
+		if skip, reason := test.skipped(); skip {
+			testCase.Skipped = &helm_utils.JUnitSkipped{Message: reason}
+			fmt.Fprintf(os.Stderr, "SKIP  %s: %s\n", suite.Name, test.It)
+			junitSuite.TestCases = append(junitSuite.TestCases, testCase)
+			continue
+		}
+
+		start := time.Now()
+		failures := r.runTest(suite, test)
+		testCase.Time = time.Since(start).Seconds()
+
+		if len(failures) > 0 {
+			testCase.Failure = &helm_utils.JUnitFailure{
+				Message: fmt.Sprintf("%d assertion(s) failed", len(failures)),
+				Type:    "AssertionError",
+				Content: strings.Join(failures, "\n"),
+			}
+			fmt.Fprintf(os.Stderr, "FAIL  %s: %s\n  %s\n", suite.Name, test.It, strings.Join(failures, "\n  "))
+		} else {
+			fmt.Fprintf(os.Stderr, "PASS  %s: %s\n", suite.Name, test.It)
+		}
+
+		junitSuite.TestCases = append(junitSuite.TestCases, testCase)
+	}
+
+	return junitSuite
+}
+
+func main() {
+	args := parseArgs()
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if args.chart == "" || len(args.suites) == 0 {
+		log.Fatal("The -chart and -suite arguments are required")
+	}
+
+	tempDir, err := os.MkdirTemp(os.Getenv("TEST_TMPDIR"), "helm_unittest-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	chart := helm_utils.GetRunfile(args.chart)
+	coverage, err := helm_utils.NewTemplateCoverage(chart)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := renderer{
+		helm:        helm_utils.GetRunfile(args.helm),
+		helmPlugins: helm_utils.GetRunfile(args.helmPlugins),
+		chart:       chart,
+		tempDir:     tempDir,
+		coverage:    coverage,
+	}
+
+	report := helm_utils.JUnitTestSuites{Name: filepath.Base(args.chart)}
+	for _, suitePath := range args.suites {
+		suite, err := loadSuite(helm_utils.GetRunfile(suitePath))
+		if err != nil {
+			log.Fatal(err)
+		}
+		report.Suites = append(report.Suites, r.runSuite(suite, suitePath))
+	}
+
+	if xmlOutput, found := os.LookupEnv("XML_OUTPUT_FILE"); found {
+		if err := helm_utils.WriteJUnitReport(xmlOutput, report); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := helm_utils.WriteTemplateCoverage(coverage); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "\n%s", coverage.Report())
+
+	total, failed := 0, 0
+	for _, suite := range report.Suites {
+		for _, testCase := range suite.TestCases {
+			total++
+			if testCase.Failure != nil {
+				failed++
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%d of %d tests passed\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
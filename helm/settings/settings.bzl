@@ -6,6 +6,7 @@ Definitions for all `@rules_helm//helm` settings
 load(
     "@bazel_skylib//rules:common_settings.bzl",
     "bool_flag",
+    "string_flag",
 )
 
 def lint_default_strict():
@@ -15,3 +16,31 @@ def lint_default_strict():
         name = "lint_default_strict",
         build_setting_default = True,
     )
+
+def placeholder_syntax():
+    """A flag to control the delimiters of substitution and stamp placeholders.
+
+    Placeholders are expanded by `helm_package` in `Chart.yaml`, `values.yaml` and
+    `values.schema.json` and by `helm_install`/`helm_upgrade`/`helm_uninstall` in their
+    arguments. The default `{KEY}` syntax can clash with YAML/JSON flow maps or helm's
+    `--set a={x,y}` list syntax so alternatives are available:
+
+    | value | placeholder |
+    | --- | --- |
+    | `braces` | `{KEY}` |
+    | `dollar_braces` | `${KEY}` |
+    | `stamp` | `{{stamp:KEY}}` |
+
+    With `dollar_braces` and `stamp`, a placeholder preceded by a backslash (e.g.
+    `\\${KEY}`) is written out literally without the backslash. `braces` has no escapes
+    so existing content such as `\\{3\\}` in a regular expression is left untouched.
+    """
+    string_flag(
+        name = "placeholder_syntax",
+        build_setting_default = "braces",
+        values = [
+            "braces",
+            "dollar_braces",
+            "stamp",
+        ],
+    )
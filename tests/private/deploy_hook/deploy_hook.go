@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// A deploy hook which reports the release it was run for.
+func main() {
+	for _, key := range []string{
+		"RULES_HELM_HOOK_PHASE",
+		"RULES_HELM_RELEASE_NAME",
+		"RULES_HELM_RELEASE_NAMESPACE",
+		"RULES_HELM_CHART_NAME",
+		"RULES_HELM_CHART_VERSION",
+	} {
+		value := os.Getenv(key)
+		if value == "" {
+			log.Fatalf("The environment variable `%s` is not set", key)
+		}
+		fmt.Printf("%s=%s\n", key, value)
+	}
+
+	if exitCode, found := os.LookupEnv("RULES_HELM_HELM_EXIT_CODE"); found {
+		fmt.Printf("RULES_HELM_HELM_EXIT_CODE=%s\n", exitCode)
+	}
+}
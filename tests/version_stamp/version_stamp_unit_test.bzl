@@ -58,6 +58,19 @@ def version_stamp_test_suite(name):
             chart = ":version_stamp.{}".format(name),
         )
 
+        helm_package(
+            name = "version_stamp_defaults.{}".format(name),
+            chart = "Chart.defaults.yaml",
+            templates = native.glob(["templates/**"]),
+            values = "values.yaml",
+            stamp = stamp_value,
+        )
+
+        _helm_pkg_metadata(
+            name = "version_stamp_defaults.{}.metadata".format(name),
+            chart = ":version_stamp_defaults.{}".format(name),
+        )
+
     write_file(
         name = "version_stamp.no_stamp.expected_metadata",
         out = "version_stamp.no_stamp.expected_metadata.json",
@@ -94,6 +107,42 @@ def version_stamp_test_suite(name):
         file2 = ":version_stamp.stamp.metadata",
     )
 
+    write_file(
+        name = "version_stamp_defaults.no_stamp.expected_metadata",
+        out = "version_stamp_defaults.no_stamp.expected_metadata.json",
+        content = """\
+{
+    "name": "version-stamp-defaults",
+    "version": "0.1.0+NOSTAMP-fallback"
+}
+""".splitlines(),
+        newline = "unix",
+    )
+
+    diff_test(
+        name = "version_stamp_defaults.no_stamp.diff_test",
+        file1 = ":version_stamp_defaults.no_stamp.expected_metadata",
+        file2 = ":version_stamp_defaults.no_stamp.metadata",
+    )
+
+    write_file(
+        name = "version_stamp_defaults.stamp.expected_metadata",
+        out = "version_stamp_defaults.stamp.expected_metadata.json",
+        content = """\
+{
+    "name": "version-stamp-defaults",
+    "version": "0.1.0+STABLE-fallback"
+}
+""".splitlines(),
+        newline = "unix",
+    )
+
+    diff_test(
+        name = "version_stamp_defaults.stamp.diff_test",
+        file1 = ":version_stamp_defaults.stamp.expected_metadata",
+        file2 = ":version_stamp_defaults.stamp.metadata",
+    )
+
     native.test_suite(
         name = name,
         tests = [
@@ -101,5 +150,7 @@ def version_stamp_test_suite(name):
             "version_stamp.no_stamp.lint_test",
             "version_stamp.stamp.diff_test",
             "version_stamp.no_stamp.diff_test",
+            "version_stamp_defaults.stamp.diff_test",
+            "version_stamp_defaults.no_stamp.diff_test",
         ],
     )